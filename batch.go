@@ -0,0 +1,194 @@
+package sage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// CreateBatch inserts the models in the slice with multi-row INSERT statements,
+// split into several statements when they exceed the dialect's parameter limit.
+//
+// Auto-increment primary keys are back-filled from each statement's result.
+// database/sql runs every statement on a single pooled connection, so the
+// returned id always belongs to this insert. MySQL reports the id of the first
+// row and SQLite the id of the last row; ids are assigned to the remaining rows
+// assuming they are consecutive, which MySQL only guarantees with
+// innodb_autoinc_lock_mode 0 or 1. Postgres does not report insert ids and
+// keys are left unset.
+func (c *Connection) CreateBatch(ctx context.Context, models interface{}) error {
+	sliceValue, info, err := c.batchModels(ctx, models)
+	if err != nil || sliceValue.Len() == 0 {
+		return err
+	}
+
+	return c.insertBatch(ctx, sliceValue, info, "create", "", func(result sql.Result, rows []reflect.Value) {
+		id, err := result.LastInsertId()
+		if err != nil {
+			return
+		}
+
+		first := id
+		if c.dialect.Name() == "sqlite" {
+			first = id - int64(len(rows)) + 1
+		}
+		for i, v := range rows {
+			setAutoID(v, info, first+int64(i))
+		}
+	})
+}
+
+// batchModels returns the slice value and model info of a slice of models
+func (c *Connection) batchModels(ctx context.Context, models interface{}) (reflect.Value, *ModelInfo, error) {
+	sliceValue := reflect.ValueOf(models)
+	if sliceValue.Kind() == reflect.Ptr {
+		sliceValue = sliceValue.Elem()
+	}
+
+	if sliceValue.Kind() != reflect.Slice {
+		return reflect.Value{}, nil, errors.New("models must be a slice or pointer to a slice")
+	}
+
+	elemType := sliceValue.Type().Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+
+	info, err := c.modelInfo(ctx, reflect.New(elemType).Interface())
+	if err != nil {
+		return reflect.Value{}, nil, err
+	}
+
+	return sliceValue, info, nil
+}
+
+// insertBatch inserts the models of the slice in chunks, appending clause to
+// every statement. inserted, if set, is called with each statement's result
+// and the rows it inserted.
+func (c *Connection) insertBatch(ctx context.Context, sliceValue reflect.Value, info *ModelInfo, op string, clause string, inserted func(sql.Result, []reflect.Value)) error {
+	var fields []FieldInfo
+	var columns []string
+	for _, field := range info.Fields {
+		// Skip auto-increment primary key fields
+		if field.IsKey && field.IsAuto {
+			continue
+		}
+		fields = append(fields, field)
+		columns = append(columns, c.dialect.Quote(field.DBName))
+	}
+
+	if len(fields) == 0 {
+		return WrapError(ErrInvalidArgument, "%s %s: no columns to insert", op, info.TableName)
+	}
+
+	chunkSize := c.dialect.MaxPlaceholders() / len(fields)
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+
+	for start := 0; start < sliceValue.Len(); start += chunkSize {
+		end := start + chunkSize
+		if end > sliceValue.Len() {
+			end = sliceValue.Len()
+		}
+
+		models := make([]reflect.Value, 0, end-start)
+		rows := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*len(fields))
+		for i := start; i < end; i++ {
+			v := sliceValue.Index(i)
+			if v.Kind() == reflect.Ptr {
+				v = v.Elem()
+			}
+			stampScopes(ctx, v, info)
+			models = append(models, v)
+
+			placeholders := make([]string, len(fields))
+			for j, field := range fields {
+				value, err := c.fieldValue(field, v.FieldByName(field.Name))
+				if err != nil {
+					return WrapError(err, "%s %s", op, info.TableName)
+				}
+				args = append(args, value)
+				placeholders[j] = c.dialect.Placeholder(len(args))
+			}
+			rows = append(rows, "("+strings.Join(placeholders, ", ")+")")
+		}
+
+		query := fmt.Sprintf(
+			"INSERT INTO %s (%s) VALUES %s",
+			c.dialect.Quote(info.TableName),
+			strings.Join(columns, ", "),
+			strings.Join(rows, ", "),
+		)
+		if clause != "" {
+			query += " " + clause
+		}
+
+		result, err := c.exec(ctx, query, args...)
+		if err != nil {
+			return WrapError(err, "%s %s", op, info.TableName)
+		}
+		c.invalidateTable(ctx, info.TableName)
+
+		if inserted != nil {
+			inserted(result, models)
+		}
+	}
+
+	return nil
+}
+
+// BatchOps queues writes of models of any type, which Batch runs together in
+// one transaction
+type BatchOps struct {
+	conn *Connection
+	ops  []func(ctx context.Context) error
+}
+
+// Create queues the insert of a model
+func (b *BatchOps) Create(model interface{}) {
+	b.ops = append(b.ops, func(ctx context.Context) error {
+		return b.conn.Create(ctx, model)
+	})
+}
+
+// Update queues the update of a model
+func (b *BatchOps) Update(model interface{}) {
+	b.ops = append(b.ops, func(ctx context.Context) error {
+		return b.conn.Update(ctx, model)
+	})
+}
+
+// Delete queues the deletion of a model
+func (b *BatchOps) Delete(model interface{}) {
+	b.ops = append(b.ops, func(ctx context.Context) error {
+		return b.conn.Delete(ctx, model)
+	})
+}
+
+// Batch calls fn to queue writes and, once it returns, runs them in the order
+// they were queued in one transaction, which is rolled back if any of them
+// fails. Nothing runs if fn returns an error. Models are read when their
+// write runs, so changes fn makes after queueing them are included.
+func (c *Connection) Batch(ctx context.Context, fn func(b *BatchOps) error) error {
+	b := &BatchOps{conn: c}
+	if err := fn(b); err != nil {
+		return err
+	}
+	if len(b.ops) == 0 {
+		return nil
+	}
+
+	return c.WithTransactionContext(ctx, func(ctx context.Context) error {
+		for i, op := range b.ops {
+			if err := op(ctx); err != nil {
+				return WrapError(err, "batch operation %d", i+1)
+			}
+		}
+		return nil
+	})
+}
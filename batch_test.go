@@ -0,0 +1,142 @@
+package sage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentCreatesReceiveTheirOwnID(t *testing.T) {
+	c, db := openTestConnection(t, ConnectionOptions{Driver: "mysql", MaxOpenConns: 4})
+
+	// Each insert reports the id encoded in the name it inserts
+	db.InsertIDFunc("INSERT INTO users", func(args []driver.Value) int64 {
+		id, _ := strconv.ParseInt(strings.TrimPrefix(args[0].(string), "user"), 10, 64)
+		return id
+	})
+
+	users := make([]*testUser, 50)
+	var wg sync.WaitGroup
+	for i := range users {
+		users[i] = &testUser{Name: fmt.Sprintf("user%d", i+1)}
+		wg.Add(1)
+		go func(user *testUser) {
+			defer wg.Done()
+			if err := c.Create(context.Background(), user); err != nil {
+				t.Errorf("Create: %v", err)
+			}
+		}(users[i])
+	}
+	wg.Wait()
+
+	for i, user := range users {
+		if user.ID != int64(i+1) {
+			t.Errorf("%s got id %d, want %d", user.Name, user.ID, i+1)
+		}
+	}
+}
+
+func TestCreateBatchBackfillsIDs(t *testing.T) {
+	tests := []struct {
+		driver string
+		// insertID is the id the database reports for the batch
+		insertID int64
+	}{
+		{"mysql", 10},  // the first inserted row
+		{"sqlite", 12}, // the last inserted row
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			c, db := newTestConnection(t, tt.driver)
+			db.InsertID("INSERT INTO", tt.insertID)
+
+			users := []*testUser{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+			if err := c.CreateBatch(context.Background(), users); err != nil {
+				t.Fatalf("CreateBatch: %v", err)
+			}
+			for i, user := range users {
+				if want := int64(10 + i); user.ID != want {
+					t.Errorf("%s got id %d, want %d", user.Name, user.ID, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBatch(t *testing.T) {
+	c, db := newTestConnection(t, "mysql")
+	db.InsertID("INSERT INTO", 4)
+	ctx := context.Background()
+
+	user := &testUser{Name: "Ann"}
+	nickname, changed := "annie", "ann"
+	profile := &testProfile{ID: 2, Nickname: &nickname}
+	err := c.Batch(ctx, func(b *BatchOps) error {
+		b.Create(user)
+		b.Update(profile)
+		// Models are read when the batch runs
+		profile.Nickname = &changed
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+
+	assertQueries(t, db,
+		"BEGIN",
+		"INSERT INTO users (name, email) VALUES (?, ?)",
+		"UPDATE profiles SET nickname = ? WHERE id = ?",
+		"COMMIT",
+	)
+	statements := db.Statements()
+	for _, statement := range statements {
+		if statement.Conn != statements[0].Conn {
+			t.Errorf("%q ran outside the transaction", statement.Query)
+		}
+	}
+	if got := statements[2].Args[0]; got != "ann" {
+		t.Errorf("updated nickname = %v, want ann", got)
+	}
+	if user.ID != 4 {
+		t.Errorf("user ID = %d, want 4", user.ID)
+	}
+
+	// A failing write rolls back the ones before it
+	db.Reset()
+	failed := errors.New("deadlock")
+	db.FailsOnce("UPDATE profiles", failed)
+	err = c.Batch(ctx, func(b *BatchOps) error {
+		b.Create(&testUser{Name: "Bob"})
+		b.Update(profile)
+		b.Delete(&testUser{ID: 4})
+		return nil
+	})
+	if !errors.Is(err, failed) || !strings.Contains(err.Error(), "batch operation 2") {
+		t.Errorf("Batch = %v, want operation 2 failing with %v", err, failed)
+	}
+	assertQueries(t, db,
+		"BEGIN",
+		"INSERT INTO users (name, email) VALUES (?, ?)",
+		"UPDATE profiles SET nickname = ? WHERE id = ?",
+		"ROLLBACK",
+	)
+
+	// An error from fn runs nothing
+	db.Reset()
+	err = c.Batch(ctx, func(b *BatchOps) error {
+		b.Create(&testUser{Name: "Cid"})
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("Batch = %v, want %v", err, failed)
+	}
+	if queries := db.Queries(); len(queries) != 0 {
+		t.Errorf("ran %q after fn failed", queries)
+	}
+}
@@ -0,0 +1,205 @@
+package sage
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Cache stores query results for read-through caching. Values are stored
+// with a time to live after which Get should no longer return them.
+type Cache interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, value interface{}, ttl time.Duration)
+}
+
+// SetCache enables read-through caching of Find, First and All results using
+// the given cache and time to live. Writes through the Connection invalidate
+// cached results for the written table. Pass a nil cache to disable caching.
+func (c *Connection) SetCache(cache Cache, ttl time.Duration) {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	c.cache = cache
+	c.cacheTTL = ttl
+}
+
+// cacheKey returns the cache key for a query against the table read into a
+// value of type dest, and whether caching is enabled. The key includes the
+// table's generation so that invalidating the table makes earlier entries
+// unreachable. Queries inside a transaction are not cached since they may see
+// uncommitted writes.
+func (c *Connection) cacheKey(ctx context.Context, table string, dest reflect.Type, query string, args []interface{}) (string, bool) {
+	if transactionFromContext(ctx) != nil {
+		return "", false
+	}
+
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	if c.cache == nil {
+		return "", false
+	}
+
+	var key strings.Builder
+	fmt.Fprintf(&key, "%s#%d:%s:%d:%s", table, c.cacheGen[table], dest, len(query), query)
+	for _, arg := range args {
+		writeCacheArg(&key, arg)
+	}
+	return key.String(), true
+}
+
+// writeCacheArg writes an argument to a cache key with its type and length,
+// so that different argument lists never produce the same key
+func writeCacheArg(key *strings.Builder, arg interface{}) {
+	v := reflect.ValueOf(arg)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	value := "nil"
+	if v.IsValid() {
+		value = fmt.Sprintf("%#v", v.Interface())
+	}
+	fmt.Fprintf(key, ":%T:%d:%s", arg, len(value), value)
+}
+
+// cacheGet looks up a cached result
+func (c *Connection) cacheGet(key string) (interface{}, bool) {
+	c.cacheMu.Lock()
+	cache := c.cache
+	c.cacheMu.Unlock()
+
+	if cache == nil {
+		return nil, false
+	}
+	return cache.Get(key)
+}
+
+// cacheSet stores a result in the cache
+func (c *Connection) cacheSet(key string, value interface{}) {
+	c.cacheMu.Lock()
+	cache, ttl := c.cache, c.cacheTTL
+	c.cacheMu.Unlock()
+
+	if cache != nil {
+		cache.Set(key, value, ttl)
+	}
+}
+
+// invalidateTable discards cached results for the table. A write inside a
+// transaction is invalidated again when the transaction commits, since reads
+// outside it may cache the old rows until then.
+func (c *Connection) invalidateTable(ctx context.Context, table string) {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	if c.cache == nil {
+		return
+	}
+
+	if c.cacheGen == nil {
+		c.cacheGen = make(map[string]uint64)
+	}
+	c.cacheGen[table]++
+
+	if tx := transactionFromContext(ctx); tx != nil {
+		tx.onCommit(fmt.Sprintf("invalidate %p %s", c, table), func() {
+			c.invalidateTable(context.Background(), table)
+		})
+	}
+}
+
+// cachedScanRow scans a single row into the model, consulting the cache first
+func (c *Connection) cachedScanRow(ctx context.Context, info *ModelInfo, model interface{}, query string, args []interface{}) error {
+	v := reflect.ValueOf(model)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return c.scanRow(ctx, model, query, args...)
+	}
+
+	key, cacheable := c.cacheKey(ctx, info.TableName, v.Elem().Type(), query, args)
+	if cacheable {
+		// A value of another type is a colliding entry; query instead
+		if cached, ok := c.cacheGet(key); ok && reflect.TypeOf(cached) == v.Elem().Type() {
+			v.Elem().Set(copyModels(reflect.ValueOf(cached)))
+			return nil
+		}
+	}
+
+	if err := c.scanRow(ctx, model, query, args...); err != nil {
+		return err
+	}
+
+	if cacheable {
+		c.cacheSet(key, copyModels(v.Elem()).Interface())
+	}
+	return nil
+}
+
+// copyModels deep copies a model or slice of models so the cache and callers
+// never share them: pointers, slices and maps are copied along with the values
+// they hold. Unexported fields, functions and channels are shared.
+func copyModels(models reflect.Value) reflect.Value {
+	return deepCopy(models, make(map[uintptr]reflect.Value))
+}
+
+// deepCopy copies v, using copied to preserve pointers that appear more than
+// once, including in cycles
+func deepCopy(v reflect.Value, copied map[uintptr]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		if p, ok := copied[v.Pointer()]; ok && p.Type() == v.Type() {
+			return p
+		}
+		p := reflect.New(v.Type().Elem())
+		copied[v.Pointer()] = p
+		p.Elem().Set(deepCopy(v.Elem(), copied))
+		return p
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		i := reflect.New(v.Type()).Elem()
+		i.Set(deepCopy(v.Elem(), copied))
+		return i
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			s.Index(i).Set(deepCopy(v.Index(i), copied))
+		}
+		return s
+	case reflect.Array:
+		a := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			a.Index(i).Set(deepCopy(v.Index(i), copied))
+		}
+		return a
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		m := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m.SetMapIndex(iter.Key(), deepCopy(iter.Value(), copied))
+		}
+		return m
+	case reflect.Struct:
+		st := reflect.New(v.Type()).Elem()
+		st.Set(v)
+		for i := 0; i < st.NumField(); i++ {
+			if field := st.Field(i); field.CanSet() {
+				field.Set(deepCopy(v.Field(i), copied))
+			}
+		}
+		return st
+	}
+	return v
+}
@@ -0,0 +1,172 @@
+package sage
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countSelects counts the SELECT statements received by the fake database
+func countSelects(queries []string) int {
+	n := 0
+	for _, query := range queries {
+		if strings.HasPrefix(query, "SELECT") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestCacheHitAndInvalidation(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	c.SetCache(&mapCache{}, time.Minute)
+	ctx := context.Background()
+	db.Returns("FROM users", []string{"id", "name", "email"}, []driver.Value{int64(1), "Ann", "ann@example.com"})
+
+	for i := 0; i < 2; i++ {
+		var users []testUser
+		if err := c.All(ctx, &users, "name = ?", "Ann"); err != nil {
+			t.Fatalf("All: %v", err)
+		}
+		if len(users) != 1 || users[0].Name != "Ann" {
+			t.Fatalf("All = %+v, want Ann", users)
+		}
+
+		var user testUser
+		if err := c.Find(ctx, &user, 1); err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+	}
+	if n := countSelects(db.Queries()); n != 2 {
+		t.Errorf("ran %d selects for repeated reads, want 2", n)
+	}
+
+	// A write to the table invalidates its cached results
+	db.Reset()
+	if err := c.Update(ctx, &testUser{ID: 1, Name: "Ann", Email: "ann@example.org"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	var users []testUser
+	if err := c.All(ctx, &users, "name = ?", "Ann"); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	if n := countSelects(db.Queries()); n != 1 {
+		t.Errorf("ran %d selects after a write, want 1", n)
+	}
+}
+
+func TestCacheInvalidatedOnCommit(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	c.SetCache(&mapCache{}, time.Minute)
+	ctx := context.Background()
+	db.Returns("FROM users", []string{"id", "name", "email"}, []driver.Value{int64(1), "Ann", "ann@example.com"})
+
+	read := func() {
+		var users []testUser
+		if err := c.All(ctx, &users, nil); err != nil {
+			t.Fatalf("All: %v", err)
+		}
+	}
+
+	tx, err := c.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx: %v", err)
+	}
+	if err := c.Update(tx.Context(), &testUser{ID: 1, Name: "Bob"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	// A read outside the transaction caches the rows from before the write
+	read()
+	read()
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	// The commit discards them
+	db.Reset()
+	read()
+	if n := countSelects(db.Queries()); n != 1 {
+		t.Errorf("ran %d selects after the commit, want 1", n)
+	}
+}
+
+// userName reads only the name of users
+type userName struct {
+	ID   int64  `db:"id,pk,auto"`
+	Name string `db:"name"`
+}
+
+func (userName) TableName() string  { return "users" }
+func (userName) PrimaryKey() string { return "id" }
+
+func TestCacheKeyedByDestination(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	c.SetCache(&mapCache{}, time.Minute)
+	ctx := context.Background()
+	db.Returns("FROM users", []string{"id", "name", "email"}, []driver.Value{int64(1), "Ann", "ann@example.com"})
+
+	// The same query read into different types is cached for each
+	var user testUser
+	if err := c.Find(ctx, &user, 1); err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	var name userName
+	if err := c.Find(ctx, &name, 1); err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if name.Name != "Ann" {
+		t.Errorf("Find = %+v, want Ann", name)
+	}
+
+	var users []testUser
+	if err := c.All(ctx, &users, nil); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	var pointers []*testUser
+	if err := c.All(ctx, &pointers, nil); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	if len(pointers) != 1 || pointers[0].Name != "Ann" {
+		t.Errorf("All = %+v, want Ann", pointers)
+	}
+	if n := countSelects(db.Queries()); n != 4 {
+		t.Errorf("ran %d selects, want 4", n)
+	}
+
+	// Arguments whose text runs together are kept apart
+	db.Reset()
+	for _, args := range [][]interface{}{{"a b", "c"}, {"a", "b c"}} {
+		if err := c.All(ctx, &users, "name = ? AND email = ?", args...); err != nil {
+			t.Fatalf("All: %v", err)
+		}
+	}
+	if n := countSelects(db.Queries()); n != 2 {
+		t.Errorf("ran %d selects for different arguments, want 2", n)
+	}
+}
+
+func TestCacheIsNotSharedWithCallers(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	c.SetCache(&mapCache{}, time.Minute)
+	ctx := context.Background()
+	db.Returns("FROM attachments", []string{"id", "data", "caption"}, []driver.Value{int64(1), []byte("abc"), "logo"})
+
+	for i := 0; i < 3; i++ {
+		var attachment testAttachment
+		if err := c.Find(ctx, &attachment, 1); err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		if string(attachment.Data) != "abc" || attachment.Caption == nil || *attachment.Caption != "logo" {
+			t.Fatalf("read %d = %q, %v, want the cached row unchanged", i, attachment.Data, attachment.Caption)
+		}
+		// Changing what a read returned leaves the cache alone
+		attachment.Data[0] = 'x'
+		*attachment.Caption = "changed"
+	}
+	if n := countSelects(db.Queries()); n != 1 {
+		t.Errorf("ran %d selects, want 1", n)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/IMPHNEN/sage"
+	"github.com/IMPHNEN/sage/internal/dialect"
 	"github.com/IMPHNEN/sage/internal/schema"
 )
 
@@ -21,6 +22,7 @@ func main() {
 		command = flag.String("command", "", "Command to execute (migrate, rollback, create, drop)")
 		name    = flag.String("name", "", "Migration name (for create)")
 		steps   = flag.Int("steps", 1, "Number of migrations to roll back")
+		preview = flag.Bool("preview", false, "Print the down SQL of a rollback without running it")
 		version = flag.Bool("version", false, "Print version information")
 	)
 
@@ -63,6 +65,7 @@ func main() {
 
 	// Create migration manager
 	migrationManager := schema.NewMigrationManager(conn.DB(), "migrations")
+	migrationManager.SetLock(dialect.GetDialect(*driver), "")
 
 	// Create context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -86,6 +89,17 @@ func main() {
 			log.Fatal("Steps must be greater than 0")
 		}
 
+		if *preview {
+			statements, err := migrationManager.PreviewDown(ctx, *steps)
+			if err != nil {
+				log.Fatalf("Failed to preview rollback: %v", err)
+			}
+			for _, statement := range statements {
+				fmt.Println(statement)
+			}
+			break
+		}
+
 		for i := 0; i < *steps; i++ {
 			if err := migrationManager.MigrateDown(ctx); err != nil {
 				log.Fatalf("Failed to rollback: %v", err)
@@ -0,0 +1,51 @@
+package sage
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Conditions matches rows whose columns equal the given values, e.g.
+// Conditions{"status": "active", "role": "admin"}. A nil value matches NULL.
+// It can be passed instead of a condition string to First, All and Count.
+type Conditions map[string]interface{}
+
+// where adds the conditions to the query builder. conditions is either a SQL
+// condition string with ? placeholders for args, or Conditions whose columns
+// must belong to the model.
+func (c *Connection) where(qb *QueryBuilder, info *ModelInfo, conditions interface{}, args []interface{}) error {
+	switch conds := conditions.(type) {
+	case nil:
+	case string:
+		if conds != "" {
+			qb.Where(conds, args...)
+		}
+	case Conditions:
+		if len(args) > 0 {
+			return fmt.Errorf("%w: arguments cannot be combined with Conditions", ErrInvalidArgument)
+		}
+
+		// Sort the columns so the generated SQL is stable
+		columns := make([]string, 0, len(conds))
+		for column := range conds {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+
+		if _, err := columnSet(info, columns); err != nil {
+			return err
+		}
+
+		for _, column := range columns {
+			if conds[column] == nil {
+				qb.Where(c.dialect.Quote(column) + " IS NULL")
+			} else {
+				field, _ := fieldByColumn(info, column)
+				qb.Where(c.dialect.Quote(column)+" = ?", field.encodeBool(conds[column]))
+			}
+		}
+	default:
+		return fmt.Errorf("%w: conditions must be a string or Conditions, got %T", ErrInvalidArgument, conditions)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package sage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestConditions(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	ctx := context.Background()
+
+	// Map iteration order varies between runs, the SQL does not
+	for i := 0; i < 10; i++ {
+		var users []testUser
+		if err := c.All(ctx, &users, Conditions{"name": "Ann", "email": "ann@example.com", "id": 3}); err != nil {
+			t.Fatalf("All: %v", err)
+		}
+	}
+
+	statements := db.Statements()
+	want := `SELECT * FROM users WHERE ("email" = $1) AND ("id" = $2) AND ("name" = $3)`
+	for _, statement := range statements {
+		if statement.Query != want {
+			t.Fatalf("query = %q, want %q", statement.Query, want)
+		}
+		if !reflect.DeepEqual(statement.Args, []driver.Value{"ann@example.com", int64(3), "Ann"}) {
+			t.Fatalf("args = %v, want them in column order", statement.Args)
+		}
+	}
+
+	db.Reset()
+	var user testUser
+	if err := c.First(ctx, &user, Conditions{"email": nil}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("First = %v, want ErrNotFound", err)
+	}
+	if queries := db.Queries(); len(queries) != 1 || queries[0] != `SELECT * FROM users WHERE "email" IS NULL LIMIT 1` {
+		t.Errorf("queries = %q, want an IS NULL condition", queries)
+	}
+
+	var users []testUser
+	if err := c.All(ctx, &users, Conditions{"password": "secret"}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("All with an unknown column = %v, want ErrInvalidArgument", err)
+	}
+	if err := c.All(ctx, &users, Conditions{"name": "Ann"}, 1); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("All with Conditions and arguments = %v, want ErrInvalidArgument", err)
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"database/sql"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/IMPHNEN/sage/internal/dialect"
 )
 
 // ConnectionOptions defines options for database connections
@@ -16,17 +19,107 @@ type ConnectionOptions struct {
 	MaxIdleConns    int
 	ConnMaxLifetime time.Duration
 	ConnMaxIdleTime time.Duration
+
+	// Logger receives every executed query, if set
+	Logger Logger
+	// SlowThreshold logs queries taking at least this long at LogLevelSlow
+	SlowThreshold time.Duration
+
+	// DisableQuoting generates SQL with unquoted identifiers
+	DisableQuoting bool
+
+	// LowercaseIdentifiers lowercases the table and column names of generated
+	// SQL, so that quoted names match the ones PostgreSQL folds unquoted
+	// names to
+	LowercaseIdentifiers bool
+
+	// ReadOnly starts the connection in read-only mode, see SetReadOnly
+	ReadOnly bool
+
+	// DisableWindowFunctions preloads HasMany relationships with a
+	// PerParentLimit with one query per parent instead of ROW_NUMBER(), for
+	// MySQL before 8.0 and SQLite before 3.25
+	DisableWindowFunctions bool
+
+	// SkipStateTransitions updates StateMachine models without loading the
+	// stored row to validate the status transition
+	SkipStateTransitions bool
+
+	// MaxPreload caps the HasMany and ManyToMany models preloaded for each
+	// parent, unlimited when zero. Further models are silently dropped
+	// unless StrictMaxPreload is set.
+	MaxPreload int
+
+	// StrictMaxPreload fails preloads exceeding MaxPreload with
+	// ErrPreloadLimit instead of truncating them
+	StrictMaxPreload bool
+
+	// TablePrefix returns the prefix of the table names of models used with
+	// a context, e.g. "tenant_a_" for the tenant the context belongs to, so
+	// that tenants with their own tables share models. Join tables of
+	// ManyToMany relationships are used as named.
+	TablePrefix func(ctx context.Context) string
+
+	// TempTableThreshold makes FindAll load id lists longer than this into a
+	// temporary table and select the records matching it, instead of
+	// passing every id as a parameter. Disabled when zero.
+	TempTableThreshold int
+
+	// Interceptors rewrite every statement before it is executed, in order
+	Interceptors []QueryInterceptor
 }
 
 // Connection represents a database connection
 type Connection struct {
 	db      *sql.DB
+	dialect dialect.Dialect
 	options ConnectionOptions
 	mu      sync.RWMutex
+
+	// readOnly rejects writes with ErrReadOnlyMode, see SetReadOnly
+	readOnly atomic.Bool
+
+	// Read-through result cache, see SetCache
+	cache    Cache
+	cacheTTL time.Duration
+	cacheGen map[string]uint64
+	cacheMu  sync.Mutex
+
+	// recorder collects statements on dry-run connections, see DryRun
+	recorder *queryRecorder
+
+	// transformers by name, see RegisterTransformer
+	transformers map[string]Transformer
 }
 
 // NewConnection creates a new database connection with the given options
 func NewConnection(opts ConnectionOptions) (*Connection, error) {
+	d := dialect.NewDialect(opts.Driver, dialect.Options{
+		DisableQuoting:       opts.DisableQuoting,
+		LowercaseIdentifiers: opts.LowercaseIdentifiers,
+	})
+	if d == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedDriver, opts.Driver)
+	}
+
+	db, err := openDB(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Connection{
+		db:      db,
+		dialect: d,
+		options: opts,
+	}
+	c.readOnly.Store(opts.ReadOnly)
+
+	return c, nil
+}
+
+// openDB opens and configures the connection pool described by opts and
+// verifies that the database is reachable
+func openDB(opts ConnectionOptions) (*sql.DB, error) {
 	db, err := sql.Open(opts.Driver, opts.DSN)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
@@ -55,10 +148,39 @@ func NewConnection(opts ConnectionOptions) (*Connection, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &Connection{
-		db:      db,
-		options: opts,
-	}, nil
+	return db, nil
+}
+
+// Reconnect replaces the connection pool with a new one opened with opts, e.g.
+// after credentials rotate or the database moves. The new pool is pinged
+// before it is swapped in, so on error the connection keeps using the old
+// one. The old pool is closed after in-flight queries finish. The driver
+// cannot change as the connection's dialect is kept; logging, interceptors
+// and the other behavioural options are kept as well.
+func (c *Connection) Reconnect(opts ConnectionOptions) error {
+	if c.recorder != nil {
+		return fmt.Errorf("%w: cannot reconnect a dry-run connection", ErrInvalidArgument)
+	}
+	if opts.Driver == "" {
+		opts.Driver = c.options.Driver
+	}
+	if opts.Driver != c.options.Driver {
+		return fmt.Errorf("%w: cannot reconnect from %s to %s", ErrInvalidArgument, c.options.Driver, opts.Driver)
+	}
+
+	db, err := openDB(opts)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	old := c.db
+	c.db = db
+	c.mu.Unlock()
+
+	// Close waits for queries already running on the old pool, so do it
+	// without holding the lock
+	return old.Close()
 }
 
 // DB returns the underlying sql.DB instance
@@ -82,13 +204,48 @@ func (c *Connection) Ping(ctx context.Context) error {
 	return c.db.PingContext(ctx)
 }
 
-// BeginTx starts a new transaction
+// SetReadOnly enables or disables read-only mode. In read-only mode every
+// statement that goes through exec, including creates, updates, deletes and
+// raw Exec calls, fails with ErrReadOnlyMode while queries keep working.
+func (c *Connection) SetReadOnly(readOnly bool) {
+	c.readOnly.Store(readOnly)
+}
+
+// IsReadOnly reports whether the connection is in read-only mode
+func (c *Connection) IsReadOnly() bool {
+	return c.readOnly.Load()
+}
+
+// Exec executes a raw statement. Unlike DB().ExecContext the statement is
+// logged like the ones generated by the ORM, and its ? placeholders are
+// rewritten for the connection's dialect. Raw statements do not invalidate
+// cached results.
+func (c *Connection) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.exec(ctx, query, args...)
+}
+
+// QueryRaw executes a raw query that returns rows. Unlike DB().QueryContext
+// the query is logged like the ones generated by the ORM, and its ?
+// placeholders are rewritten for the connection's dialect.
+func (c *Connection) QueryRaw(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.query(ctx, query, args...)
+}
+
+// BeginTx starts a new transaction. Operations run with the transaction's
+// Context execute inside it.
 func (c *Connection) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Transaction, error) {
+	// Don't start a transaction that could not complete
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	tx, err := c.db.BeginTx(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
-	return &Transaction{tx: tx}, nil
+	t := &Transaction{tx: tx, dialect: c.dialect}
+	t.ctx = ContextWithTransaction(ctx, t)
+	return t, nil
 }
@@ -0,0 +1,194 @@
+package sage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/IMPHNEN/sage/internal/testdb"
+)
+
+func TestDisableQuoting(t *testing.T) {
+	for _, name := range []string{"postgres", "mysql", "sqlite"} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			quoted, quotedDB := newTestConnection(t, name)
+			unquoted, unquotedDB := openTestConnection(t, ConnectionOptions{Driver: name, DisableQuoting: true})
+			quotedDB.Returns("COUNT(", []string{"count"}, []driver.Value{int64(1)})
+			unquotedDB.Returns("COUNT(", []string{"count"}, []driver.Value{int64(1)})
+
+			for _, c := range []*Connection{quoted, unquoted} {
+				if _, err := c.CountDistinct(ctx, &testUser{}, "email", nil); err != nil {
+					t.Fatalf("CountDistinct: %v", err)
+				}
+				if err := c.Associate(ctx, &testPost{ID: 1}, "Tags", &testTag{ID: 2}, postTags); err != nil {
+					t.Fatalf("Associate: %v", err)
+				}
+			}
+
+			for _, query := range quotedDB.Queries() {
+				if !strings.ContainsAny(query, "\"`") {
+					t.Errorf("default query %q has no quoted identifiers", query)
+				}
+			}
+			for _, query := range unquotedDB.Queries() {
+				if strings.ContainsAny(query, "\"`") {
+					t.Errorf("query %q has quoted identifiers", query)
+				}
+			}
+			if queries := unquotedDB.Queries(); !strings.Contains(queries[0], "COUNT(DISTINCT email)") {
+				t.Errorf("query %q lacks the unquoted column", queries[0])
+			}
+		})
+	}
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	c, db := openTestConnection(t, ConnectionOptions{Driver: "postgres", ReadOnly: true})
+	ctx := context.Background()
+
+	if !c.IsReadOnly() {
+		t.Fatal("IsReadOnly = false for a read-only connection")
+	}
+
+	writes := map[string]func() error{
+		"Create": func() error { return c.Create(ctx, &testUser{Name: "Ann"}) },
+		"Update": func() error { return c.Update(ctx, &testUser{ID: 1, Name: "Ann"}) },
+		"Delete": func() error { return c.Delete(ctx, &testUser{ID: 1}) },
+		"Exec": func() error {
+			_, err := c.Exec(ctx, "DELETE FROM users")
+			return err
+		},
+	}
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, ErrReadOnlyMode) {
+			t.Errorf("%s = %v, want ErrReadOnlyMode", name, err)
+		}
+	}
+	if queries := db.Queries(); len(queries) != 0 {
+		t.Errorf("read-only connection ran %q", queries)
+	}
+
+	var users []testUser
+	if err := c.All(ctx, &users, nil); err != nil {
+		t.Errorf("All on a read-only connection: %v", err)
+	}
+
+	c.SetReadOnly(false)
+	if err := c.Create(ctx, &testUser{Name: "Ann"}); err != nil {
+		t.Errorf("Create after leaving read-only mode: %v", err)
+	}
+}
+
+func TestConnectionsKeepTheirDialects(t *testing.T) {
+	postgres, pgDB := newTestConnection(t, "postgres")
+	sqlite, sqliteDB := newTestConnection(t, "sqlite")
+	mysql, mysqlDB := newTestConnection(t, "mysql")
+	ctx := context.Background()
+
+	// Interleave the connections so that no state leaks between them
+	for i := 0; i < 2; i++ {
+		for _, c := range []*Connection{postgres, sqlite, mysql} {
+			if _, err := c.UpdateMap(ctx, &testUser{}, map[string]interface{}{"name": "Ann"}, "id = ? AND email = ?", 1, "a@example.com"); err != nil {
+				t.Fatalf("UpdateMap: %v", err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name  string
+		db    *testdb.DB
+		query string
+	}{
+		{"postgres", pgDB, "UPDATE users SET name = $1 WHERE id = $2 AND email = $3"},
+		{"sqlite", sqliteDB, "UPDATE users SET name = ? WHERE id = ? AND email = ?"},
+		{"mysql", mysqlDB, "UPDATE users SET name = ? WHERE id = ? AND email = ?"},
+	}
+	for _, tt := range tests {
+		if got := len(tt.db.Queries()); got != 2 {
+			t.Errorf("%s ran %d statements, want 2", tt.name, got)
+		}
+		for _, query := range tt.db.Queries() {
+			if query != tt.query {
+				t.Errorf("%s ran %q, want %q", tt.name, query, tt.query)
+			}
+		}
+	}
+	if postgres.dialect == sqlite.dialect {
+		t.Error("connections share a dialect")
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	c, first := newTestConnection(t, "sqlite")
+	second := testdb.New()
+	second.Returns("COUNT(", []string{"count"}, []driver.Value{int64(7)})
+	ctx := context.Background()
+
+	old := c.DB()
+	if err := c.Reconnect(ConnectionOptions{DSN: second.DSN()}); err != nil {
+		t.Fatalf("Reconnect: %v", err)
+	}
+
+	count, err := c.Count(ctx, &testUser{}, nil)
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count != 7 {
+		t.Errorf("Count = %d, want 7 from the new database", count)
+	}
+	if queries := first.Queries(); len(queries) != 0 {
+		t.Errorf("old database received %q", queries)
+	}
+	if err := old.PingContext(ctx); err == nil {
+		t.Error("old pool is still open")
+	}
+
+	// A database that cannot be reached leaves the connection as it was
+	if err := c.Reconnect(ConnectionOptions{DSN: "missing"}); err == nil {
+		t.Error("Reconnect to a missing database succeeded")
+	}
+	if err := c.Reconnect(ConnectionOptions{Driver: "postgres", DSN: first.DSN()}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Reconnect with another driver = %v, want ErrInvalidArgument", err)
+	}
+	if count, err := c.Count(ctx, &testUser{}, nil); err != nil || count != 7 {
+		t.Errorf("Count after failed reconnects = %d, %v, want 7", count, err)
+	}
+}
+
+// testLedger has mixed-case names
+type testLedger struct {
+	ID      int64  `db:"ID,pk,auto"`
+	Account string `db:"AccountName"`
+}
+
+func (testLedger) TableName() string  { return "Ledgers" }
+func (testLedger) PrimaryKey() string { return "ID" }
+
+func TestLowercaseIdentifiers(t *testing.T) {
+	ctx := context.Background()
+	for _, lowercase := range []bool{false, true} {
+		c, db := openTestConnection(t, ConnectionOptions{Driver: "postgres", LowercaseIdentifiers: lowercase})
+
+		var ledgers []testLedger
+		if err := c.All(ctx, &ledgers, Conditions{"AccountName": "cash"}); err != nil {
+			t.Fatalf("All: %v", err)
+		}
+		term, err := c.OrderByColumn(&testLedger{}, "AccountName", "asc")
+		if err != nil {
+			t.Fatalf("OrderByColumn: %v", err)
+		}
+
+		want, wantTerm := `SELECT * FROM Ledgers WHERE "AccountName" = $1`, `"AccountName" ASC`
+		if lowercase {
+			want, wantTerm = `SELECT * FROM Ledgers WHERE "accountname" = $1`, `"accountname" ASC`
+		}
+		assertQueries(t, db, want)
+		if term != wantTerm {
+			t.Errorf("OrderByColumn = %q, want %q", term, wantTerm)
+		}
+	}
+}
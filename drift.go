@@ -0,0 +1,160 @@
+package sage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/IMPHNEN/sage/internal/schema"
+)
+
+// SchemaDrift describes how the live database schema differs from the models
+type SchemaDrift struct {
+	// Fingerprint is the fingerprint of the schema expected by the models
+	Fingerprint string
+	// Tables lists the tables that differ, in model order
+	Tables []TableDrift
+}
+
+// TableDrift describes how a live table differs from its model
+type TableDrift struct {
+	Table string
+	// Missing is set when the table does not exist
+	Missing bool
+	// MissingColumns are model columns the table lacks
+	MissingColumns []string
+	// ExtraColumns are table columns no model field maps to
+	ExtraColumns []string
+}
+
+// HasDrift checks if the live schema differs from the models
+func (d *SchemaDrift) HasDrift() bool {
+	return len(d.Tables) > 0
+}
+
+// String returns a readable summary of the drift
+func (d *SchemaDrift) String() string {
+	if !d.HasDrift() {
+		return "no schema drift"
+	}
+
+	var lines []string
+	for _, table := range d.Tables {
+		if table.Missing {
+			lines = append(lines, fmt.Sprintf("table %s: missing", table.Table))
+			continue
+		}
+		if len(table.MissingColumns) > 0 {
+			lines = append(lines, fmt.Sprintf("table %s: missing columns %s", table.Table, strings.Join(table.MissingColumns, ", ")))
+		}
+		if len(table.ExtraColumns) > 0 {
+			lines = append(lines, fmt.Sprintf("table %s: extra columns %s", table.Table, strings.Join(table.ExtraColumns, ", ")))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SchemaFingerprint returns a stable hash of the tables, columns and
+// constraints defined by the models, which changes whenever a model's schema
+// does
+func SchemaFingerprint(models ...interface{}) (string, error) {
+	// Without a connection there is no table prefix to apply
+	s, err := new(Connection).buildSchema(context.Background(), models)
+	if err != nil {
+		return "", err
+	}
+	return s.Fingerprint(), nil
+}
+
+// CheckSchema compares the tables of the models with the live database and
+// reports missing tables and missing or extra columns. Run it at startup to
+// catch forgotten migrations before queries fail.
+func (c *Connection) CheckSchema(ctx context.Context, models ...interface{}) (*SchemaDrift, error) {
+	s, err := c.buildSchema(ctx, models)
+	if err != nil {
+		return nil, err
+	}
+
+	drift := &SchemaDrift{Fingerprint: s.Fingerprint()}
+	for _, table := range s.Tables {
+		tableDrift, err := c.checkTable(ctx, table)
+		if err != nil {
+			return nil, err
+		}
+		if tableDrift != nil {
+			drift.Tables = append(drift.Tables, *tableDrift)
+		}
+	}
+
+	return drift, nil
+}
+
+// checkTable compares a table with the live database, returning nil when
+// they match
+func (c *Connection) checkTable(ctx context.Context, table *schema.Table) (*TableDrift, error) {
+	exists, err := c.TableExists(ctx, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return &TableDrift{Table: table.Name, Missing: true}, nil
+	}
+
+	// Read the live columns from an empty result set, which works alike on
+	// every database
+	query := fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", c.dialect.Quote(table.Name))
+	rows, err := c.query(ctx, query)
+	if err != nil {
+		return nil, WrapError(err, "check schema %s", table.Name)
+	}
+	columns, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		return nil, WrapError(err, "check schema %s", table.Name)
+	}
+
+	// Unquoted identifiers may be folded to either case by the database
+	live := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		live[strings.ToLower(column)] = true
+	}
+
+	tableDrift := TableDrift{Table: table.Name}
+	expected := make(map[string]bool, len(table.Columns))
+	for _, column := range table.Columns {
+		name := strings.ToLower(column.Name)
+		expected[name] = true
+		if !live[name] {
+			tableDrift.MissingColumns = append(tableDrift.MissingColumns, column.Name)
+		}
+	}
+	for _, column := range columns {
+		if !expected[strings.ToLower(column)] {
+			tableDrift.ExtraColumns = append(tableDrift.ExtraColumns, column)
+		}
+	}
+
+	if len(tableDrift.MissingColumns) == 0 && len(tableDrift.ExtraColumns) == 0 {
+		return nil, nil
+	}
+	return &tableDrift, nil
+}
+
+// buildSchema builds the schema of the models' tables as named for the
+// context
+func (c *Connection) buildSchema(ctx context.Context, models []interface{}) (*schema.Schema, error) {
+	s := schema.NewSchema()
+	for _, model := range models {
+		info, err := c.modelInfo(ctx, model)
+		if err != nil {
+			return nil, err
+		}
+
+		table, err := schema.BuildFromStruct(model, info.TableName)
+		if err != nil {
+			return nil, err
+		}
+		s.AddTable(table)
+	}
+	return s, nil
+}
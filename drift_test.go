@@ -0,0 +1,72 @@
+package sage
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+)
+
+// testUserWithPhone is testUser after a phone field was added
+type testUserWithPhone struct {
+	ID    int64  `db:"id,pk,auto"`
+	Name  string `db:"name"`
+	Email string `db:"email"`
+	Phone string `db:"phone"`
+}
+
+func (testUserWithPhone) TableName() string  { return "users" }
+func (testUserWithPhone) PrimaryKey() string { return "id" }
+
+func TestCheckSchema(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	db.Returns("SELECT EXISTS", []string{"exists"}, []driver.Value{false})
+	db.Returns("'users'", []string{"exists"}, []driver.Value{true})
+	db.Returns(`SELECT * FROM "users" WHERE 1 = 0`, []string{"id", "name", "email"})
+	ctx := context.Background()
+
+	drift, err := c.CheckSchema(ctx, &testUser{})
+	if err != nil {
+		t.Fatalf("CheckSchema: %v", err)
+	}
+	if drift.HasDrift() {
+		t.Errorf("CheckSchema of the live model reports %s", drift)
+	}
+
+	drift, err = c.CheckSchema(ctx, &testUserWithPhone{}, &testTag{})
+	if err != nil {
+		t.Fatalf("CheckSchema: %v", err)
+	}
+	want := []TableDrift{
+		{Table: "users", MissingColumns: []string{"phone"}},
+		{Table: "tags", Missing: true},
+	}
+	if !reflect.DeepEqual(drift.Tables, want) {
+		t.Errorf("drift = %+v, want %+v", drift.Tables, want)
+	}
+	if got, want := drift.String(), "table users: missing columns phone\ntable tags: missing"; got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+}
+
+func TestSchemaFingerprint(t *testing.T) {
+	before, err := SchemaFingerprint(&testUser{}, &testTag{})
+	if err != nil {
+		t.Fatalf("SchemaFingerprint: %v", err)
+	}
+	reordered, err := SchemaFingerprint(&testTag{}, &testUser{})
+	if err != nil {
+		t.Fatalf("SchemaFingerprint: %v", err)
+	}
+	after, err := SchemaFingerprint(&testUserWithPhone{}, &testTag{})
+	if err != nil {
+		t.Fatalf("SchemaFingerprint: %v", err)
+	}
+
+	if before != reordered {
+		t.Error("the fingerprint depends on the model order")
+	}
+	if before == after {
+		t.Error("adding a field does not change the fingerprint")
+	}
+}
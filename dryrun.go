@@ -0,0 +1,122 @@
+package sage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+)
+
+// RecordedQuery is a statement recorded by a dry-run connection
+type RecordedQuery struct {
+	Query string
+	Args  []interface{}
+}
+
+// queryRecorder collects the statements of a dry-run connection
+type queryRecorder struct {
+	mu      sync.Mutex
+	queries []RecordedQuery
+}
+
+// DryRun returns a connection with the same dialect, options and transformers
+// as c that records every statement instead of executing it. Statements affect
+// no rows and queries return no rows, so lookups fail with ErrNotFound. Use
+// RecordedQueries to read the recorded statements.
+func (c *Connection) DryRun() *Connection {
+	c.mu.RLock()
+	transformers := make(map[string]Transformer, len(c.transformers))
+	for name, t := range c.transformers {
+		transformers[name] = t
+	}
+	c.mu.RUnlock()
+
+	return &Connection{
+		db:           sql.OpenDB(dryRunConnector{}),
+		dialect:      c.dialect,
+		options:      c.options,
+		recorder:     &queryRecorder{},
+		transformers: transformers,
+	}
+}
+
+// RecordedQueries returns the statements recorded by a dry-run connection, in
+// execution order, or nil for a regular connection
+func (c *Connection) RecordedQueries() []RecordedQuery {
+	if c.recorder == nil {
+		return nil
+	}
+
+	c.recorder.mu.Lock()
+	defer c.recorder.mu.Unlock()
+	return append([]RecordedQuery(nil), c.recorder.queries...)
+}
+
+// record appends a statement to the recorded queries of a dry-run connection
+func (c *Connection) record(query string, args []interface{}) {
+	if c.recorder == nil {
+		return
+	}
+
+	c.recorder.mu.Lock()
+	defer c.recorder.mu.Unlock()
+	c.recorder.queries = append(c.recorder.queries, RecordedQuery{
+		Query: query,
+		Args:  append([]interface{}(nil), args...),
+	})
+}
+
+// dryRunConnector opens connections that execute nothing
+type dryRunConnector struct{}
+
+func (dryRunConnector) Connect(context.Context) (driver.Conn, error) { return dryRunConn{}, nil }
+func (dryRunConnector) Driver() driver.Driver                        { return dryRunDriver{} }
+
+// dryRunDriver is the driver of dry-run connections
+type dryRunDriver struct{}
+
+func (dryRunDriver) Open(string) (driver.Conn, error) { return dryRunConn{}, nil }
+
+// dryRunConn accepts every statement and argument and returns empty result
+// sets
+type dryRunConn struct{}
+
+func (dryRunConn) Prepare(string) (driver.Stmt, error)      { return dryRunStmt{}, nil }
+func (dryRunConn) Close() error                             { return nil }
+func (dryRunConn) Begin() (driver.Tx, error)                { return dryRunTx{}, nil }
+func (dryRunConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+func (dryRunConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return dryRunResult{}, nil
+}
+func (dryRunConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return dryRunRows{}, nil
+}
+
+// dryRunStmt is a prepared statement that executes nothing
+type dryRunStmt struct{}
+
+func (dryRunStmt) Close() error                               { return nil }
+func (dryRunStmt) NumInput() int                              { return -1 }
+func (dryRunStmt) Exec([]driver.Value) (driver.Result, error) { return dryRunResult{}, nil }
+func (dryRunStmt) Query([]driver.Value) (driver.Rows, error)  { return dryRunRows{}, nil }
+
+// dryRunResult reports one affected row, so that updates and deletes of a
+// record succeed as they would against the database
+type dryRunResult struct{}
+
+func (dryRunResult) LastInsertId() (int64, error) { return 0, nil }
+func (dryRunResult) RowsAffected() (int64, error) { return 1, nil }
+
+// dryRunTx is a transaction that commits and rolls back nothing
+type dryRunTx struct{}
+
+func (dryRunTx) Commit() error   { return nil }
+func (dryRunTx) Rollback() error { return nil }
+
+// dryRunRows is an empty result set
+type dryRunRows struct{}
+
+func (dryRunRows) Columns() []string         { return nil }
+func (dryRunRows) Close() error              { return nil }
+func (dryRunRows) Next([]driver.Value) error { return io.EOF }
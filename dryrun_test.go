@@ -0,0 +1,121 @@
+package sage
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDryRunRecordsCreateNested(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	dry := c.DryRun()
+
+	lines := &Relationship{Type: HasMany, Model: &testLine{}, ForeignKey: "order", ReferenceKey: "id"}
+	order := &testOrder{Lines: []*testLine{{Item: "a"}, {Item: "b"}}}
+	if err := dry.CreateNested(context.Background(), order, map[string]*Relationship{"Lines": lines}, NestedOption{AutoSave: true}); err != nil {
+		t.Fatalf("CreateNested: %v", err)
+	}
+
+	want := []RecordedQuery{
+		{Query: `INSERT INTO "orders" DEFAULT VALUES`},
+		{Query: "INSERT INTO lines (order, item) VALUES ($1, $2)", Args: []interface{}{int64(0), "a"}},
+		{Query: "INSERT INTO lines (order, item) VALUES ($1, $2)", Args: []interface{}{int64(0), "b"}},
+	}
+	if got := dry.RecordedQueries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("RecordedQueries = %+v, want %+v", got, want)
+	}
+
+	if len(db.Statements()) != 0 {
+		t.Errorf("dry run executed %v", db.Statements())
+	}
+	if c.RecordedQueries() != nil {
+		t.Errorf("regular connection recorded %v", c.RecordedQueries())
+	}
+}
+
+// testShipment has enough columns that map order would show
+type testShipment struct {
+	ID       int64  `db:"id,pk,auto"`
+	Zone     string `db:"zone"`
+	Carrier  string `db:"carrier"`
+	Weight   int64  `db:"weight"`
+	Address  string `db:"address"`
+	Tracking string `db:"tracking"`
+	Priority int64  `db:"priority"`
+	Batch    string `db:"batch"`
+}
+
+func (testShipment) TableName() string  { return "shipments" }
+func (testShipment) PrimaryKey() string { return "id" }
+
+func TestDryRunInsertColumnOrder(t *testing.T) {
+	c, _ := newTestConnection(t, "mysql")
+	ctx := context.Background()
+
+	info, err := extractModelInfo(&testShipment{})
+	if err != nil {
+		t.Fatalf("extractModelInfo: %v", err)
+	}
+	var columns []string
+	for _, field := range info.Fields {
+		if !field.IsAuto {
+			columns = append(columns, field.DBName)
+		}
+	}
+	if got := strings.Join(columns, ", "); got != "zone, carrier, weight, address, tracking, priority, batch" {
+		t.Fatalf("fields are in order %s, want declaration order", got)
+	}
+
+	const values = "(?, ?, ?, ?, ?, ?, ?)"
+	want := "INSERT INTO shipments (" + strings.Join(columns, ", ") + ") VALUES " + values
+	wantBatch := "INSERT INTO `shipments` (`zone`, `carrier`, `weight`, `address`, `tracking`, `priority`, `batch`) VALUES " + values + ", " + values
+	wantArgs := []interface{}{"north", "dhl", int64(3), "1 Main St", "T1", int64(2), "b1"}
+
+	for i := 0; i < 10; i++ {
+		dry := c.DryRun()
+		shipment := testShipment{Zone: "north", Carrier: "dhl", Weight: 3, Address: "1 Main St", Tracking: "T1", Priority: 2, Batch: "b1"}
+		if err := dry.Create(ctx, &shipment); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := dry.CreateBatch(ctx, []testShipment{shipment, shipment}); err != nil {
+			t.Fatalf("CreateBatch: %v", err)
+		}
+
+		recorded := dry.RecordedQueries()
+		if len(recorded) != 2 {
+			t.Fatalf("recorded %d statements, want 2", len(recorded))
+		}
+		if recorded[0].Query != want || !reflect.DeepEqual(recorded[0].Args, wantArgs) {
+			t.Fatalf("Create recorded %q with %v, want %q with %v", recorded[0].Query, recorded[0].Args, want, wantArgs)
+		}
+		if recorded[1].Query != wantBatch || !reflect.DeepEqual(recorded[1].Args, append(append([]interface{}(nil), wantArgs...), wantArgs...)) {
+			t.Fatalf("CreateBatch recorded %q with %v, want %q", recorded[1].Query, recorded[1].Args, wantBatch)
+		}
+	}
+}
+
+func TestDryRunRecordsUpdateAndDelete(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	dry := c.DryRun()
+	ctx := context.Background()
+
+	user := &testUser{ID: 3, Name: "Ann", Email: "ann@example.com"}
+	if err := dry.Update(ctx, user); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := dry.Delete(ctx, user); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	want := []RecordedQuery{
+		{Query: "UPDATE users SET name = $1, email = $2 WHERE id = $3", Args: []interface{}{"Ann", "ann@example.com", int64(3)}},
+		{Query: "DELETE FROM users WHERE id = $1", Args: []interface{}{int64(3)}},
+	}
+	if got := dry.RecordedQueries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("RecordedQueries = %+v, want %+v", got, want)
+	}
+	if len(db.Statements()) != 0 {
+		t.Errorf("dry run executed %v", db.Statements())
+	}
+}
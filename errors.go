@@ -1,8 +1,15 @@
 package sage
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
 )
 
 var (
@@ -23,6 +30,23 @@ var (
 
 	// ErrMigrationFailed indicates a migration failure
 	ErrMigrationFailed = errors.New("migration failed")
+
+	// ErrNoCondition indicates a bulk update or delete without a WHERE condition
+	ErrNoCondition = errors.New("bulk operation without condition would affect every row")
+
+	// ErrReadOnlyMode indicates a write on a connection in read-only mode
+	ErrReadOnlyMode = errors.New("connection is in read-only mode")
+
+	// ErrPreloadLimit indicates a preload loading more related models than
+	// ConnectionOptions.MaxPreload allows
+	ErrPreloadLimit = errors.New("preload limit exceeded")
+
+	// ErrDuplicate indicates a write violating a unique or primary key constraint
+	ErrDuplicate = errors.New("duplicate key")
+
+	// ErrForeignKeyViolation indicates a write referencing a missing row or
+	// deleting a referenced one
+	ErrForeignKeyViolation = errors.New("foreign key violation")
 )
 
 // WrapError wraps an error with additional context
@@ -39,6 +63,102 @@ func IsNotFoundError(err error) bool {
 	return errors.Is(err, ErrNotFound)
 }
 
+// connectionErrorMessages are driver error messages reporting a lost connection
+// for drivers that do not expose typed errors for it
+var connectionErrorMessages = []string{
+	"bad connection",             // database/sql, lib/pq
+	"invalid connection",         // go-sql-driver/mysql
+	"conn closed",                // pgx
+	"connection reset",           // network errors wrapped as text
+	"broken pipe",                // network errors wrapped as text
+	"server has gone away",       // MySQL error 2006
+	"lost connection to",         // MySQL error 2013
+	"terminating connection due", // PostgreSQL admin shutdown
+}
+
+// IsConnectionError checks if an error reports a lost or unusable database
+// connection, after which the whole unit of work can be retried
+func IsConnectionError(err error) bool {
+	// A cancelled or expired context is not a connection failure, although
+	// context.DeadlineExceeded implements net.Error
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, ErrConnectionFailed) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, m := range connectionErrorMessages {
+		if strings.Contains(message, m) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// duplicateErrorMessages are driver error messages reporting a unique or
+// primary key constraint violation
+var duplicateErrorMessages = []string{
+	"duplicate key value",      // PostgreSQL 23505
+	"duplicate entry",          // MySQL error 1062
+	"unique constraint failed", // SQLite
+}
+
+// foreignKeyErrorMessages are driver error messages reporting a foreign key
+// constraint violation
+var foreignKeyErrorMessages = []string{
+	"violates foreign key constraint", // PostgreSQL 23503
+	"a foreign key constraint fails",  // MySQL errors 1451 and 1452
+	"foreign key constraint failed",   // SQLite
+}
+
+// classifyError wraps driver errors reporting constraint violations with
+// ErrDuplicate or ErrForeignKeyViolation, keeping the driver error in the
+// chain. Other errors are returned unchanged.
+func classifyError(err error) error {
+	if err == nil || errors.Is(err, ErrDuplicate) || errors.Is(err, ErrForeignKeyViolation) {
+		return err
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, m := range duplicateErrorMessages {
+		if strings.Contains(message, m) {
+			return fmt.Errorf("%w: %w", ErrDuplicate, err)
+		}
+	}
+	for _, m := range foreignKeyErrorMessages {
+		if strings.Contains(message, m) {
+			return fmt.Errorf("%w: %w", ErrForeignKeyViolation, err)
+		}
+	}
+
+	return err
+}
+
+// IsDuplicateError checks if an error reports a unique constraint violation
+func IsDuplicateError(err error) bool {
+	return errors.Is(classifyError(err), ErrDuplicate)
+}
+
+// IsForeignKeyError checks if an error reports a foreign key constraint violation
+func IsForeignKeyError(err error) bool {
+	return errors.Is(classifyError(err), ErrForeignKeyViolation)
+}
+
 // IsValidationError checks if an error is a validation error
 func IsValidationError(err error) bool {
 	var valErr *ValidationError
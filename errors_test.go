@@ -0,0 +1,89 @@
+package sage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestOperationErrorsAreWrapped(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	ctx := context.Background()
+	cause := errors.New("disk full")
+	db.Fails("INSERT INTO", cause)
+
+	err := c.Create(ctx, &testUser{Name: "Ann"})
+	if !errors.Is(err, cause) || !strings.HasPrefix(err.Error(), "create users: ") {
+		t.Errorf("Create = %v, want the cause wrapped with create users", err)
+	}
+
+	tests := []struct {
+		op  string
+		run func() error
+	}{
+		{"find users", func() error { return c.Find(ctx, &testUser{}, 1) }},
+		{"select orders", func() error {
+			var row struct {
+				ID int64 `db:"id"`
+			}
+			return c.Select(ctx, &row, NewQueryBuilder("orders").Select("id"))
+		}},
+	}
+
+	for _, tt := range tests {
+		err := tt.run()
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s = %v, want ErrNotFound", tt.op, err)
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), tt.op+": ") {
+			t.Errorf("%s error %q lacks the operation and table", tt.op, err)
+		}
+	}
+}
+
+func TestConnectionErrors(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{driver.ErrBadConn, true},
+		{sql.ErrConnDone, true},
+		{fmt.Errorf("commit: %w", io.ErrUnexpectedEOF), true},
+		{errors.New("Error 2006: MySQL server has gone away"), true},
+		{errors.New("FATAL: terminating connection due to administrator command"), true},
+		{ErrNotFound, false},
+		{context.Canceled, false},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), false},
+		{errors.New("duplicate key value violates unique constraint"), false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsConnectionError(tt.err); got != tt.want {
+			t.Errorf("IsConnectionError(%v) = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+
+	c, db := newTestConnection(t, "postgres")
+	db.Fails("INSERT INTO", driver.ErrBadConn)
+
+	err := c.WithTransaction(context.Background(), func(tx *Transaction) error {
+		return c.Create(tx.Context(), &testUser{Name: "Ann"})
+	})
+	if !errors.Is(err, ErrConnectionFailed) || !IsConnectionError(err) {
+		t.Errorf("WithTransaction = %v, want ErrConnectionFailed", err)
+	}
+
+	// A deadline is passed through rather than reported as a lost connection
+	err = c.WithTransaction(context.Background(), func(tx *Transaction) error {
+		return fmt.Errorf("query: %w", context.DeadlineExceeded)
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrConnectionFailed) {
+		t.Errorf("WithTransaction = %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -4,8 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"reflect"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/IMPHNEN/sage/internal/dialect"
 )
 
 var (
@@ -26,9 +31,15 @@ type Executor interface {
 
 // Create inserts a new record into the database
 func (c *Connection) Create(ctx context.Context, model interface{}) error {
-	info, err := extractModelInfo(model)
+	_, err := c.CreateResult(ctx, model)
+	return err
+}
+
+// CreateResult inserts a new record and returns the driver result of the insert
+func (c *Connection) CreateResult(ctx context.Context, model interface{}) (sql.Result, error) {
+	info, err := c.modelInfo(ctx, model)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	qb := NewQueryBuilder(info.TableName).Insert()
@@ -38,6 +49,9 @@ func (c *Connection) Create(ctx context.Context, model interface{}) error {
 		v = v.Elem()
 	}
 
+	stampScopes(ctx, v, info)
+
+	var generated []FieldInfo
 	for _, field := range info.Fields {
 		// Skip auto-increment primary key fields
 		if field.IsKey && field.IsAuto {
@@ -45,63 +59,261 @@ func (c *Connection) Create(ctx context.Context, model interface{}) error {
 		}
 
 		fieldValue := v.FieldByName(field.Name)
-		qb.Set(field.DBName, fieldValue.Interface())
+
+		// Let the database generate unset fields with a default expression
+		// or the omitempty tag option
+		if (field.DefaultExpr != "" || field.OmitEmpty) && fieldValue.IsZero() {
+			generated = append(generated, field)
+			continue
+		}
+
+		value, err := c.fieldValue(field, fieldValue)
+		if err != nil {
+			return nil, WrapError(err, "create %s", info.TableName)
+		}
+		qb.Set(field.DBName, value)
 	}
 
 	query, args := qb.Build()
-	result, err := c.DB().ExecContext(ctx, query, args...)
-	if err != nil {
-		return err
+	if len(qb.valueColumns) == 0 {
+		// Every column takes its default value
+		query, args = c.dialect.InsertDefaultValuesSQL(info.TableName), nil
 	}
 
-	// If the model has an auto-increment primary key, set it
-	if id, err := result.LastInsertId(); err == nil {
+	// Read generated values back where the database supports RETURNING
+	if len(generated) > 0 {
 		for _, field := range info.Fields {
 			if field.IsKey && field.IsAuto {
-				idField := v.FieldByName(field.Name)
-				if idField.CanSet() {
-					idField.Set(reflect.ValueOf(id).Convert(idField.Type()))
-				}
-				break
+				generated = append(generated, field)
 			}
 		}
+
+		columns := make([]string, len(generated))
+		for i, field := range generated {
+			columns[i] = field.DBName
+		}
+
+		if clause := c.dialect.ReturningClause(columns); clause != "" {
+			return c.createReturning(ctx, info, v, query+" "+clause, args, generated)
+		}
 	}
 
-	return nil
+	result, err := c.exec(ctx, query, args...)
+	if err != nil {
+		return nil, WrapError(err, "create %s", info.TableName)
+	}
+	c.invalidateTable(ctx, info.TableName)
+
+	// If the model has an auto-increment primary key, set it. The id is read
+	// from the result of the same Exec, so it is scoped to this insert even
+	// when the connection is shared by concurrent callers.
+	if id, err := result.LastInsertId(); err == nil {
+		setAutoID(v, info, id)
+	}
+
+	return result, nil
+}
+
+// createReturning runs an INSERT with a RETURNING clause and assigns the
+// returned columns to the generated fields of the model value
+func (c *Connection) createReturning(ctx context.Context, info *ModelInfo, v reflect.Value, query string, args []interface{}, generated []FieldInfo) (sql.Result, error) {
+	if c.IsReadOnly() {
+		return nil, WrapError(ErrReadOnlyMode, "create %s", info.TableName)
+	}
+
+	values := scanTargets(len(generated))
+
+	if err := c.queryRow(ctx, query, args...).Scan(values...); err != nil {
+		return nil, WrapError(err, "create %s", info.TableName)
+	}
+	c.invalidateTable(ctx, info.TableName)
+
+	for i, field := range generated {
+		if err := c.assignColumn(v.FieldByName(field.Name), field, *(values[i].(*interface{}))); err != nil {
+			return nil, WrapError(err, "create %s", info.TableName)
+		}
+	}
+
+	return returnedRow{}, nil
+}
+
+// returnedRow is the result of an insert that read its row back with RETURNING
+type returnedRow struct{}
+
+// LastInsertId is not available for inserts using RETURNING
+func (returnedRow) LastInsertId() (int64, error) {
+	return 0, errors.New("LastInsertId is not available for inserts using RETURNING")
+}
+
+// RowsAffected returns 1, the inserted row
+func (returnedRow) RowsAffected() (int64, error) {
+	return 1, nil
+}
+
+// setAutoID sets the auto-increment primary key field of the model value
+func setAutoID(v reflect.Value, info *ModelInfo, id int64) {
+	for _, field := range info.Fields {
+		if field.IsKey && field.IsAuto {
+			idField := v.FieldByName(field.Name)
+			if idField.CanSet() && isIntegerKind(idField) {
+				idField.Set(reflect.ValueOf(id).Convert(idField.Type()))
+			}
+			return
+		}
+	}
 }
 
 // Find finds a record by its primary key
 func (c *Connection) Find(ctx context.Context, model interface{}, id interface{}) error {
-	info, err := extractModelInfo(model)
+	info, err := c.modelInfo(ctx, model)
 	if err != nil {
 		return err
 	}
 
 	qb := NewQueryBuilder(info.TableName).Select()
 	qb.Where(info.PrimaryKey+" = ?", id)
+	c.applyScopes(ctx, qb, info)
 
 	query, args := qb.Build()
-	return c.scanRow(ctx, model, query, args...)
+	return WrapError(c.cachedScanRow(ctx, info, model, query, args), "find %s", info.TableName)
 }
 
-// First finds the first record matching the conditions
-func (c *Connection) First(ctx context.Context, model interface{}, conditions string, args ...interface{}) error {
-	info, err := extractModelInfo(model)
+// Refresh reloads the model from its row, selected by the model's primary key,
+// overwriting its fields, e.g. to read values set by defaults or triggers.
+// The result cache is bypassed. It fails with ErrNotFound if the row no
+// longer exists.
+func (c *Connection) Refresh(ctx context.Context, model interface{}) error {
+	info, err := c.modelInfo(ctx, model)
 	if err != nil {
 		return err
 	}
 
+	v := reflect.ValueOf(model)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.New("model must be a non-nil pointer")
+	}
+
+	pk, err := primaryKeyField(v.Elem(), info)
+	if err != nil {
+		return WrapError(err, "refresh %s", info.TableName)
+	}
+
 	qb := NewQueryBuilder(info.TableName).Select()
-	if conditions != "" {
-		qb.Where(conditions, args...)
+	qb.Where(info.PrimaryKey+" = ?", pk.Interface())
+	c.applyScopes(ctx, qb, info)
+
+	query, args := qb.Build()
+	return WrapError(c.scanRow(ctx, model, query, args...), "refresh %s", info.TableName)
+}
+
+// FindAll finds the records whose primary key is one of ids, appending them to
+// the slice models points to. Rows are returned in no particular order and
+// ids without a record are skipped. Large id lists are split into several
+// queries within the dialect's parameter limit, or loaded into a temporary
+// table when they exceed ConnectionOptions.TempTableThreshold.
+func (c *Connection) FindAll(ctx context.Context, models interface{}, ids []interface{}) error {
+	sliceValue := reflect.ValueOf(models)
+	if sliceValue.Kind() != reflect.Ptr || sliceValue.Elem().Kind() != reflect.Slice {
+		return errors.New("models must be a pointer to a slice")
+	}
+
+	elemType := sliceValue.Elem().Type().Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+
+	info, err := c.modelInfo(ctx, reflect.New(elemType).Interface())
+	if err != nil {
+		return err
+	}
+
+	if threshold := c.options.TempTableThreshold; threshold > 0 && len(ids) > threshold && !c.IsReadOnly() {
+		return WrapError(c.findAllByTempTable(ctx, models, info, ids), "find all %s", info.TableName)
+	}
+
+	chunkSize := c.dialect.MaxPlaceholders()
+	for start := 0; start < len(ids); start += chunkSize {
+		end := start + chunkSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", end-start), ", ")
+		condition := fmt.Sprintf("%s IN (%s)", c.dialect.Quote(info.PrimaryKey), placeholders)
+		if err := c.All(ctx, models, condition, ids[start:end]...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findAllIDsTable is the temporary table holding the ids of FindAll
+const findAllIDsTable = "sage_find_ids"
+
+// findAllByTempTable finds the records whose primary key is one of ids by
+// inserting the ids into a temporary table and selecting the records whose key
+// is in it. Temporary tables belong to a database session, so the statements
+// run in a transaction to stay on one pooled connection.
+func (c *Connection) findAllByTempTable(ctx context.Context, models interface{}, info *ModelInfo, ids []interface{}) error {
+	pk, ok := fieldByColumn(info, info.PrimaryKey)
+	if !ok {
+		return ErrNoID
+	}
+
+	table := c.dialect.Quote(findAllIDsTable)
+	column := c.dialect.Quote("id")
+
+	return c.WithTransactionContext(ctx, func(ctx context.Context) (err error) {
+		definition := column + " " + c.dialect.DataType(pk.Type, pk.Size, pk.Precision, pk.Scale)
+		if _, err := c.exec(ctx, c.dialect.CreateTemporaryTableSQL(findAllIDsTable, []string{definition})); err != nil {
+			return err
+		}
+		defer func() {
+			_, dropErr := c.exec(ctx, c.dialect.DropTemporaryTableSQL(findAllIDsTable))
+			err = errors.Join(err, dropErr)
+		}()
+
+		chunkSize := c.dialect.MaxPlaceholders()
+		for start := 0; start < len(ids); start += chunkSize {
+			end := start + chunkSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+
+			rows := strings.TrimSuffix(strings.Repeat("(?), ", end-start), ", ")
+			query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table, column, rows)
+			if _, err := c.exec(ctx, query, ids[start:end]...); err != nil {
+				return err
+			}
+		}
+
+		condition := fmt.Sprintf("%s IN (SELECT %s FROM %s)", c.dialect.Quote(info.PrimaryKey), column, table)
+		return c.All(ctx, models, condition)
+	})
+}
+
+// First finds the first record matching the conditions, a condition string
+// with ? placeholders for args or Conditions
+func (c *Connection) First(ctx context.Context, model interface{}, conditions interface{}, args ...interface{}) error {
+	info, err := c.modelInfo(ctx, model)
+	if err != nil {
+		return err
+	}
+
+	qb := NewQueryBuilder(info.TableName).Select()
+	if err := c.where(qb, info, conditions, args); err != nil {
+		return err
 	}
+	c.applyScopes(ctx, qb, info)
 	qb.Limit(1)
 
 	query, queryArgs := qb.Build()
-	return c.scanRow(ctx, model, query, queryArgs...)
+	return WrapError(c.cachedScanRow(ctx, info, model, query, queryArgs), "first %s", info.TableName)
 }
 
-// scanRow scans a single row into the model
+// scanRow scans the first row returned by the query into the model, matching
+// columns to fields like All
 func (c *Connection) scanRow(ctx context.Context, model interface{}, query string, args ...interface{}) error {
 	v := reflect.ValueOf(model)
 	if v.Kind() != reflect.Ptr || v.IsNil() {
@@ -109,42 +321,122 @@ func (c *Connection) scanRow(ctx context.Context, model interface{}, query strin
 	}
 	v = v.Elem()
 
-	row := c.DB().QueryRowContext(ctx, query, args...)
-	fields, err := scanFields(v)
+	info, err := c.modelInfo(ctx, model)
+	if err != nil {
+		return err
+	}
+
+	rows, err := c.query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
 	if err != nil {
 		return err
 	}
 
-	err = row.Scan(fields...)
-	if err == sql.ErrNoRows {
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
 		return ErrNotFound
 	}
-	return err
-}
 
-// scanFields creates a slice of pointers to each field in the struct
-func scanFields(v reflect.Value) ([]interface{}, error) {
-	if v.Kind() != reflect.Struct {
-		return nil, ErrNotAStruct
+	values := scanTargets(len(columns))
+	if err := rows.Scan(values...); err != nil {
+		return err
 	}
 
-	var fields []interface{}
-	for i := 0; i < v.NumField(); i++ {
-		field := v.Field(i)
-		if field.CanSet() {
-			fields = append(fields, field.Addr().Interface())
+	fields := columnFields(info, columns)
+	for i, index := range columnFieldIndexes(info, v.Type(), columns) {
+		if index == nil {
+			continue
+		}
+		if err := c.assignColumn(v.FieldByIndex(index), fields[i], *(values[i].(*interface{}))); err != nil {
+			return err
 		}
 	}
-	return fields, nil
+
+	return nil
 }
 
 // Update updates a record in the database
 func (c *Connection) Update(ctx context.Context, model interface{}) error {
-	info, err := extractModelInfo(model)
+	info, err := c.modelInfo(ctx, model)
+	if err != nil {
+		return err
+	}
+
+	return c.update(ctx, model, info, func(FieldInfo) bool { return true })
+}
+
+// UpdateColumns updates only the named columns of a record
+func (c *Connection) UpdateColumns(ctx context.Context, model interface{}, columns ...string) error {
+	info, err := c.modelInfo(ctx, model)
+	if err != nil {
+		return err
+	}
+
+	selected, err := columnSet(info, columns)
+	if err != nil {
+		return err
+	}
+	if err := checkMutable(info, columns); err != nil {
+		return err
+	}
+
+	return c.update(ctx, model, info, func(field FieldInfo) bool { return selected[field.DBName] })
+}
+
+// UpdateExcept updates all non-key columns of a record except the named ones
+func (c *Connection) UpdateExcept(ctx context.Context, model interface{}, columns ...string) error {
+	info, err := c.modelInfo(ctx, model)
 	if err != nil {
 		return err
 	}
 
+	excluded, err := columnSet(info, columns)
+	if err != nil {
+		return err
+	}
+
+	return c.update(ctx, model, info, func(field FieldInfo) bool { return !excluded[field.DBName] })
+}
+
+// columnSet validates that the columns belong to the model and returns them as a set
+func columnSet(info *ModelInfo, columns []string) (map[string]bool, error) {
+	set := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		found := false
+		for _, field := range info.Fields {
+			if field.DBName == column {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("%w: unknown column %s for table %s", ErrInvalidArgument, column, info.TableName)
+		}
+		set[column] = true
+	}
+	return set, nil
+}
+
+// checkMutable rejects updates of immutable columns
+func checkMutable(info *ModelInfo, columns []string) error {
+	for _, column := range columns {
+		if field, ok := fieldByColumn(info, column); ok && field.Immutable {
+			return fmt.Errorf("%w: column %s of table %s is immutable", ErrInvalidArgument, column, info.TableName)
+		}
+	}
+	return nil
+}
+
+// update updates a record, setting the non-key fields accepted by include
+func (c *Connection) update(ctx context.Context, model interface{}, info *ModelInfo, include func(FieldInfo) bool) error {
 	qb := NewQueryBuilder(info.TableName).Update()
 
 	v := reflect.ValueOf(model)
@@ -153,6 +445,7 @@ func (c *Connection) Update(ctx context.Context, model interface{}) error {
 	}
 
 	var idValue interface{}
+	columns := 0
 	for _, field := range info.Fields {
 		fieldValue := v.FieldByName(field.Name)
 
@@ -161,36 +454,244 @@ func (c *Connection) Update(ctx context.Context, model interface{}) error {
 			continue
 		}
 
-		qb.Set(field.DBName, fieldValue.Interface())
+		// Immutable fields such as created_at are only set on insert
+		if field.Immutable {
+			continue
+		}
+
+		// Timestamps updated on every change are left to the database where
+		// its DDL stamps them, and stamped here otherwise, whichever columns
+		// are updated
+		if field.OnUpdateNow {
+			if c.dialect.OnUpdateTimestampClause() != "" {
+				continue
+			}
+			if err := assignValue(fieldValue, time.Now()); err != nil {
+				return WrapError(err, "update %s", info.TableName)
+			}
+
+			value, err := c.fieldValue(field, fieldValue)
+			if err != nil {
+				return WrapError(err, "update %s", info.TableName)
+			}
+			qb.Set(field.DBName, value)
+			continue
+		}
+
+		if !include(field) {
+			continue
+		}
+
+		value, err := c.fieldValue(field, fieldValue)
+		if err != nil {
+			return WrapError(err, "update %s", info.TableName)
+		}
+		qb.Set(field.DBName, value)
+		columns++
 	}
 
 	if idValue == nil {
-		return ErrNoID
+		return WrapError(ErrNoID, "update %s", info.TableName)
+	}
+
+	if columns == 0 {
+		return WrapError(ErrInvalidArgument, "update %s: no columns to update", info.TableName)
+	}
+
+	if err := c.checkTransition(ctx, model, v, info, include, idValue); err != nil {
+		return WrapError(err, "update %s", info.TableName)
 	}
 
 	qb.Where(info.PrimaryKey+" = ?", idValue)
+	c.applyScopes(ctx, qb, info)
 	query, args := qb.Build()
 
-	result, err := c.DB().ExecContext(ctx, query, args...)
+	result, err := c.exec(ctx, query, args...)
 	if err != nil {
-		return err
+		return WrapError(err, "update %s", info.TableName)
 	}
+	c.invalidateTable(ctx, info.TableName)
 
 	affected, err := result.RowsAffected()
 	if err != nil {
-		return err
+		return WrapError(err, "update %s", info.TableName)
 	}
 
 	if affected == 0 {
-		return ErrNotFound
+		return WrapError(ErrNotFound, "update %s", info.TableName)
 	}
 
 	return nil
 }
 
+// UpdateMap sets the given columns on every record of the model's table matching
+// the conditions and returns the number of affected rows. A nil value sets the
+// column to NULL. An empty condition is rejected with ErrNoCondition unless the
+// context was created with AllowGlobal.
+func (c *Connection) UpdateMap(ctx context.Context, model interface{}, values map[string]interface{}, conditions string, args ...interface{}) (int64, error) {
+	info, err := c.modelInfo(ctx, model)
+	if err != nil {
+		return 0, err
+	}
+
+	if strings.TrimSpace(conditions) == "" && !globalAllowed(ctx) {
+		return 0, WrapError(ErrNoCondition, "update %s", info.TableName)
+	}
+
+	columns := make([]string, 0, len(values))
+	for column := range values {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	if _, err := columnSet(info, columns); err != nil {
+		return 0, WrapError(err, "update %s", info.TableName)
+	}
+	if err := checkMutable(info, columns); err != nil {
+		return 0, WrapError(err, "update %s", info.TableName)
+	}
+
+	if len(columns) == 0 {
+		return 0, WrapError(ErrInvalidArgument, "update %s: no columns to update", info.TableName)
+	}
+
+	qb := NewQueryBuilder(info.TableName).Update()
+	for _, column := range columns {
+		value := values[column]
+		if field, _ := fieldByColumn(info, column); (field.Transform != "" || field.BoolAs != "") && value != nil {
+			if value, err = c.fieldValue(field, reflect.ValueOf(value)); err != nil {
+				return 0, WrapError(err, "update %s", info.TableName)
+			}
+		}
+		qb.Set(column, value)
+	}
+
+	// Stamp timestamps updated on every change unless the database does
+	if c.dialect.OnUpdateTimestampClause() == "" {
+		now := time.Now()
+		for _, field := range info.Fields {
+			if _, ok := values[field.DBName]; field.OnUpdateNow && !ok {
+				qb.Set(field.DBName, now)
+			}
+		}
+	}
+
+	if conditions != "" {
+		qb.Where(conditions, args...)
+	}
+	c.applyScopes(ctx, qb, info)
+
+	query, queryArgs := qb.Build()
+
+	result, err := c.exec(ctx, query, queryArgs...)
+	if err != nil {
+		return 0, WrapError(err, "update %s", info.TableName)
+	}
+	c.invalidateTable(ctx, info.TableName)
+
+	return result.RowsAffected()
+}
+
+// Save inserts the record if its primary key is the zero value and updates it
+// otherwise. For primary keys that are not auto-increment a non-zero key does
+// not imply the row exists, so when the update matches no row Save looks the
+// key up and inserts the record only if it is missing: MySQL reports no
+// affected rows for an update that changes nothing, and such a save succeeds
+// without an insert.
+func (c *Connection) Save(ctx context.Context, model interface{}) error {
+	info, err := c.modelInfo(ctx, model)
+	if err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(model)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	var keyField *FieldInfo
+	for i := range info.Fields {
+		if info.Fields[i].IsKey {
+			keyField = &info.Fields[i]
+			break
+		}
+	}
+
+	if keyField == nil {
+		return ErrNoID
+	}
+
+	if isZeroValue(v.FieldByName(keyField.Name)) {
+		return c.Create(ctx, model)
+	}
+
+	err = c.Update(ctx, model)
+	if !errors.Is(err, ErrNotFound) || keyField.IsAuto {
+		return err
+	}
+
+	query := fmt.Sprintf(
+		"SELECT 1 FROM %s WHERE %s = ? LIMIT 1",
+		c.dialect.Quote(info.TableName),
+		c.dialect.Quote(keyField.DBName),
+	)
+
+	var found int
+	err = c.queryRow(ctx, query, v.FieldByName(keyField.Name).Interface()).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Create(ctx, model)
+	}
+	return WrapError(err, "save %s", info.TableName)
+}
+
+// globalKey is the context key marking bulk operations allowed without a condition
+type globalKey struct{}
+
+// AllowGlobal returns a context that allows UpdateMap and DeleteWhere to run
+// without a condition, affecting every row of the table
+func AllowGlobal(ctx context.Context) context.Context {
+	return context.WithValue(ctx, globalKey{}, true)
+}
+
+// globalAllowed checks if the context allows bulk operations without a condition
+func globalAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(globalKey{}).(bool)
+	return allowed
+}
+
+// DeleteWhere deletes every record of the model's table matching the conditions
+// and returns the number of deleted rows. An empty condition is rejected with
+// ErrNoCondition unless the context was created with AllowGlobal.
+func (c *Connection) DeleteWhere(ctx context.Context, model interface{}, conditions string, args ...interface{}) (int64, error) {
+	info, err := c.modelInfo(ctx, model)
+	if err != nil {
+		return 0, err
+	}
+
+	if strings.TrimSpace(conditions) == "" && !globalAllowed(ctx) {
+		return 0, WrapError(ErrNoCondition, "delete %s", info.TableName)
+	}
+
+	qb := NewQueryBuilder(info.TableName).Delete()
+	if conditions != "" {
+		qb.Where(conditions, args...)
+	}
+	c.applyScopes(ctx, qb, info)
+
+	query, queryArgs := qb.Build()
+
+	result, err := c.exec(ctx, query, queryArgs...)
+	if err != nil {
+		return 0, WrapError(err, "delete %s", info.TableName)
+	}
+	c.invalidateTable(ctx, info.TableName)
+
+	return result.RowsAffected()
+}
+
 // Delete deletes a record from the database
 func (c *Connection) Delete(ctx context.Context, model interface{}) error {
-	info, err := extractModelInfo(model)
+	info, err := c.modelInfo(ctx, model)
 	if err != nil {
 		return err
 	}
@@ -210,103 +711,642 @@ func (c *Connection) Delete(ctx context.Context, model interface{}) error {
 	}
 
 	if idValue == nil {
-		return ErrNoID
+		return WrapError(ErrNoID, "delete %s", info.TableName)
 	}
 
 	qb := NewQueryBuilder(info.TableName).Delete()
 	qb.Where(info.PrimaryKey+" = ?", idValue)
+	c.applyScopes(ctx, qb, info)
 
 	query, args := qb.Build()
 
-	result, err := c.DB().ExecContext(ctx, query, args...)
+	result, err := c.exec(ctx, query, args...)
 	if err != nil {
-		return err
+		return WrapError(err, "delete %s", info.TableName)
 	}
+	c.invalidateTable(ctx, info.TableName)
 
 	affected, err := result.RowsAffected()
 	if err != nil {
-		return err
+		return WrapError(err, "delete %s", info.TableName)
 	}
 
 	if affected == 0 {
-		return ErrNotFound
+		return WrapError(ErrNotFound, "delete %s", info.TableName)
+	}
+
+	return nil
+}
+
+// DeleteReturning deletes a record like Delete and reads the deleted row's
+// columns back into the model with RETURNING, e.g. for an audit log. All the
+// model's columns are returned when none are given. RETURNING is supported by
+// PostgreSQL and SQLite 3.35+; MySQL returns ErrInvalidOperation.
+func (c *Connection) DeleteReturning(ctx context.Context, model interface{}, columns ...string) error {
+	info, err := c.modelInfo(ctx, model)
+	if err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(model)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.New("model must be a non-nil pointer")
+	}
+	v = v.Elem()
+
+	if c.IsReadOnly() {
+		return WrapError(ErrReadOnlyMode, "delete %s", info.TableName)
+	}
+
+	if len(columns) == 0 {
+		for _, field := range info.Fields {
+			columns = append(columns, field.DBName)
+		}
+	} else if _, err := columnSet(info, columns); err != nil {
+		return err
+	}
+
+	returning := c.dialect.ReturningClause(columns)
+	if returning == "" {
+		return fmt.Errorf("%w: %s does not support RETURNING", ErrInvalidOperation, c.dialect.Name())
+	}
+
+	pk, err := primaryKeyField(v, info)
+	if err != nil {
+		return WrapError(err, "delete %s", info.TableName)
+	}
+
+	qb := NewQueryBuilder(info.TableName).Delete()
+	qb.Where(info.PrimaryKey+" = ?", pk.Interface())
+	c.applyScopes(ctx, qb, info)
+
+	query, args := qb.Build()
+	query += " " + returning
+
+	values := scanTargets(len(columns))
+	if err := c.queryRow(ctx, query, args...).Scan(values...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return WrapError(ErrNotFound, "delete %s", info.TableName)
+		}
+		return WrapError(err, "delete %s", info.TableName)
+	}
+	c.invalidateTable(ctx, info.TableName)
+
+	for i, field := range columnFields(info, columns) {
+		if err := c.assignColumn(v.FieldByName(field.Name), field, *(values[i].(*interface{}))); err != nil {
+			return WrapError(err, "delete %s", info.TableName)
+		}
 	}
 
 	return nil
 }
 
-// All finds all records matching the conditions
-func (c *Connection) All(ctx context.Context, models interface{}, conditions string, args ...interface{}) error {
+// All finds all records matching the conditions, a condition string with ?
+// placeholders for args or Conditions
+func (c *Connection) All(ctx context.Context, models interface{}, conditions interface{}, args ...interface{}) error {
 	sliceValue := reflect.ValueOf(models)
 	if sliceValue.Kind() != reflect.Ptr || sliceValue.Elem().Kind() != reflect.Slice {
 		return errors.New("models must be a pointer to a slice")
 	}
 
 	sliceValue = sliceValue.Elem()
+
+	// Support both []T and []*T destinations
 	elemType := sliceValue.Type().Elem()
+	modelType := elemType
+	if elemType.Kind() == reflect.Ptr {
+		modelType = elemType.Elem()
+	}
 
-	// Create a new instance of the slice element type
-	modelInstance := reflect.New(elemType).Interface()
+	// Create a new instance of the model type
+	modelInstance := reflect.New(modelType).Interface()
 
-	info, err := extractModelInfo(modelInstance)
+	info, err := c.modelInfo(ctx, modelInstance)
 	if err != nil {
 		return err
 	}
 
 	qb := NewQueryBuilder(info.TableName).Select()
-	if conditions != "" {
-		qb.Where(conditions, args...)
+	if err := c.where(qb, info, conditions, args); err != nil {
+		return err
 	}
+	c.applyScopes(ctx, qb, info)
 
 	query, queryArgs := qb.Build()
 
-	rows, err := c.DB().QueryContext(ctx, query, queryArgs...)
+	key, cacheable := c.cacheKey(ctx, info.TableName, sliceValue.Type(), query, queryArgs)
+	if cacheable {
+		// A value of another type is a colliding entry; query instead
+		if cached, ok := c.cacheGet(key); ok && reflect.TypeOf(cached) == sliceValue.Type() {
+			sliceValue.Set(reflect.AppendSlice(sliceValue, copyModels(reflect.ValueOf(cached))))
+			return nil
+		}
+	}
+
+	rows, err := c.query(ctx, query, queryArgs...)
 	if err != nil {
-		return err
+		return WrapError(err, "all %s", info.TableName)
 	}
 	defer rows.Close()
 
 	// Get column names from the query
 	columns, err := rows.Columns()
 	if err != nil {
-		return err
+		return WrapError(err, "all %s", info.TableName)
 	}
 
+	// Resolve each column to its model field once, rather than per row
+	fieldIndexes := columnFieldIndexes(info, modelType, columns)
+	fields := columnFields(info, columns)
+
+	start := sliceValue.Len()
+	values := scanTargets(len(columns))
 	for rows.Next() {
+		// Stop promptly if the context has been cancelled
+		if err := ctx.Err(); err != nil {
+			return WrapError(err, "all %s", info.TableName)
+		}
+
 		// Create a new instance of the model
-		modelElem := reflect.New(elemType).Elem()
+		modelPtr := reflect.New(modelType)
+		modelElem := modelPtr.Elem()
+
+		// Scan the row into the values
+		if err := rows.Scan(values...); err != nil {
+			return WrapError(err, "all %s", info.TableName)
+		}
 
-		// Create a slice of interface{} to hold the values
-		values := make([]interface{}, len(columns))
-		for i := range values {
-			values[i] = new(interface{})
+		// Map the values to the model fields
+		for i, index := range fieldIndexes {
+			if index == nil {
+				continue
+			}
+			if err := c.assignColumn(modelElem.FieldByIndex(index), fields[i], *(values[i].(*interface{}))); err != nil {
+				return WrapError(err, "all %s", info.TableName)
+			}
 		}
 
-		// Scan the row into the values
+		// Append the model to the slice
+		if elemType.Kind() == reflect.Ptr {
+			sliceValue.Set(reflect.Append(sliceValue, modelPtr))
+		} else {
+			sliceValue.Set(reflect.Append(sliceValue, modelElem))
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return WrapError(err, "all %s", info.TableName)
+	}
+
+	if cacheable {
+		c.cacheSet(key, copyModels(sliceValue.Slice(start, sliceValue.Len())).Interface())
+	}
+
+	return nil
+}
+
+// Count counts the records matching the conditions
+func (c *Connection) Count(ctx context.Context, model interface{}, conditions interface{}, args ...interface{}) (int64, error) {
+	info, err := c.modelInfo(ctx, model)
+	if err != nil {
+		return 0, err
+	}
+
+	qb := NewQueryBuilder(info.TableName).Select("COUNT(*)")
+	if err := c.where(qb, info, conditions, args); err != nil {
+		return 0, err
+	}
+	c.applyScopes(ctx, qb, info)
+
+	query, queryArgs := qb.Build()
+
+	var count int64
+	if err := c.queryRow(ctx, query, queryArgs...).Scan(&count); err != nil {
+		return 0, WrapError(err, "count %s", info.TableName)
+	}
+
+	return count, nil
+}
+
+// CountDistinct counts the distinct values of column among the records matching the conditions
+func (c *Connection) CountDistinct(ctx context.Context, model interface{}, column string, conditions interface{}, args ...interface{}) (int64, error) {
+	info, err := c.modelInfo(ctx, model)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := columnSet(info, []string{column}); err != nil {
+		return 0, err
+	}
+
+	qb := NewQueryBuilder(info.TableName).Select("COUNT(DISTINCT " + c.dialect.Quote(column) + ")")
+	if err := c.where(qb, info, conditions, args); err != nil {
+		return 0, err
+	}
+	c.applyScopes(ctx, qb, info)
+
+	query, queryArgs := qb.Build()
+
+	var count int64
+	if err := c.queryRow(ctx, query, queryArgs...).Scan(&count); err != nil {
+		return 0, WrapError(err, "count distinct %s", info.TableName)
+	}
+
+	return count, nil
+}
+
+// GroupCount counts the records matching the conditions for each value of groupColumn
+func (c *Connection) GroupCount(ctx context.Context, model interface{}, groupColumn string, conditions interface{}, args ...interface{}) (map[interface{}]int64, error) {
+	info, err := c.modelInfo(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := columnSet(info, []string{groupColumn}); err != nil {
+		return nil, err
+	}
+	groupExpr := c.dialect.Quote(groupColumn)
+
+	qb := NewQueryBuilder(info.TableName).Select(groupExpr, "COUNT(*)")
+	if err := c.where(qb, info, conditions, args); err != nil {
+		return nil, err
+	}
+	c.applyScopes(ctx, qb, info)
+	qb.GroupBy(groupExpr)
+
+	query, queryArgs := qb.Build()
+
+	rows, err := c.query(ctx, query, queryArgs...)
+	if err != nil {
+		return nil, WrapError(err, "group count %s", info.TableName)
+	}
+	defer rows.Close()
+
+	counts := make(map[interface{}]int64)
+	for rows.Next() {
+		var group interface{}
+		var count int64
+		if err := rows.Scan(&group, &count); err != nil {
+			return nil, WrapError(err, "group count %s", info.TableName)
+		}
+
+		// Byte slices are not valid map keys
+		if b, ok := group.([]byte); ok {
+			group = string(b)
+		}
+		counts[group] = count
+	}
+
+	return counts, WrapError(rows.Err(), "group count %s", info.TableName)
+}
+
+// CountQuery counts the rows returned by the SELECT built by qb, including its
+// joins and grouping, by wrapping it in SELECT COUNT(*). ORDER BY, LIMIT and
+// OFFSET are ignored so that the total can be used for pagination.
+func (c *Connection) CountQuery(ctx context.Context, qb *QueryBuilder) (int64, error) {
+	inner := qb.Clone()
+	inner.orderBy = []string{}
+	inner.limit = 0
+	inner.offset = 0
+
+	query, args := inner.Build()
+
+	var count int64
+	if err := c.queryRow(ctx, "SELECT COUNT(*) FROM ("+query+") sage_count", args...).Scan(&count); err != nil {
+		return 0, WrapError(err, "count query %s", qb.table)
+	}
+	return count, nil
+}
+
+// Select runs the query built by qb and scans the result into dest, which must be
+// a pointer to a struct or a pointer to a slice of structs or struct pointers.
+// Columns are matched to fields by their db tag, or the snake_case field name,
+// so aggregates are scanned by aliasing them to a tagged field, e.g.
+//
+//	type total struct {
+//		Category string  `db:"category"`
+//		Total    float64 `db:"total"`
+//	}
+//	qb := NewQueryBuilder("sales").Select("category", "SUM(amount) AS total").GroupBy("category")
+//	err := conn.Select(ctx, &totals, qb)
+func (c *Connection) Select(ctx context.Context, dest interface{}, qb *QueryBuilder) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.New("destination must be a non-nil pointer")
+	}
+	v = v.Elem()
+
+	query, args := qb.Build()
+
+	rows, err := c.query(ctx, query, args...)
+	if err != nil {
+		return WrapError(err, "select %s", qb.table)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return WrapError(err, "select %s", qb.table)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return WrapError(err, "select %s", qb.table)
+			}
+			return WrapError(ErrNotFound, "select %s", qb.table)
+		}
+		targets, apply := projectionTargets(v, columns)
+		if err := rows.Scan(targets...); err != nil {
+			return WrapError(err, "select %s", qb.table)
+		}
+		if err := apply(); err != nil {
+			return WrapError(err, "select %s", qb.table)
+		}
+
+	case reflect.Slice:
+		elemType := v.Type().Elem()
+		isPtr := elemType.Kind() == reflect.Ptr
+		if isPtr {
+			elemType = elemType.Elem()
+		}
+
+		if elemType.Kind() != reflect.Struct {
+			return errors.New("destination must be a pointer to a slice of structs or struct pointers")
+		}
+
+		for rows.Next() {
+			elem := reflect.New(elemType).Elem()
+			targets, apply := projectionTargets(elem, columns)
+			if err := rows.Scan(targets...); err != nil {
+				return WrapError(err, "select %s", qb.table)
+			}
+			if err := apply(); err != nil {
+				return WrapError(err, "select %s", qb.table)
+			}
+
+			if isPtr {
+				v.Set(reflect.Append(v, elem.Addr()))
+			} else {
+				v.Set(reflect.Append(v, elem))
+			}
+		}
+
+	default:
+		return errors.New("destination must be a pointer to a struct or slice")
+	}
+
+	return WrapError(rows.Err(), "select %s", qb.table)
+}
+
+// EachGroup runs the query built by qb, typically an aggregate with GROUP BY,
+// and calls fn with each row as it is read, keyed by column name, so that
+// large reports are not held in memory. Text read as []byte is passed as a
+// string. It stops at the first error returned by fn and returns it.
+func (c *Connection) EachGroup(ctx context.Context, qb *QueryBuilder, fn func(row map[string]interface{}) error) error {
+	query, args := qb.Build()
+
+	rows, err := c.query(ctx, query, args...)
+	if err != nil {
+		return WrapError(err, "each group %s", qb.table)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return WrapError(err, "each group %s", qb.table)
+	}
+
+	values := scanTargets(len(columns))
+	for rows.Next() {
 		if err := rows.Scan(values...); err != nil {
+			return WrapError(err, "each group %s", qb.table)
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			value := *(values[i].(*interface{}))
+			if b, ok := value.([]byte); ok {
+				value = string(b)
+			}
+			row[column] = value
+		}
+
+		if err := fn(row); err != nil {
 			return err
 		}
+	}
 
-		// Map the values to the model fields
-		for i, col := range columns {
-			// Find the corresponding field in the model
-			for _, field := range info.Fields {
-				if strings.EqualFold(field.DBName, col) {
-					fieldValue := modelElem.FieldByName(field.Name)
-					if fieldValue.CanSet() {
-						val := reflect.ValueOf(*(values[i].(*interface{})))
-						if val.Type().ConvertibleTo(fieldValue.Type()) {
-							fieldValue.Set(val.Convert(fieldValue.Type()))
-						}
-					}
-					break
+	return WrapError(rows.Err(), "each group %s", qb.table)
+}
+
+// projectionTargets returns scan targets for the columns, pointing at the
+// matching fields of v and discarding columns without a matching field, and a
+// function to call after scanning. Plain fields are scanned through a pointer
+// so that NULL, e.g. the SUM of an empty group, leaves them at their zero value.
+//
+// Columns without a matching field may address a field of a struct field by
+// prefixing its column with the struct field's name, so that a joined query
+// loads a related model along with its parent:
+//
+//	type orderWithBuyer struct {
+//		Order
+//		Buyer *User `db:"buyer"`
+//	}
+//	qb := NewQueryBuilder("orders o").
+//		Select("o.*", "u.id AS buyer_id", "u.name AS buyer_name").
+//		Join("LEFT JOIN users u ON u.id = o.user_id")
+//
+// The fields of embedded structs without a db tag are matched like fields of
+// v. A pointer struct field is only allocated when one of its columns is not
+// NULL, so a LEFT JOIN without a match leaves it nil.
+func projectionTargets(v reflect.Value, columns []string) ([]interface{}, func() error) {
+	t := v.Type()
+	fieldIndex := projectionFields(t)
+
+	targets := make([]interface{}, len(columns))
+	var nullable []reflect.Value
+	var fields []reflect.Value
+	var related []relatedTarget
+	for i, col := range columns {
+		index, ok := fieldIndex[strings.ToLower(col)]
+		if !ok {
+			var discard interface{}
+			targets[i] = &discard
+			if outer, inner, ok := prefixedField(t, fieldIndex, col); ok {
+				related = append(related, relatedTarget{outer: outer, inner: inner, value: &discard})
+			}
+			continue
+		}
+
+		field := v.FieldByIndex(index)
+		if field.Kind() == reflect.Ptr || reflect.PtrTo(field.Type()).Implements(scannerType) {
+			targets[i] = field.Addr().Interface()
+			continue
+		}
+
+		target := reflect.New(reflect.PtrTo(field.Type()))
+		targets[i] = target.Interface()
+		nullable = append(nullable, target)
+		fields = append(fields, field)
+	}
+
+	apply := func() error {
+		for i, target := range nullable {
+			if ptr := target.Elem(); !ptr.IsNil() {
+				fields[i].Set(ptr.Elem())
+			} else {
+				fields[i].Set(reflect.Zero(fields[i].Type()))
+			}
+		}
+
+		for _, target := range related {
+			if *target.value == nil {
+				continue
+			}
+			field := v.FieldByIndex(target.outer)
+			if field.Kind() == reflect.Ptr {
+				if field.IsNil() {
+					field.Set(reflect.New(field.Type().Elem()))
 				}
+				field = field.Elem()
 			}
+			if err := assignValue(field.FieldByIndex(target.inner), *target.value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return targets, apply
+}
+
+// relatedTarget is the scan target of a column addressing a field of a
+// struct field, see projectionTargets
+type relatedTarget struct {
+	outer []int
+	inner []int
+	value *interface{}
+}
+
+// projectionFields maps the lower-cased column names of the fields of the
+// struct type t to their indexes. Fields of embedded structs without a db tag
+// are included unless shadowed by a field of t.
+func projectionFields(t reflect.Type) map[string][]int {
+	fieldIndex := make(map[string][]int)
+	var embedded []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("db")
+		if tag == "-" {
+			continue
 		}
 
-		// Append the model to the slice
-		sliceValue.Set(reflect.Append(sliceValue, modelElem))
+		// The exported fields of unexported embedded structs are promoted too
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct && !dialect.IsTimeType(field.Type) {
+			embedded = append(embedded, field)
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name := toSnakeCase(field.Name)
+		if parts := strings.Split(tag, ","); parts[0] != "" {
+			name = parts[0]
+		}
+		fieldIndex[strings.ToLower(name)] = field.Index
+	}
+
+	for _, field := range embedded {
+		for name, index := range projectionFields(field.Type) {
+			if _, ok := fieldIndex[name]; !ok {
+				fieldIndex[name] = append(append([]int(nil), field.Index...), index...)
+			}
+		}
+	}
+	return fieldIndex
+}
+
+// prefixedField resolves a column such as user_name, which matches no field
+// of the struct type t, to the index of a struct field named user and the
+// index of its field mapped to name
+func prefixedField(t reflect.Type, fieldIndex map[string][]int, column string) ([]int, []int, bool) {
+	column = strings.ToLower(column)
+
+	// Try longer names first so that user_profile_id prefers a user_profile
+	// field over a user field
+	names := make([]string, 0, len(fieldIndex))
+	for name := range fieldIndex {
+		names = append(names, name)
 	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
 
-	return rows.Err()
+	for _, name := range names {
+		rest, ok := strings.CutPrefix(column, name+"_")
+		if !ok || rest == "" {
+			continue
+		}
+		index := fieldIndex[name]
+
+		fieldType := t.FieldByIndex(index).Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() != reflect.Struct || dialect.IsTimeType(fieldType) || reflect.PtrTo(fieldType).Implements(scannerType) {
+			continue
+		}
+
+		if inner, ok := projectionFields(fieldType)[rest]; ok {
+			return index, inner, true
+		}
+	}
+	return nil, nil, false
+}
+
+// FindByExample finds the records whose columns equal the non-zero fields of
+// example. dest is either a pointer to a slice, filled like All, or a pointer
+// to a struct, filled with the first match like First. An example without
+// non-zero fields is rejected with ErrNoCondition unless the context was created
+// with AllowGlobal.
+func (c *Connection) FindByExample(ctx context.Context, dest interface{}, example interface{}) error {
+	info, err := c.modelInfo(ctx, example)
+	if err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(example)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	var conditions []string
+	var args []interface{}
+	for _, field := range info.Fields {
+		fieldValue := v.FieldByName(field.Name)
+		if isZeroValue(fieldValue) {
+			continue
+		}
+
+		value, err := c.fieldValue(field, fieldValue)
+		if err != nil {
+			return err
+		}
+
+		conditions = append(conditions, c.dialect.Quote(field.DBName)+" = ?")
+		args = append(args, value)
+	}
+
+	if len(conditions) == 0 && !globalAllowed(ctx) {
+		return WrapError(ErrNoCondition, "find by example %s", info.TableName)
+	}
+
+	condition := strings.Join(conditions, " AND ")
+
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() == reflect.Ptr && destValue.Elem().Kind() == reflect.Slice {
+		return c.All(ctx, dest, condition, args...)
+	}
+	return c.First(ctx, dest, condition, args...)
 }
@@ -0,0 +1,951 @@
+package sage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IMPHNEN/sage/internal/testdb"
+)
+
+func TestCreateResult(t *testing.T) {
+	c, db := newTestConnection(t, "mysql")
+	db.InsertID("INSERT INTO", 7)
+
+	user := &testUser{Name: "Ann", Email: "ann@example.com"}
+	result, err := c.CreateResult(context.Background(), user)
+	if err != nil {
+		t.Fatalf("CreateResult: %v", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		t.Fatalf("RowsAffected: %v", err)
+	}
+	if affected != 1 {
+		t.Errorf("RowsAffected = %d, want 1", affected)
+	}
+	if user.ID != 7 {
+		t.Errorf("ID = %d, want 7", user.ID)
+	}
+}
+
+func TestCountDistinctAndGroupCount(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	ctx := context.Background()
+
+	// Names of the stored users: Ann twice, Bob three times and Cy once
+	db.Returns(`COUNT(DISTINCT "name")`, []string{"count"}, []driver.Value{int64(3)})
+	db.Returns(`GROUP BY "name"`, []string{"name", "count"},
+		[]driver.Value{[]byte("Ann"), int64(2)},
+		[]driver.Value{[]byte("Bob"), int64(3)},
+		[]driver.Value{[]byte("Cy"), int64(1)},
+	)
+
+	distinct, err := c.CountDistinct(ctx, &testUser{}, "name", nil)
+	if err != nil {
+		t.Fatalf("CountDistinct: %v", err)
+	}
+	if distinct != 3 {
+		t.Errorf("CountDistinct = %d, want 3", distinct)
+	}
+
+	counts, err := c.GroupCount(ctx, &testUser{}, "name", "id > ?", 0)
+	if err != nil {
+		t.Fatalf("GroupCount: %v", err)
+	}
+	if want := map[interface{}]int64{"Ann": 2, "Bob": 3, "Cy": 1}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("GroupCount = %v, want %v", counts, want)
+	}
+
+	assertQueries(t, db,
+		`SELECT COUNT(DISTINCT "name") FROM users`,
+		`SELECT "name", COUNT(*) FROM users WHERE id > $1 GROUP BY "name"`,
+	)
+
+	if _, err := c.CountDistinct(ctx, &testUser{}, "name; DROP TABLE users", nil); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("CountDistinct with an unknown column = %v, want ErrInvalidArgument", err)
+	}
+	if _, err := c.GroupCount(ctx, &testUser{}, "nickname", nil); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("GroupCount with an unknown column = %v, want ErrInvalidArgument", err)
+	}
+}
+
+func TestCountQuery(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	db.Returns("SELECT COUNT(*) FROM (", []string{"count"}, []driver.Value{int64(2)})
+
+	qb := NewQueryBuilder("orders o").
+		Select("u.id", "COUNT(*)").
+		Join("JOIN users u ON u.id = o.user_id").
+		Where("o.total > ?", 5).
+		GroupBy("u.id").
+		OrderBy("u.id").
+		Limit(10).
+		Offset(20)
+
+	count, err := c.CountQuery(context.Background(), qb)
+	if err != nil {
+		t.Fatalf("CountQuery: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("CountQuery = %d, want 2", count)
+	}
+
+	statements := db.Statements()
+	want := "SELECT COUNT(*) FROM (SELECT u.id, COUNT(*) FROM orders o JOIN users u ON u.id = o.user_id WHERE o.total > $1 GROUP BY u.id) sage_count"
+	if len(statements) != 1 || statements[0].Query != want {
+		t.Fatalf("statements = %v, want %q", statements, want)
+	}
+	if !reflect.DeepEqual(statements[0].Args, []driver.Value{int64(5)}) {
+		t.Errorf("args = %v, want [5]", statements[0].Args)
+	}
+
+	// The builder keeps its ordering and pagination
+	if query, _ := qb.Build(); !strings.HasSuffix(query, "ORDER BY u.id LIMIT 10 OFFSET 20") {
+		t.Errorf("CountQuery changed the builder to %q", query)
+	}
+}
+
+func TestSelectJoinedProjection(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	db.Returns("JOIN users", []string{"id", "total", "user_name"},
+		[]driver.Value{int64(1), 9.5, []byte("Ann")},
+		[]driver.Value{int64(2), 20.0, []byte("Bob")},
+	)
+
+	type orderRow struct {
+		ID       int64   `db:"id"`
+		Total    float64 `db:"total"`
+		UserName string  `db:"user_name"`
+	}
+
+	qb := NewQueryBuilder("orders o").
+		Select("o.id", "o.total", "u.name AS user_name").
+		Join("JOIN users u ON u.id = o.user_id").
+		Where("o.total > ?", 5)
+
+	var rows []orderRow
+	if err := c.Select(context.Background(), &rows, qb); err != nil {
+		t.Fatalf("Select: %v", err)
+	}
+
+	want := []orderRow{{1, 9.5, "Ann"}, {2, 20, "Bob"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("Select = %+v, want %+v", rows, want)
+	}
+	assertQueries(t, db, "SELECT o.id, o.total, u.name AS user_name FROM orders o JOIN users u ON u.id = o.user_id WHERE o.total > $1")
+}
+
+func TestSelectEmbedsJoinedModel(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	db.Returns("LEFT JOIN users", []string{"id", "order", "item", "buyer_id", "buyer_name", "buyer_email"},
+		[]driver.Value{int64(1), int64(10), []byte("pen"), int64(3), []byte("Ann"), []byte("ann@example.com")},
+		[]driver.Value{int64(2), int64(11), []byte("ink"), nil, nil, nil},
+	)
+
+	type lineWithBuyer struct {
+		testLine
+		Buyer *testUser `db:"buyer"`
+	}
+
+	qb := NewQueryBuilder("lines l").
+		Select("l.*", "u.id AS buyer_id", "u.name AS buyer_name", "u.email AS buyer_email").
+		Join("LEFT JOIN users u ON u.id = l.buyer_id")
+
+	var rows []lineWithBuyer
+	if err := c.Select(context.Background(), &rows, qb); err != nil {
+		t.Fatalf("Select: %v", err)
+	}
+
+	want := []lineWithBuyer{
+		{testLine{ID: 1, Order: 10, Item: "pen"}, &testUser{ID: 3, Name: "Ann", Email: "ann@example.com"}},
+		// A LEFT JOIN without a match leaves the related model nil
+		{testLine{ID: 2, Order: 11, Item: "ink"}, nil},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("Select = %+v, want %+v", rows, want)
+	}
+}
+
+func TestSelectGroupedAggregate(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	db.Returns("GROUP BY", []string{"category", "total"},
+		[]driver.Value{[]byte("books"), 42.5},
+		[]driver.Value{[]byte("games"), nil},
+	)
+
+	type categoryTotal struct {
+		Category string  `db:"category"`
+		Total    float64 `db:"total"`
+	}
+
+	qb := NewQueryBuilder("sales").Select("category", "SUM(amount) AS total").GroupBy("category")
+
+	var totals []categoryTotal
+	if err := c.Select(context.Background(), &totals, qb); err != nil {
+		t.Fatalf("Select: %v", err)
+	}
+
+	// The SUM of a group without amounts is NULL and scans as zero
+	want := []categoryTotal{{"books", 42.5}, {"games", 0}}
+	if !reflect.DeepEqual(totals, want) {
+		t.Errorf("Select = %+v, want %+v", totals, want)
+	}
+	assertQueries(t, db, "SELECT category, SUM(amount) AS total FROM sales GROUP BY category")
+}
+
+func TestAllSliceDestinations(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	c.SetCache(&mapCache{}, time.Minute)
+	db.Returns("FROM users", []string{"id", "name", "email"},
+		[]driver.Value{int64(1), "Ann", "ann@example.com"},
+		[]driver.Value{int64(2), "Bob", "bob@example.com"},
+	)
+	ctx := context.Background()
+	want := []testUser{{1, "Ann", "ann@example.com"}, {2, "Bob", "bob@example.com"}}
+
+	var values []testUser
+	if err := c.All(ctx, &values, nil); err != nil {
+		t.Fatalf("All into []testUser: %v", err)
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("All into []testUser = %+v, want %+v", values, want)
+	}
+
+	// The second read is served from the cache
+	for i := 0; i < 2; i++ {
+		var pointers []*testUser
+		if err := c.All(ctx, &pointers, "id > ?", 0); err != nil {
+			t.Fatalf("All into []*testUser: %v", err)
+		}
+		if len(pointers) != 2 || *pointers[0] != want[0] || *pointers[1] != want[1] {
+			t.Fatalf("All into []*testUser = %+v, want %+v", pointers, want)
+		}
+
+		// Changing a result does not change the cached models
+		pointers[0].Name = "changed"
+	}
+	if got := len(db.Queries()); got != 2 {
+		t.Errorf("ran %d queries, want the pointer read cached", got)
+	}
+}
+
+func TestAllStopsOnCancellation(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	read := 0
+	db.ReturnsFunc("FROM users", []string{"id", "name", "email"}, 10000, func(i int) []driver.Value {
+		read++
+		if i == 2 {
+			cancel()
+		}
+		return []driver.Value{int64(i + 1), "user", "user@example.com"}
+	})
+
+	var users []testUser
+	err := c.All(ctx, &users, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("All = %v, want context.Canceled", err)
+	}
+	if read > 10 {
+		t.Errorf("read %d rows after cancellation, want an early return", read)
+	}
+}
+
+func TestUpdateExcept(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+
+	user := &testUser{ID: 3, Name: "Ann", Email: "ann@example.com"}
+	if err := c.UpdateExcept(context.Background(), user, "email"); err != nil {
+		t.Fatalf("UpdateExcept: %v", err)
+	}
+	assertQueries(t, db, "UPDATE users SET name = $1 WHERE id = $2")
+
+	if err := c.UpdateExcept(context.Background(), user, "password"); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("UpdateExcept with an unknown column = %v, want ErrInvalidArgument", err)
+	}
+}
+
+// testProfile has a nullable column
+type testProfile struct {
+	ID       int64   `db:"id,pk,auto"`
+	Nickname *string `db:"nickname,nullable"`
+}
+
+func (testProfile) TableName() string  { return "profiles" }
+func (testProfile) PrimaryKey() string { return "id" }
+
+func TestUpdateSetsNull(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	ctx := context.Background()
+
+	nickname := "annie"
+	profile := &testProfile{ID: 1, Nickname: &nickname}
+	if err := c.Update(ctx, profile); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	// Clear the previously set column
+	profile.Nickname = nil
+	if err := c.Update(ctx, profile); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := c.UpdateMap(ctx, &testProfile{}, map[string]interface{}{"nickname": nil}, "id = ?", 1); err != nil {
+		t.Fatalf("UpdateMap: %v", err)
+	}
+
+	statements := db.Statements()
+	if len(statements) != 3 {
+		t.Fatalf("got %d statements, want 3", len(statements))
+	}
+	if got := statements[0].Args[0]; got != "annie" {
+		t.Errorf("set nickname = %v, want annie", got)
+	}
+	for _, statement := range statements[1:] {
+		if statement.Query != "UPDATE profiles SET nickname = $1 WHERE id = $2" || statement.Args[0] != nil {
+			t.Errorf("statement %q with %v does not set nickname to NULL", statement.Query, statement.Args)
+		}
+	}
+}
+
+// testSetting has a primary key that is not auto-increment
+type testSetting struct {
+	Key   string `db:"key,pk"`
+	Value string `db:"value"`
+}
+
+func (testSetting) TableName() string  { return "settings" }
+func (testSetting) PrimaryKey() string { return "key" }
+
+func TestSave(t *testing.T) {
+	c, db := newTestConnection(t, "mysql")
+	ctx := context.Background()
+	db.InsertID("INSERT INTO users", 5)
+
+	// A zero primary key inserts
+	user := &testUser{Name: "Ann"}
+	if err := c.Save(ctx, user); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if user.ID != 5 {
+		t.Errorf("ID = %d, want 5", user.ID)
+	}
+
+	// A set primary key updates
+	user.Name = "Anne"
+	if err := c.Save(ctx, user); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	assertQueries(t, db,
+		"INSERT INTO users (name, email) VALUES (?, ?)",
+		"UPDATE users SET name = ?, email = ? WHERE id = ?",
+	)
+
+	// A set key that is not auto-increment inserts when no row matches
+	db.Reset()
+	db.Affects("UPDATE settings", 0)
+	if err := c.Save(ctx, &testSetting{Key: "theme", Value: "dark"}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	assertQueries(t, db,
+		"UPDATE settings SET value = ? WHERE key = ?",
+		"SELECT 1 FROM `settings` WHERE `key` = ? LIMIT 1",
+		"INSERT INTO settings (key, value) VALUES (?, ?)",
+	)
+
+	// MySQL reports no affected rows for an unchanged row, which exists
+	db.Reset()
+	db.Affects("UPDATE settings", 0)
+	db.Returns("SELECT 1 FROM", []string{"1"}, []driver.Value{int64(1)})
+	if err := c.Save(ctx, &testSetting{Key: "theme", Value: "dark"}); err != nil {
+		t.Fatalf("Save of an unchanged row: %v", err)
+	}
+	assertQueries(t, db,
+		"UPDATE settings SET value = ? WHERE key = ?",
+		"SELECT 1 FROM `settings` WHERE `key` = ? LIMIT 1",
+	)
+}
+
+func TestFindByExample(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	ctx := context.Background()
+	db.Returns("FROM users", []string{"id", "name", "email"}, []driver.Value{int64(2), "Ann", "ann@example.com"})
+
+	var users []testUser
+	if err := c.FindByExample(ctx, &users, &testUser{Name: "Ann", Email: "ann@example.com"}); err != nil {
+		t.Fatalf("FindByExample: %v", err)
+	}
+	if len(users) != 1 || users[0].ID != 2 {
+		t.Errorf("FindByExample = %+v, want user 2", users)
+	}
+
+	statements := db.Statements()
+	if want := `SELECT * FROM users WHERE "name" = $1 AND "email" = $2`; statements[0].Query != want {
+		t.Errorf("query = %q, want %q", statements[0].Query, want)
+	}
+	if want := []driver.Value{"Ann", "ann@example.com"}; !reflect.DeepEqual(statements[0].Args, want) {
+		t.Errorf("args = %v, want %v", statements[0].Args, want)
+	}
+
+	if err := c.FindByExample(ctx, &users, &testUser{}); !errors.Is(err, ErrNoCondition) {
+		t.Errorf("FindByExample with a zero example = %v, want ErrNoCondition", err)
+	}
+}
+
+// wideRow is a model with 20 columns
+type wideRow struct {
+	ID  int64  `db:"id,pk,auto"`
+	C01 string `db:"c01"`
+	C02 string `db:"c02"`
+	C03 string `db:"c03"`
+	C04 string `db:"c04"`
+	C05 string `db:"c05"`
+	C06 string `db:"c06"`
+	C07 string `db:"c07"`
+	C08 string `db:"c08"`
+	C09 string `db:"c09"`
+	C10 int64  `db:"c10"`
+	C11 int64  `db:"c11"`
+	C12 int64  `db:"c12"`
+	C13 int64  `db:"c13"`
+	C14 int64  `db:"c14"`
+	C15 int64  `db:"c15"`
+	C16 int64  `db:"c16"`
+	C17 int64  `db:"c17"`
+	C18 int64  `db:"c18"`
+	C19 int64  `db:"c19"`
+}
+
+func (wideRow) TableName() string  { return "wide_rows" }
+func (wideRow) PrimaryKey() string { return "id" }
+
+func BenchmarkAllWideRows(b *testing.B) {
+	db := testdb.New()
+	c, err := NewConnection(ConnectionOptions{Driver: "postgres", DSN: db.DSN()})
+	if err != nil {
+		b.Fatalf("NewConnection: %v", err)
+	}
+	defer c.Close()
+
+	info, err := extractModelInfo(&wideRow{})
+	if err != nil {
+		b.Fatalf("extractModelInfo: %v", err)
+	}
+	columns := make([]string, len(info.Fields))
+	row := make([]driver.Value, len(info.Fields))
+	for i, field := range info.Fields {
+		// Column names differ in case from the tags, as some drivers report them
+		columns[i] = strings.ToUpper(field.DBName)
+		if field.Type.Kind() == reflect.String {
+			row[i] = "value"
+		} else {
+			row[i] = int64(i)
+		}
+	}
+	db.ReturnsFunc("FROM wide_rows", columns, 10000, func(int) []driver.Value { return row })
+
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var rows []wideRow
+		if err := c.All(ctx, &rows, nil); err != nil {
+			b.Fatalf("All: %v", err)
+		}
+		if len(rows) != 10000 || rows[0].C19 != 19 {
+			b.Fatalf("All returned %d rows", len(rows))
+		}
+	}
+}
+
+// testAttachment has columns whose scanned values could leak between rows
+type testAttachment struct {
+	ID      int64   `db:"id,pk,auto"`
+	Data    []byte  `db:"data"`
+	Caption *string `db:"caption,nullable"`
+}
+
+func (testAttachment) TableName() string  { return "attachments" }
+func (testAttachment) PrimaryKey() string { return "id" }
+
+func TestAllKeepsRowsApart(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	db.Returns("FROM attachments", []string{"id", "data", "caption"},
+		[]driver.Value{int64(1), []byte("one"), []byte("first")},
+		[]driver.Value{int64(2), []byte("two"), nil},
+		[]driver.Value{int64(3), nil, []byte("third")},
+	)
+
+	var attachments []testAttachment
+	if err := c.All(context.Background(), &attachments, nil); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	if len(attachments) != 3 {
+		t.Fatalf("got %d attachments, want 3", len(attachments))
+	}
+
+	// Writing to one row's values must not show in another
+	attachments[0].Data[0] = 'X'
+	*attachments[0].Caption = "changed"
+
+	if got := string(attachments[1].Data); got != "two" {
+		t.Errorf("second Data = %q, want two", got)
+	}
+	if attachments[1].Caption != nil {
+		t.Errorf("second Caption = %q, want nil after a NULL", *attachments[1].Caption)
+	}
+	if attachments[2].Data != nil {
+		t.Errorf("third Data = %q, want nil after a NULL", attachments[2].Data)
+	}
+	if attachments[2].Caption == nil || *attachments[2].Caption != "third" {
+		t.Errorf("third Caption = %v, want third", attachments[2].Caption)
+	}
+}
+
+func TestBulkWritesRequireCondition(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	ctx := context.Background()
+
+	if _, err := c.DeleteWhere(ctx, &testUser{}, ""); !errors.Is(err, ErrNoCondition) {
+		t.Errorf("DeleteWhere without a condition = %v, want ErrNoCondition", err)
+	}
+	if _, err := c.UpdateMap(ctx, &testUser{}, map[string]interface{}{"name": "x"}, " "); !errors.Is(err, ErrNoCondition) {
+		t.Errorf("UpdateMap without a condition = %v, want ErrNoCondition", err)
+	}
+	if queries := db.Queries(); len(queries) != 0 {
+		t.Fatalf("rejected writes ran %q", queries)
+	}
+
+	global := AllowGlobal(ctx)
+	if _, err := c.DeleteWhere(global, &testUser{}, ""); err != nil {
+		t.Errorf("DeleteWhere with AllowGlobal: %v", err)
+	}
+	if _, err := c.UpdateMap(global, &testUser{}, map[string]interface{}{"name": "x"}, ""); err != nil {
+		t.Errorf("UpdateMap with AllowGlobal: %v", err)
+	}
+	assertQueries(t, db, "DELETE FROM users", "UPDATE users SET name = $1")
+}
+
+// testVisit sets no columns when its note is empty
+type testVisit struct {
+	ID   int64  `db:"id,pk,auto"`
+	Note string `db:"note,omitempty"`
+}
+
+func (testVisit) TableName() string  { return "visits" }
+func (testVisit) PrimaryKey() string { return "id" }
+
+func TestCreateDefaultValues(t *testing.T) {
+	tests := []struct {
+		driver string
+		query  string
+	}{
+		{"postgres", `INSERT INTO "visits" DEFAULT VALUES RETURNING "note", "id"`},
+		{"mysql", "INSERT INTO `visits` () VALUES ()"},
+		{"sqlite", `INSERT INTO "visits" DEFAULT VALUES RETURNING "note", "id"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			c, db := newTestConnection(t, tt.driver)
+			db.InsertID("INSERT INTO", 4)
+			db.Returns("DEFAULT VALUES", []string{"note", "id"}, []driver.Value{"", int64(4)})
+
+			visit := &testVisit{}
+			if err := c.Create(context.Background(), visit); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if visit.ID != 4 {
+				t.Errorf("ID = %d, want 4", visit.ID)
+			}
+
+			statements := db.Statements()
+			if len(statements) != 1 || statements[0].Query != tt.query || len(statements[0].Args) != 0 {
+				t.Errorf("statements = %v, want %q without args", statements, tt.query)
+			}
+		})
+	}
+}
+
+// testSession has a primary key generated by the database
+type testSession struct {
+	ID     string `db:"id,pk,type:uuid,default_expr:gen_random_uuid()"`
+	UserID int64  `db:"user_id"`
+}
+
+func (testSession) TableName() string  { return "sessions" }
+func (testSession) PrimaryKey() string { return "id" }
+
+func TestCreateReadsGeneratedDefaults(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	const id = "6f1c1a8e-2b7d-4c55-9a43-0d3e1f6b8c21"
+	db.Returns("RETURNING", []string{"id"}, []driver.Value{[]byte(id)})
+
+	session := &testSession{UserID: 3}
+	if err := c.Create(context.Background(), session); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if session.ID != id {
+		t.Errorf("ID = %q, want the generated %q", session.ID, id)
+	}
+	assertQueries(t, db, `INSERT INTO sessions (user_id) VALUES ($1) RETURNING "id"`)
+
+	// A set value is inserted instead of the default
+	db.Reset()
+	session = &testSession{ID: id, UserID: 3}
+	if err := c.Create(context.Background(), session); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	assertQueries(t, db, "INSERT INTO sessions (id, user_id) VALUES ($1, $2)")
+}
+
+func TestFindAll(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	db.Returns(`"id" IN (`, []string{"id", "name", "email"},
+		[]driver.Value{int64(3), "Cid", "cid@example.com"},
+		[]driver.Value{int64(1), "Ann", "ann@example.com"},
+		[]driver.Value{int64(2), "Bob", "bob@example.com"},
+	)
+
+	var users []*testUser
+	if err := c.FindAll(context.Background(), &users, []interface{}{1, 2, 3}); err != nil {
+		t.Fatalf("FindAll: %v", err)
+	}
+	assertQueries(t, db, `SELECT * FROM users WHERE "id" IN ($1, $2, $3)`)
+
+	found := map[int64]string{}
+	for _, user := range users {
+		found[user.ID] = user.Name
+	}
+	if want := map[int64]string{1: "Ann", 2: "Bob", 3: "Cid"}; !reflect.DeepEqual(found, want) {
+		t.Errorf("found %v, want %v", found, want)
+	}
+}
+
+func TestFindAllSplitsLargeIDLists(t *testing.T) {
+	c, db := newTestConnection(t, "sqlite")
+
+	ids := make([]interface{}, 1500)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	var users []testUser
+	if err := c.FindAll(context.Background(), &users, ids); err != nil {
+		t.Fatalf("FindAll: %v", err)
+	}
+
+	statements := db.Statements()
+	if len(statements) != 2 {
+		t.Fatalf("got %d statements, want 2", len(statements))
+	}
+	if len(statements[0].Args) != 999 || len(statements[1].Args) != 501 {
+		t.Errorf("chunks bind %d and %d ids, want 999 and 501", len(statements[0].Args), len(statements[1].Args))
+	}
+}
+
+func TestFindAllThroughTempTable(t *testing.T) {
+	c, db := openTestConnection(t, ConnectionOptions{Driver: "postgres", TempTableThreshold: 500})
+	ctx := context.Background()
+	db.Returns(`SELECT * FROM users WHERE "id" IN (SELECT "id" FROM "sage_find_ids")`, []string{"id", "name", "email"},
+		[]driver.Value{int64(7), "Ann", "ann@example.com"},
+		[]driver.Value{int64(900), "Bob", "bob@example.com"},
+	)
+
+	ids := make([]interface{}, 1200)
+	values := make([]driver.Value, len(ids))
+	for i := range ids {
+		ids[i], values[i] = int64(i+1), int64(i+1)
+	}
+	var users []testUser
+	if err := c.FindAll(ctx, &users, ids); err != nil {
+		t.Fatalf("FindAll: %v", err)
+	}
+	if len(users) != 2 || users[0].ID != 7 || users[1].ID != 900 {
+		t.Errorf("users = %+v, want 7 and 900", users)
+	}
+
+	statements := db.Statements()
+	want := []string{
+		"BEGIN",
+		`CREATE TEMPORARY TABLE "sage_find_ids" ("id" BIGINT)`,
+		`INSERT INTO "sage_find_ids" ("id") VALUES ($1), `,
+		`SELECT * FROM users WHERE "id" IN (SELECT "id" FROM "sage_find_ids")`,
+		`DROP TABLE IF EXISTS "sage_find_ids"`,
+		"COMMIT",
+	}
+	if len(statements) != len(want) {
+		t.Fatalf("queries = %q, want %d statements", db.Queries(), len(want))
+	}
+	for i, statement := range statements {
+		if !strings.HasPrefix(statement.Query, want[i]) {
+			t.Errorf("statement %d = %q, want %q", i, statement.Query, want[i])
+		}
+	}
+	if !reflect.DeepEqual(statements[2].Args, values) {
+		t.Errorf("inserted %d ids, want all %d in order", len(statements[2].Args), len(ids))
+	}
+
+	// Lists within the threshold still bind their ids
+	db.Reset()
+	if err := c.FindAll(ctx, &users, ids[:500]); err != nil {
+		t.Fatalf("FindAll: %v", err)
+	}
+	if queries := db.Queries(); len(queries) != 1 || !strings.HasPrefix(queries[0], `SELECT * FROM users WHERE "id" IN ($1, `) {
+		t.Errorf("queries = %q, want one IN query", queries)
+	}
+}
+
+// testDocument has a timestamp stamped on every update
+type testDocument struct {
+	ID        int64     `db:"id,pk,auto"`
+	Title     string    `db:"title"`
+	UpdatedAt time.Time `db:"updated_at,onupdate_now"`
+}
+
+func (testDocument) TableName() string  { return "documents" }
+func (testDocument) PrimaryKey() string { return "id" }
+
+func TestUpdateStampsOnUpdateNow(t *testing.T) {
+	ctx := context.Background()
+
+	// PostgreSQL cannot stamp the column, so updates set it
+	c, db := newTestConnection(t, "postgres")
+	before := time.Now()
+	document := &testDocument{ID: 1, Title: "Draft"}
+	if err := c.Update(ctx, document); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := c.UpdateMap(ctx, &testDocument{}, map[string]interface{}{"title": "Final"}, "id = ?", 1); err != nil {
+		t.Fatalf("UpdateMap: %v", err)
+	}
+	assertQueries(t, db,
+		"UPDATE documents SET title = $1, updated_at = $2 WHERE id = $3",
+		"UPDATE documents SET title = $1, updated_at = $2 WHERE id = $3",
+	)
+	for _, statement := range db.Statements() {
+		if stamp, ok := statement.Args[1].(time.Time); !ok || stamp.Before(before) {
+			t.Errorf("updated_at = %v, want the current time", statement.Args[1])
+		}
+	}
+	if document.UpdatedAt.Before(before) {
+		t.Errorf("model UpdatedAt = %v, want the stamped time", document.UpdatedAt)
+	}
+
+	// MySQL stamps the column itself through ON UPDATE CURRENT_TIMESTAMP
+	c, db = newTestConnection(t, "mysql")
+	if err := c.Update(ctx, &testDocument{ID: 1, Title: "Draft"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := c.UpdateMap(ctx, &testDocument{}, map[string]interface{}{"title": "Final"}, "id = ?", 1); err != nil {
+		t.Fatalf("UpdateMap: %v", err)
+	}
+	assertQueries(t, db,
+		"UPDATE documents SET title = ? WHERE id = ?",
+		"UPDATE documents SET title = ? WHERE id = ?",
+	)
+}
+
+func TestRefresh(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	c.SetCache(&mapCache{}, time.Minute)
+	ctx := context.Background()
+	db.Returns("FROM users", []string{"id", "name", "email"}, []driver.Value{int64(4), "Ann", "ann@example.com"})
+
+	user := &testUser{}
+	if err := c.Find(ctx, user, 4); err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+
+	// Another client changes the row behind the cache's back
+	db.Returns("FROM users", []string{"id", "name", "email"}, []driver.Value{int64(4), "Ann", "ann@example.org"})
+	db.Reset()
+	if err := c.Refresh(ctx, user); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if user.Email != "ann@example.org" {
+		t.Errorf("Email = %q after Refresh, want ann@example.org", user.Email)
+	}
+	assertQueries(t, db, "SELECT * FROM users WHERE id = $1")
+	if args := db.Statements()[0].Args; len(args) != 1 || args[0] != int64(4) {
+		t.Errorf("args = %v, want [4]", args)
+	}
+
+	// The row is deleted
+	db.Returns("FROM users", []string{"id", "name", "email"})
+	if err := c.Refresh(ctx, user); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Refresh of a deleted row = %v, want ErrNotFound", err)
+	}
+}
+
+// testEntry has columns that must not change after insert
+type testEntry struct {
+	ID        int64     `db:"id,pk,auto"`
+	TenantID  int64     `db:"tenant_id,immutable"`
+	CreatedAt time.Time `db:"created_at,immutable"`
+	Body      string    `db:"body"`
+}
+
+func (testEntry) TableName() string  { return "entries" }
+func (testEntry) PrimaryKey() string { return "id" }
+
+func TestImmutableColumns(t *testing.T) {
+	c, db := newTestConnection(t, "mysql")
+	db.InsertID("INSERT INTO", 1)
+	ctx := context.Background()
+
+	entry := &testEntry{TenantID: 7, CreatedAt: time.Now(), Body: "draft"}
+	if err := c.Create(ctx, entry); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	entry.TenantID, entry.Body = 8, "final"
+	if err := c.Update(ctx, entry); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	assertQueries(t, db,
+		"INSERT INTO entries (tenant_id, created_at, body) VALUES (?, ?, ?)",
+		"UPDATE entries SET body = ? WHERE id = ?",
+	)
+
+	if err := c.UpdateColumns(ctx, entry, "tenant_id"); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("UpdateColumns of an immutable column = %v, want ErrInvalidArgument", err)
+	}
+	if _, err := c.UpdateMap(ctx, &testEntry{}, map[string]interface{}{"created_at": time.Now()}, "id = ?", 1); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("UpdateMap of an immutable column = %v, want ErrInvalidArgument", err)
+	}
+	if err := c.UpsertBatch(ctx, []*testEntry{entry}, []string{"id"}, []string{"tenant_id"}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("UpsertBatch updating an immutable column = %v, want ErrInvalidArgument", err)
+	}
+	if n := len(db.Queries()); n != 2 {
+		t.Errorf("ran %d statements, want only the insert and update", n)
+	}
+}
+
+// testContact has columns left to the database when empty
+type testContact struct {
+	ID         int64  `db:"id,pk,auto"`
+	FirstName  string `db:"first_name"`
+	MiddleName string `db:"middle_name,omitempty"`
+	Age        int    `db:"age,omitempty"`
+}
+
+func (testContact) TableName() string  { return "contacts" }
+func (testContact) PrimaryKey() string { return "id" }
+
+func TestCreateOmitsEmptyFields(t *testing.T) {
+	c, db := newTestConnection(t, "mysql")
+	db.InsertID("INSERT INTO", 1)
+	ctx := context.Background()
+
+	if err := c.Create(ctx, &testContact{FirstName: "Ann"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := c.Create(ctx, &testContact{FirstName: "Bob", MiddleName: "J", Age: 40}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	assertQueries(t, db,
+		"INSERT INTO contacts (first_name) VALUES (?)",
+		"INSERT INTO contacts (first_name, middle_name, age) VALUES (?, ?, ?)",
+	)
+
+	// Updates set empty fields like any other
+	db.Reset()
+	if err := c.Update(ctx, &testContact{ID: 1, FirstName: "Ann"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	assertQueries(t, db, "UPDATE contacts SET first_name = ?, middle_name = ?, age = ? WHERE id = ?")
+}
+
+func TestDeleteReturning(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	ctx := context.Background()
+	// The rule added last answers first
+	db.ReturnsOnce("DELETE FROM users", []string{"email"}, []driver.Value{"bob@example.com"})
+	db.ReturnsOnce("DELETE FROM users", []string{"id", "name", "email"}, []driver.Value{int64(3), "Ann", "ann@example.com"})
+
+	user := &testUser{ID: 3}
+	if err := c.DeleteReturning(ctx, user); err != nil {
+		t.Fatalf("DeleteReturning: %v", err)
+	}
+	if want := (testUser{ID: 3, Name: "Ann", Email: "ann@example.com"}); *user != want {
+		t.Errorf("deleted user = %+v, want %+v", *user, want)
+	}
+
+	other := &testUser{ID: 4}
+	if err := c.DeleteReturning(ctx, other, "email"); err != nil {
+		t.Fatalf("DeleteReturning: %v", err)
+	}
+	if other.Email != "bob@example.com" || other.Name != "" {
+		t.Errorf("deleted user = %+v, want only the email read back", *other)
+	}
+
+	// No row was deleted
+	if err := c.DeleteReturning(ctx, &testUser{ID: 5}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteReturning of a missing row = %v, want ErrNotFound", err)
+	}
+	assertQueries(t, db,
+		`DELETE FROM users WHERE id = $1 RETURNING "id", "name", "email"`,
+		`DELETE FROM users WHERE id = $1 RETURNING "email"`,
+		`DELETE FROM users WHERE id = $1 RETURNING "id", "name", "email"`,
+	)
+
+	if err := c.DeleteReturning(ctx, user, "password"); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("DeleteReturning of an unknown column = %v, want ErrInvalidArgument", err)
+	}
+
+	m, mdb := newTestConnection(t, "mysql")
+	if err := m.DeleteReturning(ctx, &testUser{ID: 3}); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("DeleteReturning on MySQL = %v, want ErrInvalidOperation", err)
+	}
+	if queries := mdb.Queries(); len(queries) != 0 {
+		t.Errorf("MySQL ran %q", queries)
+	}
+}
+
+func TestEachGroup(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	ctx := context.Background()
+	db.Returns("SELECT status, COUNT(*) AS total FROM orders GROUP BY status", []string{"status", "total"},
+		[]driver.Value{[]byte("open"), int64(3)},
+		[]driver.Value{"paid", int64(5)},
+		[]driver.Value{"void", int64(1)},
+	)
+	qb := NewQueryBuilder("orders").Select("status", "COUNT(*) AS total").GroupBy("status")
+
+	seen := map[string]int64{}
+	err := c.EachGroup(ctx, qb, func(row map[string]interface{}) error {
+		status, ok := row["status"].(string)
+		if !ok {
+			t.Fatalf("status is %T, want string", row["status"])
+		}
+		if _, dup := seen[status]; dup {
+			t.Errorf("group %q seen twice", status)
+		}
+		seen[status] = row["total"].(int64)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("EachGroup: %v", err)
+	}
+	if want := map[string]int64{"open": 3, "paid": 5, "void": 1}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("groups = %v, want %v", seen, want)
+	}
+
+	// An error from the callback stops the iteration
+	stop := errors.New("stop")
+	var calls int
+	err = c.EachGroup(ctx, qb, func(map[string]interface{}) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("EachGroup = %v after %d calls, want stop after 1", err, calls)
+	}
+}
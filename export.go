@@ -0,0 +1,199 @@
+package sage
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Data formats supported by Export and Import
+const (
+	// FormatCSV is comma-separated values with a header row of column names
+	FormatCSV = "csv"
+	// FormatJSON is a JSON array of objects keyed by column name
+	FormatJSON = "json"
+)
+
+// Export writes every row of the model's table to w in the given format,
+// streaming rows as they are read
+func (c *Connection) Export(ctx context.Context, model interface{}, w io.Writer, format string) error {
+	info, err := c.modelInfo(ctx, model)
+	if err != nil {
+		return err
+	}
+
+	qb := NewQueryBuilder(info.TableName).Select()
+	c.applyScopes(ctx, qb, info)
+
+	return c.ExportQuery(ctx, qb, w, format)
+}
+
+// ExportQuery writes the rows selected by the query builder to w in the given
+// format, streaming rows as they are read
+func (c *Connection) ExportQuery(ctx context.Context, qb *QueryBuilder, w io.Writer, format string) error {
+	var write func(columns []string, values []interface{}) error
+	var finish func() error
+
+	switch strings.ToLower(format) {
+	case FormatCSV:
+		write, finish = csvExporter(w)
+	case FormatJSON:
+		write, finish = jsonExporter(w)
+	default:
+		return WrapError(ErrInvalidArgument, "export %s: unsupported format %q", qb.table, format)
+	}
+
+	query, args := qb.Build()
+
+	rows, err := c.query(ctx, query, args...)
+	if err != nil {
+		return WrapError(err, "export %s", qb.table)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return WrapError(err, "export %s", qb.table)
+	}
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	// A header is written even when no rows match
+	if err := write(columns, nil); err != nil {
+		return WrapError(err, "export %s", qb.table)
+	}
+
+	for rows.Next() {
+		// Stop promptly if the context has been cancelled
+		if err := ctx.Err(); err != nil {
+			return WrapError(err, "export %s", qb.table)
+		}
+
+		if err := rows.Scan(pointers...); err != nil {
+			return WrapError(err, "export %s", qb.table)
+		}
+		if err := write(columns, values); err != nil {
+			return WrapError(err, "export %s", qb.table)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return WrapError(err, "export %s", qb.table)
+	}
+
+	return WrapError(finish(), "export %s", qb.table)
+}
+
+// csvExporter writes a header row of column names followed by a record per row
+func csvExporter(w io.Writer) (func([]string, []interface{}) error, func() error) {
+	cw := csv.NewWriter(w)
+	var record []string
+
+	write := func(columns []string, values []interface{}) error {
+		if values == nil {
+			return cw.Write(columns)
+		}
+
+		record = record[:0]
+		for _, value := range values {
+			record = append(record, csvValue(value))
+		}
+		return cw.Write(record)
+	}
+
+	finish := func() error {
+		cw.Flush()
+		return cw.Error()
+	}
+
+	return write, finish
+}
+
+// csvValue formats a scanned value as a CSV field. NULL is an empty field.
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// jsonExporter writes a JSON array with an object per row
+func jsonExporter(w io.Writer) (func([]string, []interface{}) error, func() error) {
+	bw := bufio.NewWriter(w)
+	rowCount := 0
+
+	write := func(columns []string, values []interface{}) error {
+		if values == nil {
+			_, err := bw.WriteString("[")
+			return err
+		}
+
+		if rowCount > 0 {
+			if _, err := bw.WriteString(","); err != nil {
+				return err
+			}
+		}
+		rowCount++
+
+		// Keep the columns in query order rather than sorted like a map
+		bw.WriteString("{")
+		for i, column := range columns {
+			if i > 0 {
+				bw.WriteString(",")
+			}
+
+			name, err := json.Marshal(column)
+			if err != nil {
+				return err
+			}
+
+			value := values[i]
+			if b, ok := value.([]byte); ok {
+				value = string(b)
+			}
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+
+			bw.Write(name)
+			bw.WriteString(":")
+			bw.Write(encoded)
+		}
+		_, err := bw.WriteString("}")
+		return err
+	}
+
+	finish := func() error {
+		if _, err := bw.WriteString("]\n"); err != nil {
+			return err
+		}
+		return bw.Flush()
+	}
+
+	return write, finish
+}
@@ -0,0 +1,49 @@
+package sage
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	db.Returns("FROM users", []string{"id", "name", "email"},
+		[]driver.Value{int64(1), "Ann", "ann@example.com"},
+		[]driver.Value{int64(2), []byte(`Bob "B", Jr`), nil},
+	)
+	ctx := context.Background()
+
+	var csv bytes.Buffer
+	if err := c.Export(ctx, &testUser{}, &csv, FormatCSV); err != nil {
+		t.Fatalf("Export to CSV: %v", err)
+	}
+	want := "id,name,email\n1,Ann,ann@example.com\n2,\"Bob \"\"B\"\", Jr\",\n"
+	if csv.String() != want {
+		t.Errorf("CSV = %q, want %q", csv.String(), want)
+	}
+
+	var json bytes.Buffer
+	if err := c.Export(ctx, &testUser{}, &json, FormatJSON); err != nil {
+		t.Fatalf("Export to JSON: %v", err)
+	}
+	want = `[{"id":1,"name":"Ann","email":"ann@example.com"},{"id":2,"name":"Bob \"B\", Jr","email":null}]` + "\n"
+	if json.String() != want {
+		t.Errorf("JSON = %q, want %q", json.String(), want)
+	}
+
+	// An empty result still has a header
+	var empty bytes.Buffer
+	if err := c.ExportQuery(ctx, NewQueryBuilder("tags").Select("id", "name"), &empty, FormatJSON); err != nil {
+		t.Fatalf("ExportQuery: %v", err)
+	}
+	if empty.String() != "[]\n" {
+		t.Errorf("empty JSON = %q, want []", empty.String())
+	}
+
+	if err := c.Export(ctx, &testUser{}, &bytes.Buffer{}, "xml"); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Export to XML = %v, want ErrInvalidArgument", err)
+	}
+}
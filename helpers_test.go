@@ -0,0 +1,76 @@
+package sage
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IMPHNEN/sage/internal/testdb"
+)
+
+// testUser is the model most tests store
+type testUser struct {
+	ID    int64  `db:"id,pk,auto"`
+	Name  string `db:"name"`
+	Email string `db:"email"`
+}
+
+// TableName returns the table of test users
+func (testUser) TableName() string { return "users" }
+
+// PrimaryKey returns the primary key column of test users
+func (testUser) PrimaryKey() string { return "id" }
+
+// newTestConnection opens a connection with the driver to a new fake database
+func newTestConnection(t *testing.T, driver string) (*Connection, *testdb.DB) {
+	t.Helper()
+	return openTestConnection(t, ConnectionOptions{Driver: driver})
+}
+
+// openTestConnection opens a connection with the options to a new fake
+// database
+func openTestConnection(t *testing.T, opts ConnectionOptions) (*Connection, *testdb.DB) {
+	t.Helper()
+
+	db := testdb.New()
+	opts.DSN = db.DSN()
+
+	c, err := NewConnection(opts)
+	if err != nil {
+		t.Fatalf("NewConnection: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c, db
+}
+
+// assertQueries checks the statements received by the fake database
+func assertQueries(t *testing.T, db *testdb.DB, want ...string) {
+	t.Helper()
+	if got := db.Queries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("queries:\n got %q\nwant %q", got, want)
+	}
+}
+
+// mapCache is a Cache keeping entries in a map without expiry
+type mapCache struct {
+	mu      sync.Mutex
+	entries map[string]interface{}
+}
+
+func (m *mapCache) Get(key string) (interface{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.entries[key]
+	return value, ok
+}
+
+func (m *mapCache) Set(key string, value interface{}, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.entries == nil {
+		m.entries = make(map[string]interface{})
+	}
+	m.entries[key] = value
+}
@@ -0,0 +1,278 @@
+package sage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/IMPHNEN/sage/internal/dialect"
+)
+
+// DefaultImportBatchSize is the number of rows Import inserts per CreateBatch
+// call when ImportOptions.BatchSize is not set
+const DefaultImportBatchSize = 1000
+
+// ImportOptions configures Import
+type ImportOptions struct {
+	// BatchSize is the number of rows inserted per CreateBatch call
+	BatchSize int
+}
+
+// importTimeLayouts are the layouts tried when parsing timestamps, starting
+// with the one Export writes
+var importTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// Import reads rows in the given format from r and inserts them into the
+// model's table with CreateBatch, returning the number of rows inserted. CSV
+// input starts with a header row of column names; JSON input is an array of
+// objects keyed by column name. Values are converted to the types of the
+// model fields and empty CSV fields and JSON nulls leave fields unset.
+func (c *Connection) Import(ctx context.Context, model interface{}, r io.Reader, format string, opts ...ImportOptions) (int64, error) {
+	info, err := c.modelInfo(ctx, model)
+	if err != nil {
+		return 0, err
+	}
+
+	modelType := reflect.TypeOf(model)
+	if modelType.Kind() == reflect.Ptr {
+		modelType = modelType.Elem()
+	}
+
+	batchSize := DefaultImportBatchSize
+	for _, opt := range opts {
+		if opt.BatchSize > 0 {
+			batchSize = opt.BatchSize
+		}
+	}
+
+	var read func(next func(reflect.Value) error) error
+	switch strings.ToLower(format) {
+	case FormatCSV:
+		read = func(next func(reflect.Value) error) error {
+			return readCSV(r, info, modelType, next)
+		}
+	case FormatJSON:
+		read = func(next func(reflect.Value) error) error {
+			return readJSON(r, info, modelType, next)
+		}
+	default:
+		return 0, WrapError(ErrInvalidArgument, "import %s: unsupported format %q", info.TableName, format)
+	}
+
+	var imported int64
+	batch := reflect.MakeSlice(reflect.SliceOf(modelType), 0, batchSize)
+	flush := func() error {
+		if batch.Len() == 0 {
+			return nil
+		}
+		if err := c.CreateBatch(ctx, batch.Interface()); err != nil {
+			return err
+		}
+		imported += int64(batch.Len())
+		batch = reflect.MakeSlice(batch.Type(), 0, batchSize)
+		return nil
+	}
+
+	err = read(func(row reflect.Value) error {
+		// Stop promptly if the context has been cancelled
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		batch = reflect.Append(batch, row)
+		if batch.Len() < batchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+
+	return imported, WrapError(err, "import %s", info.TableName)
+}
+
+// importFieldIndexes resolves the imported columns to model fields
+func importFieldIndexes(info *ModelInfo, modelType reflect.Type, columns []string) ([][]int, error) {
+	indexes := columnFieldIndexes(info, modelType, columns)
+	for i, index := range indexes {
+		if index == nil {
+			return nil, fmt.Errorf("%w: no field maps to column %s", ErrInvalidArgument, columns[i])
+		}
+	}
+	return indexes, nil
+}
+
+// readCSV parses CSV rows into models, passing each to next
+func readCSV(r io.Reader, info *ModelInfo, modelType reflect.Type, next func(reflect.Value) error) error {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	columns := append([]string(nil), header...)
+	indexes, err := importFieldIndexes(info, modelType, columns)
+	if err != nil {
+		return err
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		row := reflect.New(modelType).Elem()
+		for i, text := range record {
+			if text == "" {
+				continue
+			}
+			if err := parseField(row.FieldByIndex(indexes[i]), text); err != nil {
+				line, _ := cr.FieldPos(i)
+				return fmt.Errorf("line %d, column %s: %w", line, columns[i], err)
+			}
+		}
+
+		if err := next(row); err != nil {
+			return err
+		}
+	}
+}
+
+// readJSON parses the objects of a JSON array into models, passing each to next
+func readJSON(r io.Reader, info *ModelInfo, modelType reflect.Type, next func(reflect.Value) error) error {
+	decoder := json.NewDecoder(r)
+
+	token, err := decoder.Token()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("%w: JSON input must be an array of objects", ErrInvalidArgument)
+	}
+
+	for n := 0; decoder.More(); n++ {
+		var object map[string]json.RawMessage
+		if err := decoder.Decode(&object); err != nil {
+			return fmt.Errorf("object %d: %w", n, err)
+		}
+
+		columns := make([]string, 0, len(object))
+		for column := range object {
+			columns = append(columns, column)
+		}
+		indexes, err := importFieldIndexes(info, modelType, columns)
+		if err != nil {
+			return fmt.Errorf("object %d: %w", n, err)
+		}
+
+		row := reflect.New(modelType).Elem()
+		for i, column := range columns {
+			if err := decodeField(row.FieldByIndex(indexes[i]), object[column]); err != nil {
+				return fmt.Errorf("object %d, column %s: %w", n, column, err)
+			}
+		}
+
+		if err := next(row); err != nil {
+			return err
+		}
+	}
+
+	_, err = decoder.Token()
+	return err
+}
+
+// decodeField decodes a JSON value into a model field. JSON strings that do
+// not decode into the field, such as numbers exported from text columns,
+// are parsed like CSV fields.
+func decodeField(field reflect.Value, raw json.RawMessage) error {
+	if string(raw) == "null" {
+		return nil
+	}
+
+	decoded := reflect.New(field.Type())
+	err := json.Unmarshal(raw, decoded.Interface())
+	if err == nil {
+		field.Set(decoded.Elem())
+		return nil
+	}
+
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return parseField(field, text)
+	}
+	return err
+}
+
+// parseField parses a textual value into a model field
+func parseField(field reflect.Value, text string) error {
+	if reflect.PtrTo(field.Type()).Implements(scannerType) {
+		return field.Addr().Interface().(sql.Scanner).Scan(text)
+	}
+
+	target := field
+	if field.Kind() == reflect.Ptr {
+		target = reflect.New(field.Type().Elem()).Elem()
+	}
+
+	switch {
+	case dialect.IsTimeType(target.Type()):
+		if err := parseTime(target, text); err != nil {
+			return err
+		}
+	case isJSONType(target.Type()):
+		if err := unmarshalJSON(target, text); err != nil {
+			return err
+		}
+	case target.Kind() == reflect.Slice && target.Type().Elem().Kind() == reflect.Uint8:
+		target.SetBytes([]byte(text))
+	default:
+		if !parseBytes(target, []byte(text)) {
+			return fmt.Errorf("cannot parse %q as %s", text, target.Type())
+		}
+	}
+
+	if field.Kind() == reflect.Ptr {
+		field.Set(target.Addr())
+	}
+	return nil
+}
+
+// parseTime parses a timestamp into a time.Time or a type defined on it
+func parseTime(target reflect.Value, text string) error {
+	timeType := reflect.TypeOf(time.Time{})
+	if !timeType.ConvertibleTo(target.Type()) {
+		return fmt.Errorf("cannot parse a timestamp into %s", target.Type())
+	}
+
+	for _, layout := range importTimeLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			target.Set(reflect.ValueOf(t).Convert(target.Type()))
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot parse %q as a timestamp", text)
+}
@@ -0,0 +1,65 @@
+package sage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImportCSV(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+
+	input := "price,stock,weight,sold,featured\n" +
+		"19.99,42,0.5,7,true\n" +
+		"5,0,,1,false\n" +
+		"1.25,3,2,0,1\n"
+	imported, err := c.Import(context.Background(), &testProduct{}, strings.NewReader(input), FormatCSV, ImportOptions{BatchSize: 2})
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if imported != 3 {
+		t.Errorf("imported %d rows, want 3", imported)
+	}
+
+	statements := db.Statements()
+	if len(statements) != 2 {
+		t.Fatalf("got %d inserts, want batches of 2 and 1", len(statements))
+	}
+	var args []driver.Value
+	for _, statement := range statements {
+		args = append(args, statement.Args...)
+	}
+	want := []driver.Value{
+		19.99, int64(42), 0.5, int64(7), true,
+		5.0, int64(0), nil, int64(1), false,
+		1.25, int64(3), 2.0, int64(0), true,
+	}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("inserted %v, want %v", args, want)
+	}
+}
+
+func TestImportJSON(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+
+	input := `[{"name": "Ann", "email": "ann@example.com"}, {"name": "Bob", "email": null}]`
+	imported, err := c.Import(context.Background(), &testUser{}, strings.NewReader(input), FormatJSON)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if imported != 2 {
+		t.Errorf("imported %d rows, want 2", imported)
+	}
+	statements := db.Statements()
+	if len(statements) != 1 || !reflect.DeepEqual(statements[0].Args, []driver.Value{"Ann", "ann@example.com", "Bob", ""}) {
+		t.Errorf("statements = %v, want one insert of both users", statements)
+	}
+
+	_, err = c.Import(context.Background(), &testUser{}, strings.NewReader("name,password\nAnn,secret\n"), FormatCSV)
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Import with an unknown column = %v, want ErrInvalidArgument", err)
+	}
+}
@@ -0,0 +1,50 @@
+package sage
+
+import (
+	"context"
+	"strings"
+)
+
+// QueryInterceptor rewrites a statement and its arguments before execution,
+// e.g. to append a comment attributing the query to the application. An error
+// aborts the statement.
+type QueryInterceptor func(ctx context.Context, query string, args []interface{}) (string, []interface{}, error)
+
+// intercept runs the statement through the configured interceptors
+func (c *Connection) intercept(ctx context.Context, query string, args []interface{}) (string, []interface{}, error) {
+	for _, interceptor := range c.options.Interceptors {
+		var err error
+		query, args, err = interceptor(ctx, query, args)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return query, args, nil
+}
+
+// CorrelationComment returns an interceptor appending a comment such as
+// /* trace_id=abc */ to every statement, so that queries in database logs can
+// be traced back to requests. id extracts the correlation id from the
+// statement's context; statements without one are left unchanged. Characters
+// other than letters, digits and -_.: are dropped from the id so that it
+// cannot end the comment.
+func CorrelationComment(key string, id func(ctx context.Context) string) QueryInterceptor {
+	return func(ctx context.Context, query string, args []interface{}) (string, []interface{}, error) {
+		value := strings.Map(commentSafe, id(ctx))
+		if value == "" {
+			return query, args, nil
+		}
+		return query + " /* " + strings.Map(commentSafe, key) + "=" + value + " */", args, nil
+	}
+}
+
+// commentSafe keeps the characters allowed in a correlation comment
+func commentSafe(r rune) rune {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return r
+	case r == '-' || r == '_' || r == '.' || r == ':':
+		return r
+	}
+	return -1
+}
@@ -0,0 +1,90 @@
+package sage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestInterceptors(t *testing.T) {
+	tag := func(ctx context.Context, query string, args []interface{}) (string, []interface{}, error) {
+		return query + " /* app=web */", args, nil
+	}
+	c, db := openTestConnection(t, ConnectionOptions{Driver: "postgres", Interceptors: []QueryInterceptor{tag}})
+	db.Returns("COUNT(", []string{"count"}, []driver.Value{int64(1)})
+	ctx := context.Background()
+
+	if err := c.Create(ctx, &testUser{Name: "Ann"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	var users []testUser
+	if err := c.All(ctx, &users, nil); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	if _, err := c.Count(ctx, &testUser{}, nil); err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+
+	queries := db.Queries()
+	if len(queries) != 3 {
+		t.Fatalf("got %d statements, want 3", len(queries))
+	}
+	for _, query := range queries {
+		if !strings.HasSuffix(query, " /* app=web */") {
+			t.Errorf("executed %q without the comment", query)
+		}
+	}
+
+	// An interceptor error aborts the statement
+	denied := errors.New("denied")
+	deny := func(ctx context.Context, query string, args []interface{}) (string, []interface{}, error) {
+		return "", nil, denied
+	}
+	c, db = openTestConnection(t, ConnectionOptions{Driver: "postgres", Interceptors: []QueryInterceptor{tag, deny}})
+	if err := c.Create(ctx, &testUser{Name: "Bob"}); !errors.Is(err, denied) {
+		t.Errorf("Create = %v, want %v", err, denied)
+	}
+	if _, err := c.Count(ctx, &testUser{}, nil); !errors.Is(err, denied) {
+		t.Errorf("Count = %v, want %v", err, denied)
+	}
+	if queries := db.Queries(); len(queries) != 0 {
+		t.Errorf("executed %q after the interceptor failed", queries)
+	}
+}
+
+// traceKey is the context key of the correlation id in tests
+type traceKey struct{}
+
+func TestCorrelationComment(t *testing.T) {
+	traceID := func(ctx context.Context) string {
+		id, _ := ctx.Value(traceKey{}).(string)
+		return id
+	}
+	c, db := openTestConnection(t, ConnectionOptions{
+		Driver:       "postgres",
+		Interceptors: []QueryInterceptor{CorrelationComment("trace_id", traceID)},
+	})
+
+	ctx := context.WithValue(context.Background(), traceKey{}, "abc-123")
+	var users []testUser
+	if err := c.All(ctx, &users, nil); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	// A context without an id leaves the statement alone
+	if err := c.All(context.Background(), &users, nil); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	// An id cannot end the comment early
+	ctx = context.WithValue(context.Background(), traceKey{}, "x */ DROP TABLE users; /*")
+	if err := c.All(ctx, &users, nil); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+
+	assertQueries(t, db,
+		"SELECT * FROM users /* trace_id=abc-123 */",
+		"SELECT * FROM users",
+		"SELECT * FROM users /* trace_id=xDROPTABLEusers */",
+	)
+}
@@ -1,7 +1,13 @@
 package dialect
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
 	"reflect"
+	"strings"
+	"time"
+	"unicode"
 )
 
 // Dialect defines methods that a SQL dialect must implement
@@ -30,7 +36,8 @@ type Dialect interface {
 	// DropColumnSQL generates SQL for dropping a column
 	DropColumnSQL(tableName, columnName string) string
 
-	// CreateIndexSQL generates SQL for creating an index
+	// CreateIndexSQL generates SQL for creating an index. Columns wrapped in
+	// parentheses, see IndexExpression, are expressions emitted unquoted.
 	CreateIndexSQL(tableName, indexName string, columns []string, unique bool) string
 
 	// DropIndexSQL generates SQL for dropping an index
@@ -42,6 +49,13 @@ type Dialect interface {
 	// DropTableSQL generates SQL for dropping a table
 	DropTableSQL(tableName string) string
 
+	// CreateTemporaryTableSQL generates SQL for creating a table visible only
+	// to the current session
+	CreateTemporaryTableSQL(tableName string, columns []string) string
+
+	// DropTemporaryTableSQL generates SQL for dropping a temporary table
+	DropTemporaryTableSQL(tableName string) string
+
 	// RenameTableSQL generates SQL for renaming a table
 	RenameTableSQL(oldName, newName string) string
 
@@ -53,18 +67,302 @@ type Dialect interface {
 
 	// TableExistsSQL generates SQL for checking if a table exists
 	TableExistsSQL(tableName string) string
+
+	// LikeEscape returns the ESCAPE clause used with backslash-escaped LIKE patterns
+	LikeEscape() string
+
+	// ILikeCondition generates a condition matching the column against a LIKE
+	// pattern placeholder case-insensitively
+	ILikeCondition(column string) string
+
+	// FullTextCondition generates a condition matching the column against a
+	// full-text search query placeholder
+	FullTextCondition(column string) string
+
+	// DistinctFromCondition generates a null-safe comparison of the column with
+	// a placeholder, true when they differ if distinct is set and when they are
+	// equal otherwise, treating NULL as a comparable value
+	DistinctFromCondition(column string, distinct bool) string
+
+	// UpsertClause generates the conflict resolution clause appended to an INSERT
+	UpsertClause(conflictColumns, updateColumns []string) string
+
+	// UpsertConstraintClause generates a conflict resolution clause targeting a
+	// named unique constraint
+	UpsertConstraintClause(constraintName string, updateColumns []string) string
+
+	// MaxPlaceholders returns the maximum number of bound parameters per statement
+	MaxPlaceholders() int
+
+	// InsertDefaultValuesSQL generates SQL for inserting a row of default values
+	InsertDefaultValuesSQL(tableName string) string
+
+	// ReturningClause generates the clause returning columns of written rows, or
+	// an empty string if the database does not support it
+	ReturningClause(columns []string) string
+
+	// DeferConstraintsSQL generates SQL deferring foreign key checks to the end of
+	// the current transaction, or an empty string if the database cannot
+	DeferConstraintsSQL() string
+
+	// IndexWhereClause generates the predicate clause of a partial index, or
+	// an empty string if the database does not support partial indexes
+	IndexWhereClause(predicate string) string
+
+	// BooleanLiteral returns the literal for a boolean value
+	BooleanLiteral(value bool) string
+
+	// OnUpdateTimestampClause generates the column clause making the database
+	// set a timestamp column to the current time whenever its row is updated,
+	// or an empty string if the database cannot
+	OnUpdateTimestampClause() string
+
+	// AcquireLockSQL generates SQL taking the named session-level advisory
+	// lock, waiting until it is available, or an empty string if the
+	// database has no advisory locks
+	AcquireLockSQL(name string) string
+
+	// ReleaseLockSQL generates SQL releasing the named advisory lock
+	ReleaseLockSQL(name string) string
+
+	// NextSequenceValueSQL generates a query advancing the named sequence and
+	// returning its new value, or an empty string if the database has no
+	// sequences
+	NextSequenceValueSQL(sequence string) string
+
+	// ExportSnapshotSQL generates a query exporting the snapshot of the current
+	// transaction and returning its identifier, or an empty string if the
+	// database cannot share snapshots between transactions
+	ExportSnapshotSQL() string
+
+	// ImportSnapshotSQL generates SQL making the current transaction use an
+	// exported snapshot
+	ImportSnapshotSQL(snapshot string) string
+}
+
+// Options configures optional dialect behaviour
+type Options struct {
+	// DisableQuoting makes Quote return identifiers unchanged
+	DisableQuoting bool
+
+	// LowercaseIdentifiers makes Quote lowercase identifiers, matching how
+	// PostgreSQL folds unquoted names
+	LowercaseIdentifiers bool
+}
+
+// fold applies the identifier case folding of the options
+func (o Options) fold(identifier string) string {
+	if o.LowercaseIdentifiers {
+		return strings.ToLower(identifier)
+	}
+	return identifier
 }
 
 // GetDialect returns a dialect by name
 func GetDialect(name string) Dialect {
+	return NewDialect(name, Options{})
+}
+
+// NewDialect returns a dialect by name configured with the given options
+func NewDialect(name string, opts Options) Dialect {
 	switch name {
-	case "postgres":
-		return &PostgresDialect{}
+	case "postgres", "pgx":
+		return &PostgresDialect{Options: opts}
 	case "mysql":
-		return &MySQLDialect{}
-	case "sqlite":
-		return &SQLiteDialect{}
+		return &MySQLDialect{Options: opts}
+	case "sqlite", "sqlite3":
+		return &SQLiteDialect{Options: opts}
 	default:
 		return nil
 	}
 }
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	nullTimeType = reflect.TypeOf(sql.NullTime{})
+	valuerType   = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	scannerType  = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+// IsColumnType checks if a field type can be stored in a single column:
+// scalars, []byte, timestamps and types implementing driver.Valuer or
+// sql.Scanner. Other fields, such as relationships, are columns only when
+// tagged.
+func IsColumnType(t reflect.Type) bool {
+	if t.Implements(valuerType) || reflect.PtrTo(t).Implements(scannerType) {
+		return true
+	}
+
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	case reflect.Struct:
+		return IsTimeType(t)
+	}
+
+	return false
+}
+
+// IsTimeType checks if a type stores a timestamp: time.Time, sql.NullTime,
+// a type defined on time.Time, or a struct embedding time.Time
+func IsTimeType(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+
+	if t == nullTimeType || t.ConvertibleTo(timeType) {
+		return true
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type == timeType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IndexExpression marks an expression, e.g. "lower(email)", as a key part of
+// an index rather than a column name
+func IndexExpression(expr string) string {
+	return "(" + expr + ")"
+}
+
+// indexKeyParts quotes the columns of an index, leaving expressions marked
+// with IndexExpression as they are
+func indexKeyParts(d Dialect, columns []string) []string {
+	parts := make([]string, len(columns))
+	for i, column := range columns {
+		if strings.HasPrefix(column, "(") && strings.HasSuffix(column, ")") {
+			parts[i] = column
+		} else {
+			parts[i] = d.Quote(column)
+		}
+	}
+	return parts
+}
+
+// Rebind replaces the ? placeholders of a query with the dialect's
+// placeholders, numbered in order. Question marks inside string literals and
+// quoted identifiers are left alone.
+func Rebind(d Dialect, query string) string {
+	if d.Placeholder(1) == "?" || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+
+	position := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			// A doubled quote inside a literal closes and reopens it, which
+			// leaves the scan in the right state
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '?':
+			position++
+			b.WriteString(d.Placeholder(position))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// CountPlaceholders returns the number of arguments a query expects: the
+// number of ? placeholders, or the highest $N placeholder when the query is
+// written with numbered ones. Placeholders inside string literals and quoted
+// identifiers are not counted.
+func CountPlaceholders(query string) int {
+	questions, highest := 0, 0
+	var quote, prev rune
+	runes := []rune(query)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '?':
+			questions++
+		case r == '$' && !isIdentifierRune(prev):
+			n, j := 0, i+1
+			for ; j < len(runes) && runes[j] >= '0' && runes[j] <= '9'; j++ {
+				n = n*10 + int(runes[j]-'0')
+			}
+			if n > highest {
+				highest = n
+			}
+			i = j - 1
+		}
+		prev = runes[i]
+	}
+
+	if questions > 0 {
+		return questions
+	}
+	return highest
+}
+
+// isIdentifierRune reports whether r can be part of an unquoted identifier
+func isIdentifierRune(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// conflictColumnsTarget returns the ON CONFLICT target for the columns
+func conflictColumnsTarget(d Dialect, conflictColumns []string) string {
+	return "(" + strings.Join(quoteAll(d, conflictColumns), ", ") + ")"
+}
+
+// escapeString escapes single quotes for use inside a SQL string literal
+func escapeString(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
+
+// quoteAll quotes each identifier with the dialect
+func quoteAll(d Dialect, identifiers []string) []string {
+	quoted := make([]string, len(identifiers))
+	for i, identifier := range identifiers {
+		quoted[i] = d.Quote(identifier)
+	}
+	return quoted
+}
+
+// onConflictClause generates an ON CONFLICT clause as supported by PostgreSQL
+// and SQLite. target is the conflict target, e.g. "(id)", or empty for none.
+func onConflictClause(d Dialect, target string, updateColumns []string) string {
+	clause := "ON CONFLICT"
+	if target != "" {
+		clause += " " + target
+	}
+	if len(updateColumns) == 0 {
+		return clause + " DO NOTHING"
+	}
+
+	sets := make([]string, len(updateColumns))
+	for i, col := range updateColumns {
+		quoted := d.Quote(col)
+		sets[i] = fmt.Sprintf("%s = EXCLUDED.%s", quoted, quoted)
+	}
+	return clause + " DO UPDATE SET " + strings.Join(sets, ", ")
+}
@@ -0,0 +1,101 @@
+package dialect
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		quoted   string
+		expected string
+	}{
+		{"postgres", Options{}, "userName", `"userName"`},
+		{"mysql", Options{}, "userName", "`userName`"},
+		{"sqlite", Options{}, "userName", `"userName"`},
+		{"postgres", Options{DisableQuoting: true}, "userName", "userName"},
+		{"mysql", Options{DisableQuoting: true}, "userName", "userName"},
+		{"sqlite", Options{DisableQuoting: true}, "userName", "userName"},
+		{"postgres", Options{LowercaseIdentifiers: true}, "userName", `"username"`},
+		{"mysql", Options{LowercaseIdentifiers: true}, "userName", "`username`"},
+		{"sqlite", Options{LowercaseIdentifiers: true}, "userName", `"username"`},
+		{"postgres", Options{DisableQuoting: true, LowercaseIdentifiers: true}, "userName", "username"},
+	}
+
+	for _, tt := range tests {
+		if got := NewDialect(tt.name, tt.opts).Quote(tt.quoted); got != tt.expected {
+			t.Errorf("%s %+v: Quote(%q) = %q, want %q", tt.name, tt.opts, tt.quoted, got, tt.expected)
+		}
+	}
+}
+
+// timestamp is a time type defined on time.Time
+type timestamp time.Time
+
+func TestDataTypeTimeTypes(t *testing.T) {
+	types := []reflect.Type{
+		reflect.TypeOf(time.Time{}),
+		reflect.TypeOf(sql.NullTime{}),
+		reflect.TypeOf(timestamp{}),
+		reflect.TypeOf(&timestamp{}),
+	}
+	expected := map[string]string{
+		"postgres": "TIMESTAMP WITH TIME ZONE",
+		"mysql":    "DATETIME",
+		"sqlite":   "DATETIME",
+	}
+
+	for name, want := range expected {
+		d := NewDialect(name, Options{})
+		for _, typ := range types {
+			if got := d.DataType(typ, 0, 0, 0); got != want {
+				t.Errorf("%s: DataType(%s) = %q, want %q", name, typ, got, want)
+			}
+		}
+	}
+}
+
+func TestCreateIndexSQLExpressions(t *testing.T) {
+	tests := []struct {
+		driver string
+		want   string
+	}{
+		{"postgres", `CREATE UNIQUE INDEX "idx_users_email" ON "users" ((lower(email)), "tenant_id")`},
+		{"mysql", "CREATE UNIQUE INDEX `idx_users_email` ON `users` ((lower(email)), `tenant_id`)"},
+		{"sqlite", `CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_email" ON "users" ((lower(email)), "tenant_id")`},
+	}
+
+	for _, tt := range tests {
+		d := NewDialect(tt.driver, Options{})
+		got := d.CreateIndexSQL("users", "idx_users_email", []string{IndexExpression("lower(email)"), "tenant_id"}, true)
+		if got != tt.want {
+			t.Errorf("%s: CreateIndexSQL = %q, want %q", tt.driver, got, tt.want)
+		}
+	}
+}
+
+func TestCountPlaceholders(t *testing.T) {
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"SELECT * FROM users", 0},
+		{"SELECT * FROM users WHERE name = ? AND email = ?", 2},
+		{"SELECT * FROM users WHERE name = $1 AND email = $2 OR nickname = $1", 2},
+		{"SELECT * FROM users WHERE name = '?' AND email = ?", 1},
+		{`SELECT "a?b" FROM users WHERE id = ?`, 1},
+		{"SELECT `a?b` FROM users WHERE id = ?", 1},
+		{"SELECT price$1 FROM items WHERE id = $1", 1},
+		{"SELECT 'it''s ?' FROM users WHERE id = ?", 1},
+	}
+
+	for _, tt := range tests {
+		if got := CountPlaceholders(tt.query); got != tt.want {
+			t.Errorf("CountPlaceholders(%q) = %d, want %d", tt.query, got, tt.want)
+		}
+	}
+}
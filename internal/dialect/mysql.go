@@ -7,7 +7,9 @@ import (
 )
 
 // MySQLDialect implements SQL dialect for MySQL
-type MySQLDialect struct{}
+type MySQLDialect struct {
+	Options
+}
 
 // Name returns the dialect name
 func (d *MySQLDialect) Name() string {
@@ -16,6 +18,10 @@ func (d *MySQLDialect) Name() string {
 
 // Quote quotes an identifier
 func (d *MySQLDialect) Quote(identifier string) string {
+	identifier = d.fold(identifier)
+	if d.DisableQuoting {
+		return identifier
+	}
 	return fmt.Sprintf("`%s`", strings.Replace(identifier, "`", "``", -1))
 }
 
@@ -26,6 +32,10 @@ func (d *MySQLDialect) Placeholder(position int) string {
 
 // DataType maps Go types to database types
 func (d *MySQLDialect) DataType(fieldType reflect.Type, size int, precision int, scale int) string {
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+
 	switch fieldType.Kind() {
 	case reflect.Bool:
 		return "TINYINT(1)"
@@ -54,7 +64,10 @@ func (d *MySQLDialect) DataType(fieldType reflect.Type, size int, precision int,
 		}
 		return "TEXT"
 	case reflect.Struct:
-		if fieldType.String() == "time.Time" {
+		if IsTimeType(fieldType) {
+			if precision > 0 {
+				return fmt.Sprintf("DATETIME(%d)", precision)
+			}
 			return "DATETIME"
 		}
 	case reflect.Slice:
@@ -104,10 +117,7 @@ func (d *MySQLDialect) CreateIndexSQL(tableName, indexName string, columns []str
 		uniqueStr = "UNIQUE "
 	}
 
-	quotedColumns := make([]string, len(columns))
-	for i, col := range columns {
-		quotedColumns[i] = d.Quote(col)
-	}
+	quotedColumns := indexKeyParts(d, columns)
 
 	return fmt.Sprintf(
 		"CREATE %sINDEX %s ON %s (%s)",
@@ -137,6 +147,18 @@ func (d *MySQLDialect) DropTableSQL(tableName string) string {
 	return fmt.Sprintf("DROP TABLE IF EXISTS %s", quotedTable)
 }
 
+// CreateTemporaryTableSQL generates SQL for creating a temporary table
+func (d *MySQLDialect) CreateTemporaryTableSQL(tableName string, columns []string) string {
+	return fmt.Sprintf("CREATE TEMPORARY TABLE %s (%s)", d.Quote(tableName), strings.Join(columns, ", "))
+}
+
+// DropTemporaryTableSQL generates SQL for dropping a temporary table
+// Note: DROP TEMPORARY TABLE, unlike DROP TABLE, does not commit the
+// current transaction
+func (d *MySQLDialect) DropTemporaryTableSQL(tableName string) string {
+	return fmt.Sprintf("DROP TEMPORARY TABLE IF EXISTS %s", d.Quote(tableName))
+}
+
 // RenameTableSQL generates SQL for renaming a table
 func (d *MySQLDialect) RenameTableSQL(oldName, newName string) string {
 	quotedOld := d.Quote(oldName)
@@ -158,6 +180,129 @@ func (d *MySQLDialect) ListTablesSQL() string {
 func (d *MySQLDialect) TableExistsSQL(tableName string) string {
 	return fmt.Sprintf(
 		"SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = '%s'",
-		tableName,
+		escapeString(tableName),
 	)
 }
+
+// LikeEscape returns the ESCAPE clause used with backslash-escaped LIKE patterns
+func (d *MySQLDialect) LikeEscape() string {
+	return `ESCAPE '\\'`
+}
+
+// ILikeCondition generates a LIKE condition over lower-cased operands
+func (d *MySQLDialect) ILikeCondition(column string) string {
+	return fmt.Sprintf("LOWER(%s) LIKE LOWER(?)", column)
+}
+
+// FullTextCondition generates a natural language MATCH condition
+// Note: the column needs a FULLTEXT index
+func (d *MySQLDialect) FullTextCondition(column string) string {
+	return fmt.Sprintf("MATCH (%s) AGAINST (? IN NATURAL LANGUAGE MODE)", column)
+}
+
+// DistinctFromCondition generates a condition with the null-safe equality
+// operator <=>, negated for distinct
+func (d *MySQLDialect) DistinctFromCondition(column string, distinct bool) string {
+	if distinct {
+		return fmt.Sprintf("NOT (%s <=> ?)", column)
+	}
+	return column + " <=> ?"
+}
+
+// UpsertClause generates the conflict resolution clause appended to an INSERT
+// Note: MySQL resolves conflicts on any unique key, so the conflict columns are
+// only used to build a no-op update when there are no columns to update
+func (d *MySQLDialect) UpsertClause(conflictColumns, updateColumns []string) string {
+	if len(updateColumns) == 0 {
+		if len(conflictColumns) == 0 {
+			return ""
+		}
+		quoted := d.Quote(conflictColumns[0])
+		return fmt.Sprintf("ON DUPLICATE KEY UPDATE %s = %s", quoted, quoted)
+	}
+
+	sets := make([]string, len(updateColumns))
+	for i, col := range updateColumns {
+		quoted := d.Quote(col)
+		sets[i] = fmt.Sprintf("%s = VALUES(%s)", quoted, quoted)
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+// UpsertConstraintClause generates a conflict resolution clause targeting a
+// named unique constraint
+// Note: MySQL cannot target constraints and resolves conflicts on any unique
+// key. Without columns to update no clause is generated, so conflicts fail.
+func (d *MySQLDialect) UpsertConstraintClause(constraintName string, updateColumns []string) string {
+	return d.UpsertClause(nil, updateColumns)
+}
+
+// MaxPlaceholders returns the maximum number of bound parameters per statement
+func (d *MySQLDialect) MaxPlaceholders() int {
+	return 65535
+}
+
+// InsertDefaultValuesSQL generates SQL for inserting a row of default values
+func (d *MySQLDialect) InsertDefaultValuesSQL(tableName string) string {
+	return fmt.Sprintf("INSERT INTO %s () VALUES ()", d.Quote(tableName))
+}
+
+// ReturningClause generates the clause returning columns of written rows, or
+// an empty string if the database does not support it
+// Note: MySQL has no RETURNING clause
+func (d *MySQLDialect) ReturningClause(columns []string) string {
+	return ""
+}
+
+// DeferConstraintsSQL generates SQL deferring foreign key checks to the end of
+// the current transaction, or an empty string if the database cannot
+// Note: MySQL always checks foreign keys immediately
+func (d *MySQLDialect) DeferConstraintsSQL() string {
+	return ""
+}
+
+// IndexWhereClause generates the predicate clause of a partial index, or an
+// empty string if the database does not support partial indexes
+// Note: MySQL has no partial indexes
+func (d *MySQLDialect) IndexWhereClause(predicate string) string {
+	return ""
+}
+
+// BooleanLiteral returns the literal for a boolean value
+// Note: booleans are stored as TINYINT(1)
+func (d *MySQLDialect) BooleanLiteral(value bool) string {
+	if value {
+		return "1"
+	}
+	return "0"
+}
+
+// OnUpdateTimestampClause returns ON UPDATE CURRENT_TIMESTAMP
+func (d *MySQLDialect) OnUpdateTimestampClause() string {
+	return "ON UPDATE CURRENT_TIMESTAMP"
+}
+
+// AcquireLockSQL generates a GET_LOCK call waiting indefinitely for the lock
+func (d *MySQLDialect) AcquireLockSQL(name string) string {
+	return fmt.Sprintf("SELECT GET_LOCK('%s', -1)", escapeString(name))
+}
+
+// ReleaseLockSQL generates a RELEASE_LOCK call
+func (d *MySQLDialect) ReleaseLockSQL(name string) string {
+	return fmt.Sprintf("SELECT RELEASE_LOCK('%s')", escapeString(name))
+}
+
+// NextSequenceValueSQL returns an empty string as MySQL has no sequences
+func (d *MySQLDialect) NextSequenceValueSQL(sequence string) string {
+	return ""
+}
+
+// ExportSnapshotSQL returns an empty string as MySQL cannot export snapshots
+func (d *MySQLDialect) ExportSnapshotSQL() string {
+	return ""
+}
+
+// ImportSnapshotSQL returns an empty string as MySQL cannot import snapshots
+func (d *MySQLDialect) ImportSnapshotSQL(snapshot string) string {
+	return ""
+}
@@ -2,12 +2,15 @@ package dialect
 
 import (
 	"fmt"
+	"hash/fnv"
 	"reflect"
 	"strings"
 )
 
 // PostgresDialect implements SQL dialect for PostgreSQL
-type PostgresDialect struct{}
+type PostgresDialect struct {
+	Options
+}
 
 // Name returns the dialect name
 func (d *PostgresDialect) Name() string {
@@ -16,6 +19,10 @@ func (d *PostgresDialect) Name() string {
 
 // Quote quotes an identifier
 func (d *PostgresDialect) Quote(identifier string) string {
+	identifier = d.fold(identifier)
+	if d.DisableQuoting {
+		return identifier
+	}
 	return fmt.Sprintf("\"%s\"", strings.Replace(identifier, "\"", "\"\"", -1))
 }
 
@@ -26,6 +33,10 @@ func (d *PostgresDialect) Placeholder(position int) string {
 
 // DataType maps Go types to database types
 func (d *PostgresDialect) DataType(fieldType reflect.Type, size int, precision int, scale int) string {
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+
 	switch fieldType.Kind() {
 	case reflect.Bool:
 		return "BOOLEAN"
@@ -51,7 +62,10 @@ func (d *PostgresDialect) DataType(fieldType reflect.Type, size int, precision i
 		}
 		return "TEXT"
 	case reflect.Struct:
-		if fieldType.String() == "time.Time" {
+		if IsTimeType(fieldType) {
+			if precision > 0 {
+				return fmt.Sprintf("TIMESTAMP(%d) WITH TIME ZONE", precision)
+			}
 			return "TIMESTAMP WITH TIME ZONE"
 		}
 	case reflect.Slice:
@@ -101,10 +115,7 @@ func (d *PostgresDialect) CreateIndexSQL(tableName, indexName string, columns []
 		uniqueStr = "UNIQUE "
 	}
 
-	quotedColumns := make([]string, len(columns))
-	for i, col := range columns {
-		quotedColumns[i] = d.Quote(col)
-	}
+	quotedColumns := indexKeyParts(d, columns)
 
 	return fmt.Sprintf(
 		"CREATE %sINDEX %s ON %s (%s)",
@@ -133,6 +144,16 @@ func (d *PostgresDialect) DropTableSQL(tableName string) string {
 	return fmt.Sprintf("DROP TABLE IF EXISTS %s", quotedTable)
 }
 
+// CreateTemporaryTableSQL generates SQL for creating a temporary table
+func (d *PostgresDialect) CreateTemporaryTableSQL(tableName string, columns []string) string {
+	return fmt.Sprintf("CREATE TEMPORARY TABLE %s (%s)", d.Quote(tableName), strings.Join(columns, ", "))
+}
+
+// DropTemporaryTableSQL generates SQL for dropping a temporary table
+func (d *PostgresDialect) DropTemporaryTableSQL(tableName string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s", d.Quote(tableName))
+}
+
 // RenameTableSQL generates SQL for renaming a table
 func (d *PostgresDialect) RenameTableSQL(oldName, newName string) string {
 	quotedOld := d.Quote(oldName)
@@ -154,6 +175,115 @@ func (d *PostgresDialect) ListTablesSQL() string {
 func (d *PostgresDialect) TableExistsSQL(tableName string) string {
 	return fmt.Sprintf(
 		"SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = 'public' AND table_name = '%s')",
-		tableName,
+		escapeString(tableName),
 	)
 }
+
+// LikeEscape returns the ESCAPE clause used with backslash-escaped LIKE patterns
+func (d *PostgresDialect) LikeEscape() string {
+	return `ESCAPE '\'`
+}
+
+// ILikeCondition generates an ILIKE condition
+func (d *PostgresDialect) ILikeCondition(column string) string {
+	return column + " ILIKE ?"
+}
+
+// FullTextCondition generates a text search condition. The query is plain
+// text parsed with plainto_tsquery, so that user input cannot be a malformed
+// tsquery.
+func (d *PostgresDialect) FullTextCondition(column string) string {
+	return fmt.Sprintf("to_tsvector(%s) @@ plainto_tsquery(?)", column)
+}
+
+// DistinctFromCondition generates an IS [NOT] DISTINCT FROM condition
+func (d *PostgresDialect) DistinctFromCondition(column string, distinct bool) string {
+	if distinct {
+		return column + " IS DISTINCT FROM ?"
+	}
+	return column + " IS NOT DISTINCT FROM ?"
+}
+
+// UpsertClause generates the conflict resolution clause appended to an INSERT
+func (d *PostgresDialect) UpsertClause(conflictColumns, updateColumns []string) string {
+	return onConflictClause(d, conflictColumnsTarget(d, conflictColumns), updateColumns)
+}
+
+// UpsertConstraintClause generates a conflict resolution clause targeting a
+// named unique constraint
+func (d *PostgresDialect) UpsertConstraintClause(constraintName string, updateColumns []string) string {
+	return onConflictClause(d, "ON CONSTRAINT "+d.Quote(constraintName), updateColumns)
+}
+
+// MaxPlaceholders returns the maximum number of bound parameters per statement
+func (d *PostgresDialect) MaxPlaceholders() int {
+	return 65535
+}
+
+// InsertDefaultValuesSQL generates SQL for inserting a row of default values
+func (d *PostgresDialect) InsertDefaultValuesSQL(tableName string) string {
+	return fmt.Sprintf("INSERT INTO %s DEFAULT VALUES", d.Quote(tableName))
+}
+
+// ReturningClause generates the clause returning columns of written rows, or
+// an empty string if the database does not support it
+func (d *PostgresDialect) ReturningClause(columns []string) string {
+	return "RETURNING " + strings.Join(quoteAll(d, columns), ", ")
+}
+
+// DeferConstraintsSQL generates SQL deferring foreign key checks to the end of
+// the current transaction, or an empty string if the database cannot
+func (d *PostgresDialect) DeferConstraintsSQL() string {
+	return "SET CONSTRAINTS ALL DEFERRED"
+}
+
+// IndexWhereClause generates the predicate clause of a partial index, or an
+// empty string if the database does not support partial indexes
+func (d *PostgresDialect) IndexWhereClause(predicate string) string {
+	return "WHERE " + predicate
+}
+
+// BooleanLiteral returns the literal for a boolean value
+func (d *PostgresDialect) BooleanLiteral(value bool) string {
+	if value {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// OnUpdateTimestampClause returns an empty string as PostgreSQL needs a trigger
+func (d *PostgresDialect) OnUpdateTimestampClause() string {
+	return ""
+}
+
+// AcquireLockSQL generates SQL taking the advisory lock keyed by the name's hash
+func (d *PostgresDialect) AcquireLockSQL(name string) string {
+	return fmt.Sprintf("SELECT pg_advisory_lock(%d)", advisoryLockKey(name))
+}
+
+// ReleaseLockSQL generates SQL releasing the advisory lock keyed by the name's hash
+func (d *PostgresDialect) ReleaseLockSQL(name string) string {
+	return fmt.Sprintf("SELECT pg_advisory_unlock(%d)", advisoryLockKey(name))
+}
+
+// advisoryLockKey hashes a lock name to the bigint key of a PostgreSQL advisory lock
+func advisoryLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// NextSequenceValueSQL generates a nextval call
+func (d *PostgresDialect) NextSequenceValueSQL(sequence string) string {
+	return fmt.Sprintf("SELECT nextval('%s')", escapeString(sequence))
+}
+
+// ExportSnapshotSQL generates a pg_export_snapshot call
+func (d *PostgresDialect) ExportSnapshotSQL() string {
+	return "SELECT pg_export_snapshot()"
+}
+
+// ImportSnapshotSQL generates SQL setting the transaction snapshot
+func (d *PostgresDialect) ImportSnapshotSQL(snapshot string) string {
+	return fmt.Sprintf("SET TRANSACTION SNAPSHOT '%s'", escapeString(snapshot))
+}
@@ -7,7 +7,9 @@ import (
 )
 
 // SQLiteDialect implements SQL dialect for SQLite
-type SQLiteDialect struct{}
+type SQLiteDialect struct {
+	Options
+}
 
 // Name returns the dialect name
 func (d *SQLiteDialect) Name() string {
@@ -16,6 +18,10 @@ func (d *SQLiteDialect) Name() string {
 
 // Quote quotes an identifier
 func (d *SQLiteDialect) Quote(identifier string) string {
+	identifier = d.fold(identifier)
+	if d.DisableQuoting {
+		return identifier
+	}
 	return fmt.Sprintf("\"%s\"", strings.Replace(identifier, "\"", "\"\"", -1))
 }
 
@@ -26,6 +32,10 @@ func (d *SQLiteDialect) Placeholder(position int) string {
 
 // DataType maps Go types to database types
 func (d *SQLiteDialect) DataType(fieldType reflect.Type, size int, precision int, scale int) string {
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+
 	switch fieldType.Kind() {
 	case reflect.Bool:
 		return "BOOLEAN"
@@ -38,7 +48,7 @@ func (d *SQLiteDialect) DataType(fieldType reflect.Type, size int, precision int
 	case reflect.String:
 		return "TEXT"
 	case reflect.Struct:
-		if fieldType.String() == "time.Time" {
+		if IsTimeType(fieldType) {
 			return "DATETIME"
 		}
 	case reflect.Slice:
@@ -87,10 +97,7 @@ func (d *SQLiteDialect) CreateIndexSQL(tableName, indexName string, columns []st
 		uniqueStr = "UNIQUE "
 	}
 
-	quotedColumns := make([]string, len(columns))
-	for i, col := range columns {
-		quotedColumns[i] = d.Quote(col)
-	}
+	quotedColumns := indexKeyParts(d, columns)
 
 	return fmt.Sprintf(
 		"CREATE %sINDEX IF NOT EXISTS %s ON %s (%s)",
@@ -119,6 +126,16 @@ func (d *SQLiteDialect) DropTableSQL(tableName string) string {
 	return fmt.Sprintf("DROP TABLE IF EXISTS %s", quotedTable)
 }
 
+// CreateTemporaryTableSQL generates SQL for creating a temporary table
+func (d *SQLiteDialect) CreateTemporaryTableSQL(tableName string, columns []string) string {
+	return fmt.Sprintf("CREATE TEMPORARY TABLE %s (%s)", d.Quote(tableName), strings.Join(columns, ", "))
+}
+
+// DropTemporaryTableSQL generates SQL for dropping a temporary table
+func (d *SQLiteDialect) DropTemporaryTableSQL(tableName string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s", d.Quote(tableName))
+}
+
 // RenameTableSQL generates SQL for renaming a table
 func (d *SQLiteDialect) RenameTableSQL(oldName, newName string) string {
 	quotedOld := d.Quote(oldName)
@@ -140,6 +157,113 @@ func (d *SQLiteDialect) ListTablesSQL() string {
 func (d *SQLiteDialect) TableExistsSQL(tableName string) string {
 	return fmt.Sprintf(
 		"SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='%s'",
-		tableName,
+		escapeString(tableName),
 	)
 }
+
+// LikeEscape returns the ESCAPE clause used with backslash-escaped LIKE patterns
+func (d *SQLiteDialect) LikeEscape() string {
+	return `ESCAPE '\'`
+}
+
+// ILikeCondition generates a LIKE condition over lower-cased operands
+func (d *SQLiteDialect) ILikeCondition(column string) string {
+	return fmt.Sprintf("LOWER(%s) LIKE LOWER(?)", column)
+}
+
+// FullTextCondition generates a MATCH condition
+// Note: the column must belong to an FTS5 virtual table
+func (d *SQLiteDialect) FullTextCondition(column string) string {
+	return column + " MATCH ?"
+}
+
+// DistinctFromCondition generates an IS [NOT] condition
+// Note: IS DISTINCT FROM needs SQLite 3.39, IS and IS NOT are its older equivalents
+func (d *SQLiteDialect) DistinctFromCondition(column string, distinct bool) string {
+	if distinct {
+		return column + " IS NOT ?"
+	}
+	return column + " IS ?"
+}
+
+// UpsertClause generates the conflict resolution clause appended to an INSERT
+func (d *SQLiteDialect) UpsertClause(conflictColumns, updateColumns []string) string {
+	return onConflictClause(d, conflictColumnsTarget(d, conflictColumns), updateColumns)
+}
+
+// UpsertConstraintClause generates a conflict resolution clause targeting a
+// named unique constraint
+// Note: SQLite cannot target constraints by name, so the clause has no conflict
+// target and applies to any uniqueness violation (DO UPDATE needs SQLite 3.35+)
+func (d *SQLiteDialect) UpsertConstraintClause(constraintName string, updateColumns []string) string {
+	return onConflictClause(d, "", updateColumns)
+}
+
+// MaxPlaceholders returns the maximum number of bound parameters per statement
+// Note: SQLite before 3.32 limits statements to 999 parameters
+func (d *SQLiteDialect) MaxPlaceholders() int {
+	return 999
+}
+
+// InsertDefaultValuesSQL generates SQL for inserting a row of default values
+func (d *SQLiteDialect) InsertDefaultValuesSQL(tableName string) string {
+	return fmt.Sprintf("INSERT INTO %s DEFAULT VALUES", d.Quote(tableName))
+}
+
+// ReturningClause generates the clause returning columns of written rows, or
+// an empty string if the database does not support it
+// Note: RETURNING needs SQLite 3.35+
+func (d *SQLiteDialect) ReturningClause(columns []string) string {
+	return "RETURNING " + strings.Join(quoteAll(d, columns), ", ")
+}
+
+// DeferConstraintsSQL generates SQL deferring foreign key checks to the end of
+// the current transaction, or an empty string if the database cannot
+func (d *SQLiteDialect) DeferConstraintsSQL() string {
+	return "PRAGMA defer_foreign_keys = ON"
+}
+
+// IndexWhereClause generates the predicate clause of a partial index, or an
+// empty string if the database does not support partial indexes
+func (d *SQLiteDialect) IndexWhereClause(predicate string) string {
+	return "WHERE " + predicate
+}
+
+// BooleanLiteral returns the literal for a boolean value
+// Note: SQLite has no boolean type and TRUE/FALSE need SQLite 3.23+
+func (d *SQLiteDialect) BooleanLiteral(value bool) string {
+	if value {
+		return "1"
+	}
+	return "0"
+}
+
+// OnUpdateTimestampClause returns an empty string as SQLite needs a trigger
+func (d *SQLiteDialect) OnUpdateTimestampClause() string {
+	return ""
+}
+
+// AcquireLockSQL returns an empty string as SQLite has no advisory locks
+func (d *SQLiteDialect) AcquireLockSQL(name string) string {
+	return ""
+}
+
+// ReleaseLockSQL returns an empty string as SQLite has no advisory locks
+func (d *SQLiteDialect) ReleaseLockSQL(name string) string {
+	return ""
+}
+
+// NextSequenceValueSQL returns an empty string as SQLite has no sequences
+func (d *SQLiteDialect) NextSequenceValueSQL(sequence string) string {
+	return ""
+}
+
+// ExportSnapshotSQL returns an empty string as SQLite cannot export snapshots
+func (d *SQLiteDialect) ExportSnapshotSQL() string {
+	return ""
+}
+
+// ImportSnapshotSQL returns an empty string as SQLite cannot import snapshots
+func (d *SQLiteDialect) ImportSnapshotSQL(snapshot string) string {
+	return ""
+}
@@ -23,6 +23,7 @@ type Builder struct {
 	havingArgs []interface{}
 	operation  string
 	values     map[string]interface{}
+	valueOrder []string
 	returning  []string
 }
 
@@ -47,6 +48,38 @@ func NewBuilder(dialect dialect.Dialect, table string) *Builder {
 	}
 }
 
+// Clone returns an independent copy of the builder
+func (b *Builder) Clone() *Builder {
+	clone := &Builder{
+		dialect:    b.dialect,
+		table:      b.table,
+		columns:    append([]string{}, b.columns...),
+		where:      append([]string{}, b.where...),
+		whereArgs:  append([]interface{}{}, b.whereArgs...),
+		orderBy:    append([]string{}, b.orderBy...),
+		limit:      b.limit,
+		offset:     b.offset,
+		joins:      append([]string{}, b.joins...),
+		groupBy:    append([]string{}, b.groupBy...),
+		having:     append([]string{}, b.having...),
+		havingArgs: append([]interface{}{}, b.havingArgs...),
+		operation:  b.operation,
+		values:     make(map[string]interface{}, len(b.values)),
+		valueOrder: append([]string{}, b.valueOrder...),
+		returning:  append([]string{}, b.returning...),
+	}
+	for column, value := range b.values {
+		clone.values[column] = value
+	}
+	return clone
+}
+
+// Reset clears all clauses and values, keeping only the dialect and table
+func (b *Builder) Reset() *Builder {
+	*b = *NewBuilder(b.dialect, b.table)
+	return b
+}
+
 // Select sets the columns to select
 func (b *Builder) Select(columns ...string) *Builder {
 	b.operation = "SELECT"
@@ -81,26 +114,41 @@ func (b *Builder) Delete() *Builder {
 	return b
 }
 
-// Where adds a WHERE condition
+// Where adds a WHERE condition. The ? placeholders of the condition are
+// numbered when the query is built.
 func (b *Builder) Where(condition string, args ...interface{}) *Builder {
-	// Replace ? placeholders with dialect-specific placeholders
-	if strings.Contains(condition, "?") {
-		parts := strings.Split(condition, "?")
-		newCondition := parts[0]
-
-		for i := 1; i < len(parts); i++ {
-			newCondition += b.dialect.Placeholder(len(b.whereArgs) + i)
-			newCondition += parts[i]
-		}
-
-		condition = newCondition
-	}
-
 	b.where = append(b.where, condition)
 	b.whereArgs = append(b.whereArgs, args...)
 	return b
 }
 
+// WhereContains adds a condition matching rows where column contains value literally
+func (b *Builder) WhereContains(column, value string) *Builder {
+	return b.whereLike(column, "%"+escapeLike(value)+"%")
+}
+
+// WhereStartsWith adds a condition matching rows where column starts with value literally
+func (b *Builder) WhereStartsWith(column, value string) *Builder {
+	return b.whereLike(column, escapeLike(value)+"%")
+}
+
+// WhereEndsWith adds a condition matching rows where column ends with value literally
+func (b *Builder) WhereEndsWith(column, value string) *Builder {
+	return b.whereLike(column, "%"+escapeLike(value))
+}
+
+// whereLike adds a LIKE condition using the dialect's ESCAPE clause
+func (b *Builder) whereLike(column, pattern string) *Builder {
+	condition := fmt.Sprintf("%s LIKE ? %s", b.dialect.Quote(column), b.dialect.LikeEscape())
+	return b.Where(condition, pattern)
+}
+
+// escapeLike escapes the LIKE wildcards in s so that it is matched literally
+func escapeLike(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return replacer.Replace(s)
+}
+
 // OrderBy adds an ORDER BY clause
 func (b *Builder) OrderBy(column string, direction string) *Builder {
 	quotedCol := b.dialect.Quote(column)
@@ -158,28 +206,20 @@ func (b *Builder) GroupBy(columns ...string) *Builder {
 	return b
 }
 
-// Having adds a HAVING condition
+// Having adds a HAVING condition. The ? placeholders of the condition are
+// numbered when the query is built.
 func (b *Builder) Having(condition string, args ...interface{}) *Builder {
-	// Replace ? placeholders with dialect-specific placeholders
-	if strings.Contains(condition, "?") {
-		parts := strings.Split(condition, "?")
-		newCondition := parts[0]
-
-		for i := 1; i < len(parts); i++ {
-			newCondition += b.dialect.Placeholder(len(b.havingArgs) + i)
-			newCondition += parts[i]
-		}
-
-		condition = newCondition
-	}
-
 	b.having = append(b.having, condition)
 	b.havingArgs = append(b.havingArgs, args...)
 	return b
 }
 
-// Set adds a column value for INSERT or UPDATE
+// Set adds a column value for INSERT or UPDATE. Columns are written in the
+// order they were first set, so the generated SQL is stable.
 func (b *Builder) Set(column string, value interface{}) *Builder {
+	if _, ok := b.values[column]; !ok {
+		b.valueOrder = append(b.valueOrder, column)
+	}
 	b.values[column] = value
 	return b
 }
@@ -255,6 +295,17 @@ func (b *Builder) Build() (string, []interface{}) {
 		}
 
 	case "INSERT":
+		if len(b.valueOrder) == 0 {
+			query.WriteString(b.dialect.InsertDefaultValuesSQL(b.table))
+
+			// Add returning clause for PostgreSQL
+			if len(b.returning) > 0 && b.dialect.Name() == "postgres" {
+				query.WriteString(" RETURNING ")
+				query.WriteString(strings.Join(b.returning, ", "))
+			}
+			break
+		}
+
 		query.WriteString("INSERT INTO ")
 		query.WriteString(quotedTable)
 
@@ -262,12 +313,10 @@ func (b *Builder) Build() (string, []interface{}) {
 		var placeholders []string
 		var values []interface{}
 
-		i := 1
-		for column, value := range b.values {
+		for _, column := range b.valueOrder {
 			columns = append(columns, b.dialect.Quote(column))
-			placeholders = append(placeholders, b.dialect.Placeholder(i))
-			values = append(values, value)
-			i++
+			placeholders = append(placeholders, "?")
+			values = append(values, b.values[column])
 		}
 
 		query.WriteString(" (")
@@ -292,11 +341,9 @@ func (b *Builder) Build() (string, []interface{}) {
 		var sets []string
 		var values []interface{}
 
-		i := 1
-		for column, value := range b.values {
-			sets = append(sets, fmt.Sprintf("%s = %s", b.dialect.Quote(column), b.dialect.Placeholder(i)))
-			values = append(values, value)
-			i++
+		for _, column := range b.valueOrder {
+			sets = append(sets, b.dialect.Quote(column)+" = ?")
+			values = append(values, b.values[column])
 		}
 
 		query.WriteString(strings.Join(sets, ", "))
@@ -334,5 +381,7 @@ func (b *Builder) Build() (string, []interface{}) {
 		args = b.whereArgs
 	}
 
-	return query.String(), args
+	// Number the placeholders in argument order, so that the WHERE
+	// placeholders of an UPDATE follow those of its SET clause
+	return dialect.Rebind(b.dialect, query.String()), args
 }
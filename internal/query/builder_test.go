@@ -0,0 +1,77 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/IMPHNEN/sage/internal/dialect"
+)
+
+func TestBuilderCloneAndReset(t *testing.T) {
+	d := dialect.NewDialect("postgres", dialect.Options{})
+	base := NewBuilder(d, "orders").Select("id", "total").Join("users", "users.id = orders.user_id").Where("users.active = ?", true)
+	wantQuery, wantArgs := base.Build()
+
+	clone := base.Clone().Where("orders.total > ?", 10).OrderBy("total", "DESC").Limit(5)
+	if query, args := clone.Build(); query == wantQuery || len(args) != 2 {
+		t.Errorf("clone query %q with %v lacks its own conditions", query, args)
+	}
+
+	query, args := base.Build()
+	if query != wantQuery || !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("original changed to %q with %v, want %q with %v", query, args, wantQuery, wantArgs)
+	}
+
+	clone.Reset()
+	if query, args := clone.Select("*").Build(); query != `SELECT * FROM "orders"` || len(args) != 0 {
+		t.Errorf("reset builder builds %q with %v", query, args)
+	}
+}
+
+func TestBuilderColumnOrderIsStable(t *testing.T) {
+	d := dialect.NewDialect("postgres", dialect.Options{})
+	columns := []string{"name", "email", "age", "bio", "city", "zip"}
+
+	build := func(b *Builder) (string, []interface{}) {
+		for _, column := range columns {
+			b.Set(column, column)
+		}
+		return b.Build()
+	}
+
+	tests := []struct {
+		name  string
+		build func() *Builder
+		query string
+	}{
+		{"insert", func() *Builder { return NewBuilder(d, "users").Insert() },
+			`INSERT INTO "users" ("name", "email", "age", "bio", "city", "zip") VALUES ($1, $2, $3, $4, $5, $6)`},
+		{"update", func() *Builder { return NewBuilder(d, "users").Update().Where("id = ?", 1) },
+			`UPDATE "users" SET "name" = $1, "email" = $2, "age" = $3, "bio" = $4, "city" = $5, "zip" = $6 WHERE id = $7`},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			query, args := build(tt.build())
+			if query != tt.query {
+				t.Fatalf("%s build %d = %q, want %q", tt.name, i+1, query, tt.query)
+			}
+			for j, column := range columns {
+				if args[j] != column {
+					t.Fatalf("%s build %d args = %v, want them in column order", tt.name, i+1, args)
+				}
+			}
+		}
+	}
+}
+
+func TestBuilderNumbersPlaceholdersInArgumentOrder(t *testing.T) {
+	d := dialect.NewDialect("postgres", dialect.Options{})
+	query, args := NewBuilder(d, "orders").Select("user_id").Where("total > ?", 10).
+		GroupBy("user_id").Having("COUNT(*) > ?", 2).Build()
+
+	want := `SELECT "user_id" FROM "orders" WHERE total > $1 GROUP BY "user_id" HAVING COUNT(*) > $2`
+	if query != want || !reflect.DeepEqual(args, []interface{}{10, 2}) {
+		t.Errorf("Build = %q with %v, want %q with [10 2]", query, args, want)
+	}
+}
@@ -0,0 +1,62 @@
+package schema
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Fingerprint returns a stable hash of the schema's table, column, index and
+// constraint definitions. It does not depend on the order tables, columns or
+// indexes were added in, so two schemas with the same definitions share a
+// fingerprint.
+func (s *Schema) Fingerprint() string {
+	tables := make([]string, len(s.Tables))
+	for i, table := range s.Tables {
+		tables[i] = table.definition()
+	}
+	sort.Strings(tables)
+
+	sum := sha256.Sum256([]byte(strings.Join(tables, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// definition returns a canonical text form of the table's definition
+func (t *Table) definition() string {
+	var parts []string
+
+	for _, column := range t.Columns {
+		columnType := column.Type
+		if columnType == "" && column.GoType != nil {
+			columnType = column.GoType.String()
+		}
+		parts = append(parts, fmt.Sprintf(
+			"column %s %s size=%d precision=%d scale=%d nullable=%t unique=%t default=%q default_expr=%q on_update_now=%t auto=%t pk=%t",
+			column.Name, columnType, column.Size, column.Precision, column.Scale,
+			column.Nullable, column.Unique, column.Default, column.DefaultExpr, column.OnUpdateNow,
+			column.IsAutoIncrement, column.IsPrimaryKey,
+		))
+	}
+
+	for _, index := range t.Indexes {
+		parts = append(parts, fmt.Sprintf("index %s (%s) unique=%t where=%q", index.Name, strings.Join(index.Columns, ","), index.Unique, index.Where))
+	}
+
+	for _, uniqueKey := range t.UniqueKeys {
+		parts = append(parts, fmt.Sprintf("unique %s (%s)", uniqueKey.Name, strings.Join(uniqueKey.Columns, ",")))
+	}
+
+	for _, foreignKey := range t.ForeignKeys {
+		parts = append(parts, fmt.Sprintf(
+			"foreign key %s (%s) references %s (%s) on delete %s on update %s deferrable=%t",
+			foreignKey.Name, strings.Join(foreignKey.Columns, ","),
+			foreignKey.ReferenceTable, strings.Join(foreignKey.ReferenceColumns, ","),
+			foreignKey.OnDelete, foreignKey.OnUpdate, foreignKey.Deferrable,
+		))
+	}
+
+	sort.Strings(parts)
+	return "table " + t.Name + "\n" + strings.Join(parts, "\n")
+}
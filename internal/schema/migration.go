@@ -3,11 +3,18 @@ package schema
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"time"
+
+	"github.com/IMPHNEN/sage/internal/dialect"
 )
 
+// lockRetryInterval is how often a lock row is retried while another
+// instance holds it
+const lockRetryInterval = 100 * time.Millisecond
+
 // Migration represents a database migration
 type Migration struct {
 	ID          int64
@@ -23,6 +30,10 @@ type Migration struct {
 type MigrationManager struct {
 	db        *sql.DB
 	tableName string
+
+	// Migration lock, see SetLock
+	dialect  dialect.Dialect
+	lockName string
 }
 
 // NewMigrationManager creates a new migration manager
@@ -37,6 +48,85 @@ func NewMigrationManager(db *sql.DB, tableName string) *MigrationManager {
 	}
 }
 
+// SetLock makes MigrateUp and MigrateDown hold a lock while they run, so
+// that instances deploying concurrently apply migrations one at a time. The
+// lock is an advisory lock named name where the dialect supports them
+// (PostgreSQL, MySQL) and otherwise a row of the table name, created if
+// needed (SQLite). name defaults to the migrations table name with a _lock
+// suffix. A lock row left behind by a crashed process must be deleted by hand.
+func (m *MigrationManager) SetLock(d dialect.Dialect, name string) {
+	if name == "" {
+		name = m.tableName + "_lock"
+	}
+	m.dialect = d
+	m.lockName = name
+}
+
+// lock takes the migration lock, if one is set, and returns a function
+// releasing it. Advisory locks belong to a session, so a connection is held
+// until the lock is released.
+func (m *MigrationManager) lock(ctx context.Context) (func() error, error) {
+	if m.dialect == nil {
+		return func() error { return nil }, nil
+	}
+
+	acquire := m.dialect.AcquireLockSQL(m.lockName)
+	if acquire == "" {
+		return m.lockRow(ctx)
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, acquire); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+
+	return func() error {
+		// Release even if the migration's context has been cancelled
+		if _, err := conn.ExecContext(context.Background(), m.dialect.ReleaseLockSQL(m.lockName)); err != nil {
+			// Discard the connection rather than return it to the pool
+			// still holding the lock
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+			return fmt.Errorf("failed to release migration lock: %w", err)
+		}
+		return conn.Close()
+	}, nil
+}
+
+// lockRow takes the migration lock by inserting the single row of the lock
+// table, retrying while another instance holds it
+func (m *MigrationManager) lockRow(ctx context.Context) (func() error, error) {
+	table := m.dialect.Quote(m.lockName)
+	create := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id INTEGER PRIMARY KEY, locked_at TIMESTAMP NOT NULL)", table)
+	if _, err := m.db.ExecContext(ctx, create); err != nil {
+		return nil, fmt.Errorf("failed to create migration lock table: %w", err)
+	}
+
+	insert := fmt.Sprintf("INSERT INTO %s (id, locked_at) VALUES (1, CURRENT_TIMESTAMP)", table)
+	for {
+		if _, err := m.db.ExecContext(ctx, insert); err == nil {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to acquire migration lock: %w", ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+
+	return func() error {
+		_, err := m.db.ExecContext(context.Background(), fmt.Sprintf("DELETE FROM %s WHERE id = 1", table))
+		if err != nil {
+			return fmt.Errorf("failed to release migration lock: %w", err)
+		}
+		return nil
+	}, nil
+}
+
 // CreateMigrationsTable creates the migrations table if it doesn't exist
 func (m *MigrationManager) CreateMigrationsTable(ctx context.Context) error {
 	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
@@ -220,8 +310,15 @@ func (m *MigrationManager) MarkMigrationAsUnapplied(ctx context.Context, migrati
 	return nil
 }
 
-// MigrateUp applies all pending migrations
-func (m *MigrationManager) MigrateUp(ctx context.Context) error {
+// MigrateUp applies all pending migrations, holding the migration lock if
+// one is set
+func (m *MigrationManager) MigrateUp(ctx context.Context) (err error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, unlock()) }()
+
 	// Create migrations table if it doesn't exist
 	if err := m.CreateMigrationsTable(ctx); err != nil {
 		return err
@@ -260,8 +357,15 @@ func (m *MigrationManager) MigrateUp(ctx context.Context) error {
 	return tx.Commit()
 }
 
-// MigrateDown reverts the last migration
-func (m *MigrationManager) MigrateDown(ctx context.Context) error {
+// MigrateDown reverts the last migration, holding the migration lock if one
+// is set
+func (m *MigrationManager) MigrateDown(ctx context.Context) (err error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, unlock()) }()
+
 	// Get the last applied migration
 	migrations, err := m.GetAppliedMigrations(ctx)
 	if err != nil {
@@ -297,3 +401,30 @@ func (m *MigrationManager) MigrateDown(ctx context.Context) error {
 	// Commit transaction
 	return tx.Commit()
 }
+
+// PreviewDown returns the down SQL of the migrations that calling MigrateDown
+// steps times would revert, in the order they would run, without running it
+func (m *MigrationManager) PreviewDown(ctx context.Context, steps int) ([]string, error) {
+	if steps <= 0 {
+		return nil, errors.New("steps must be greater than 0")
+	}
+
+	migrations, err := m.GetAppliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(migrations) == 0 {
+		return nil, errors.New("no migrations to revert")
+	}
+
+	if steps > len(migrations) {
+		steps = len(migrations)
+	}
+
+	statements := make([]string, steps)
+	for i, migration := range migrations[:steps] {
+		statements[i] = migration.Down
+	}
+	return statements, nil
+}
@@ -0,0 +1,228 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IMPHNEN/sage/internal/dialect"
+	"github.com/IMPHNEN/sage/internal/testdb"
+)
+
+// pendingMigration makes the fake database report one pending migration
+func pendingMigration(db *testdb.DB) {
+	db.Returns("WHERE applied_at IS NULL", []string{"id", "name", "description", "up", "down", "created_at", "applied_at"},
+		[]driver.Value{int64(1), "create_widgets", "", "CREATE TABLE widgets (id INTEGER)", "DROP TABLE widgets", time.Now(), nil})
+}
+
+// migrateConcurrently runs MigrateUp from two managers at once and returns
+// the highest number of migrations that ran at the same time
+func migrateConcurrently(t *testing.T, driverName string, db *testdb.DB) int32 {
+	t.Helper()
+
+	var running, most int32
+	db.InsertIDFunc("CREATE TABLE widgets", func([]driver.Value) int64 {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return 0
+	})
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		sqlDB, err := sql.Open(driverName, db.DSN())
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		defer sqlDB.Close()
+
+		m := NewMigrationManager(sqlDB, "migrations")
+		m.SetLock(dialect.NewDialect(driverName, dialect.Options{}), "")
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = m.MigrateUp(context.Background())
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("MigrateUp: %v", err)
+		}
+	}
+	return most
+}
+
+func TestMigrateUpAdvisoryLock(t *testing.T) {
+	db := testdb.New()
+	pendingMigration(db)
+
+	// The fake database grants the advisory lock to one session at a time
+	var held sync.Mutex
+	db.InsertIDFunc("pg_advisory_lock(", func([]driver.Value) int64 {
+		held.Lock()
+		return 0
+	})
+	db.InsertIDFunc("pg_advisory_unlock(", func([]driver.Value) int64 {
+		held.Unlock()
+		return 0
+	})
+
+	if most := migrateConcurrently(t, "postgres", db); most != 1 {
+		t.Errorf("%d migrations ran at once, want 1", most)
+	}
+
+	// Each lock is released on the session that took it
+	locked := map[int]bool{}
+	for _, statement := range db.Statements() {
+		switch {
+		case strings.HasPrefix(statement.Query, "SELECT pg_advisory_lock("):
+			locked[statement.Conn] = true
+		case strings.HasPrefix(statement.Query, "SELECT pg_advisory_unlock("):
+			if !locked[statement.Conn] {
+				t.Errorf("connection %d released a lock it did not take", statement.Conn)
+			}
+			delete(locked, statement.Conn)
+		}
+	}
+	if len(locked) != 0 {
+		t.Errorf("connections %v kept their locks", locked)
+	}
+}
+
+func TestMigrateUpLockRow(t *testing.T) {
+	db := testdb.New()
+	pendingMigration(db)
+
+	// The fake database keeps the lock row until it is deleted
+	var held sync.Mutex
+	db.InsertIDFunc(`INSERT INTO "migrations_lock"`, func([]driver.Value) int64 {
+		held.Lock()
+		return 0
+	})
+	db.InsertIDFunc(`DELETE FROM "migrations_lock"`, func([]driver.Value) int64 {
+		held.Unlock()
+		return 0
+	})
+
+	if most := migrateConcurrently(t, "sqlite", db); most != 1 {
+		t.Errorf("%d migrations ran at once, want 1", most)
+	}
+}
+
+func TestMigrateUpRetriesLockRow(t *testing.T) {
+	db := testdb.New()
+	sqlDB, err := sql.Open("sqlite", db.DSN())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer sqlDB.Close()
+
+	m := NewMigrationManager(sqlDB, "migrations")
+	m.SetLock(dialect.NewDialect("sqlite", dialect.Options{}), "deploy_lock")
+
+	// Another instance holds the lock row for the first attempt
+	db.FailsOnce(`INSERT INTO "deploy_lock"`, errors.New("UNIQUE constraint failed: deploy_lock.id"))
+	if err := m.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+
+	var inserts, deletes int
+	for _, query := range db.Queries() {
+		switch {
+		case strings.HasPrefix(query, `INSERT INTO "deploy_lock"`):
+			inserts++
+		case strings.HasPrefix(query, `DELETE FROM "deploy_lock"`):
+			deletes++
+		}
+	}
+	if inserts != 2 || deletes != 1 {
+		t.Errorf("got %d lock inserts and %d releases, want 2 and 1", inserts, deletes)
+	}
+
+	// A lock that is never released gives up with the context
+	db.Fails(`INSERT INTO "deploy_lock"`, errors.New("UNIQUE constraint failed: deploy_lock.id"))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := m.MigrateUp(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("MigrateUp = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestPreviewDown(t *testing.T) {
+	db := testdb.New()
+	sqlDB, err := sql.Open("postgres", db.DSN())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer sqlDB.Close()
+	m := NewMigrationManager(sqlDB, "migrations")
+
+	// applied returns the rows of the applied migrations, the latest first
+	applied := func(ids ...int64) [][]driver.Value {
+		names := map[int64]string{1: "users", 2: "posts", 3: "tags"}
+		var rows [][]driver.Value
+		for _, id := range ids {
+			rows = append(rows, []driver.Value{id, names[id], "", "CREATE TABLE " + names[id], "DROP TABLE " + names[id], time.Now(), time.Now()})
+		}
+		return rows
+	}
+	columns := []string{"id", "name", "description", "up", "down", "created_at", "applied_at"}
+	ctx := context.Background()
+
+	db.Returns("WHERE applied_at IS NOT NULL", columns, applied(3, 2, 1)...)
+	preview, err := m.PreviewDown(ctx, 2)
+	if err != nil {
+		t.Fatalf("PreviewDown: %v", err)
+	}
+	if want := []string{"DROP TABLE tags", "DROP TABLE posts"}; !reflect.DeepEqual(preview, want) {
+		t.Errorf("PreviewDown = %q, want %q", preview, want)
+	}
+	for _, query := range db.Queries() {
+		if !strings.HasPrefix(query, "SELECT") {
+			t.Errorf("PreviewDown ran %q", query)
+		}
+	}
+
+	// Rolling back the same two steps runs the previewed statements
+	db.Reset()
+	db.ReturnsOnce("WHERE applied_at IS NOT NULL", columns, applied(2, 1)...)
+	db.ReturnsOnce("WHERE applied_at IS NOT NULL", columns, applied(3, 2, 1)...)
+	for i := 0; i < 2; i++ {
+		if err := m.MigrateDown(ctx); err != nil {
+			t.Fatalf("MigrateDown: %v", err)
+		}
+	}
+	var reverted []string
+	for _, query := range db.Queries() {
+		if strings.HasPrefix(query, "DROP TABLE") {
+			reverted = append(reverted, query)
+		}
+	}
+	if !reflect.DeepEqual(reverted, preview) {
+		t.Errorf("MigrateDown ran %q, preview was %q", reverted, preview)
+	}
+
+	if preview, err := m.PreviewDown(ctx, 10); err != nil || len(preview) != 3 {
+		t.Errorf("PreviewDown of more steps than applied = %q, %v, want all 3", preview, err)
+	}
+	if _, err := m.PreviewDown(ctx, 0); err == nil {
+		t.Error("PreviewDown of 0 steps succeeded")
+	}
+}
@@ -0,0 +1,58 @@
+package schema
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// MaxIdentifierLength is the longest identifier generated names may have,
+// PostgreSQL's limit and below MySQL's
+const MaxIdentifierLength = 63
+
+// NamingStrategy generates the names of indexes and constraints that are not
+// named explicitly
+type NamingStrategy interface {
+	// IndexName names an index over the columns of the table
+	IndexName(table string, columns []string) string
+
+	// UniqueKeyName names a unique constraint over the columns of the table
+	UniqueKeyName(table string, columns []string) string
+
+	// ForeignKeyName names a foreign key from the columns of the table
+	ForeignKeyName(table string, columns []string, referenceTable string) string
+}
+
+// DefaultNamingStrategy names indexes idx_<table>_<columns>, unique
+// constraints uq_<table>_<columns> and foreign keys fk_<table>_<columns>, with
+// the columns joined by underscores. Names longer than MaxIdentifierLength
+// are shortened deterministically, see TruncateIdentifier.
+type DefaultNamingStrategy struct{}
+
+// IndexName names an index over the columns of the table
+func (DefaultNamingStrategy) IndexName(table string, columns []string) string {
+	return TruncateIdentifier("idx_" + table + "_" + strings.Join(columns, "_"))
+}
+
+// UniqueKeyName names a unique constraint over the columns of the table
+func (DefaultNamingStrategy) UniqueKeyName(table string, columns []string) string {
+	return TruncateIdentifier("uq_" + table + "_" + strings.Join(columns, "_"))
+}
+
+// ForeignKeyName names a foreign key from the columns of the table
+func (DefaultNamingStrategy) ForeignKeyName(table string, columns []string, referenceTable string) string {
+	return TruncateIdentifier("fk_" + table + "_" + strings.Join(columns, "_"))
+}
+
+// TruncateIdentifier shortens a name longer than MaxIdentifierLength,
+// replacing its end with a hash of the whole name so that names sharing a
+// prefix stay distinct instead of being cut to the same identifier
+func TruncateIdentifier(name string) string {
+	if len(name) <= MaxIdentifierLength {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	suffix := hex.EncodeToString(sum[:4])
+	return name[:MaxIdentifierLength-len(suffix)-1] + "_" + suffix
+}
@@ -0,0 +1,98 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// prefixNaming names constraints after the application's own convention
+type prefixNaming struct{}
+
+func (prefixNaming) IndexName(table string, columns []string) string {
+	return "ix__" + table + "__" + strings.Join(columns, "__")
+}
+
+func (prefixNaming) UniqueKeyName(table string, columns []string) string {
+	return "ak__" + table + "__" + strings.Join(columns, "__")
+}
+
+func (prefixNaming) ForeignKeyName(table string, columns []string, referenceTable string) string {
+	return "fk__" + table + "__" + referenceTable
+}
+
+type namedOrder struct {
+	ID         int64  `db:"id,pk,auto"`
+	CustomerID int64  `db:"customer_id,index,references:customers.id"`
+	Number     string `db:"number,unique"`
+	Status     string `db:"status,index:by_status"`
+}
+
+// constraintNames lists the names of the table's indexes and constraints
+func constraintNames(table *Table) []string {
+	var names []string
+	for _, index := range table.Indexes {
+		names = append(names, index.Name)
+	}
+	for _, uniqueKey := range table.UniqueKeys {
+		names = append(names, uniqueKey.Name)
+	}
+	for _, foreignKey := range table.ForeignKeys {
+		names = append(names, foreignKey.Name)
+	}
+	return names
+}
+
+func TestDefaultNamingStrategy(t *testing.T) {
+	table, err := BuildFromStruct(namedOrder{}, "orders")
+	if err != nil {
+		t.Fatalf("BuildFromStruct: %v", err)
+	}
+
+	want := []string{"idx_orders_customer_id", "by_status", "uq_orders_number", "fk_orders_customer_id"}
+	if got := constraintNames(table); !reflect.DeepEqual(got, want) {
+		t.Errorf("names = %v, want %v", got, want)
+	}
+
+	for i := 0; i < 10; i++ {
+		again, err := BuildFromStruct(namedOrder{}, "orders")
+		if err != nil {
+			t.Fatalf("BuildFromStruct: %v", err)
+		}
+		if got := constraintNames(again); !reflect.DeepEqual(got, want) {
+			t.Fatalf("build %d names = %v, want %v", i+2, got, want)
+		}
+	}
+}
+
+func TestCustomNamingStrategy(t *testing.T) {
+	table, err := BuildFromStructWithNaming(namedOrder{}, "orders", prefixNaming{})
+	if err != nil {
+		t.Fatalf("BuildFromStructWithNaming: %v", err)
+	}
+
+	// Names given in the tags are kept
+	want := []string{"ix__orders__customer_id", "by_status", "ak__orders__number", "fk__orders__customers"}
+	if got := constraintNames(table); !reflect.DeepEqual(got, want) {
+		t.Errorf("names = %v, want %v", got, want)
+	}
+}
+
+func TestTruncateIdentifier(t *testing.T) {
+	long := "idx_" + strings.Repeat("customer_", 8)
+	first := TruncateIdentifier(long + "a")
+	second := TruncateIdentifier(long + "b")
+
+	if len(first) != MaxIdentifierLength || len(second) != MaxIdentifierLength {
+		t.Errorf("lengths = %d and %d, want %d", len(first), len(second), MaxIdentifierLength)
+	}
+	if first == second {
+		t.Errorf("names sharing a prefix both truncate to %q", first)
+	}
+	if again := TruncateIdentifier(long + "a"); again != first {
+		t.Errorf("TruncateIdentifier = %q, then %q", first, again)
+	}
+	if short := "idx_orders_status"; TruncateIdentifier(short) != short {
+		t.Errorf("TruncateIdentifier shortened %q", short)
+	}
+}
@@ -33,15 +33,29 @@ type Column struct {
 	Nullable        bool
 	Unique          bool
 	Default         string
+	DefaultExpr     string
 	IsAutoIncrement bool
 	IsPrimaryKey    bool
+
+	// OnUpdateNow sets the column to the current time whenever the row is
+	// updated, in the DDL where the dialect supports it
+	OnUpdateNow bool
+
+	// GoType is used to derive the column type from the dialect when Type is empty
+	GoType reflect.Type
 }
 
 // Index represents a database index
 type Index struct {
-	Name    string
+	Name string
+	// Columns are the key parts of the index: column names, or expressions
+	// such as "lower(email)" marked with dialect.IndexExpression
 	Columns []string
 	Unique  bool
+
+	// Where is the predicate of a partial index, which only indexes the rows
+	// matching it, e.g. "deleted_at IS NULL"
+	Where string
 }
 
 // UniqueKey represents a unique constraint
@@ -58,6 +72,10 @@ type ForeignKey struct {
 	ReferenceColumns []string
 	OnDelete         string
 	OnUpdate         string
+
+	// Deferrable makes the constraint DEFERRABLE INITIALLY DEFERRED where
+	// supported (PostgreSQL, SQLite), checking it when the transaction commits
+	Deferrable bool
 }
 
 // NewSchema creates a new schema
@@ -169,7 +187,12 @@ func (t *Table) GenerateCreateTableSQL(d dialect.Dialect) string {
 	var columnDefs []string
 
 	for _, column := range t.Columns {
-		columnDef := fmt.Sprintf("%s %s", d.Quote(column.Name), column.Type)
+		columnType := column.Type
+		if columnType == "" && column.GoType != nil {
+			columnType = d.DataType(column.GoType, column.Size, column.Precision, column.Scale)
+		}
+
+		columnDef := fmt.Sprintf("%s %s", d.Quote(column.Name), columnType)
 
 		if column.IsAutoIncrement {
 			columnDef = fmt.Sprintf("%s %s", d.Quote(column.Name), d.AutoIncrementKeyword())
@@ -180,7 +203,18 @@ func (t *Table) GenerateCreateTableSQL(d dialect.Dialect) string {
 		}
 
 		if column.Default != "" {
-			columnDef += " DEFAULT " + column.Default
+			columnDef += " DEFAULT " + column.defaultLiteral(d)
+		}
+
+		// Expression defaults are parenthesized as MySQL and SQLite require
+		if column.DefaultExpr != "" {
+			columnDef += " DEFAULT (" + column.DefaultExpr + ")"
+		}
+
+		if column.OnUpdateNow {
+			if clause := d.OnUpdateTimestampClause(); clause != "" {
+				columnDef += " " + clause
+			}
 		}
 
 		columnDefs = append(columnDefs, columnDef)
@@ -228,14 +262,151 @@ func (t *Table) GenerateCreateTableSQL(d dialect.Dialect) string {
 			foreignKey.OnDelete,
 			foreignKey.OnUpdate,
 		)
+		if foreignKey.Deferrable && d.Name() != "mysql" {
+			foreignKeyDef += " DEFERRABLE INITIALLY DEFERRED"
+		}
 		columnDefs = append(columnDefs, foreignKeyDef)
 	}
 
-	return d.CreateTableSQL(t.Name, columnDefs, t.PrimaryKey.Name)
+	primaryKey := ""
+	if t.PrimaryKey != nil {
+		primaryKey = t.PrimaryKey.Name
+	}
+
+	return d.CreateTableSQL(t.Name, columnDefs, primaryKey)
+}
+
+// defaultLiteral returns the column's default rendered for the dialect: NULL
+// in any case becomes NULL and boolean defaults such as true, 1 or f become
+// the dialect's boolean literal. Other defaults are used as written.
+func (c *Column) defaultLiteral(d dialect.Dialect) string {
+	if strings.EqualFold(c.Default, "null") {
+		return "NULL"
+	}
+
+	if c.isBoolean() {
+		switch strings.ToLower(strings.Trim(c.Default, "'")) {
+		case "true", "t", "1", "yes":
+			return d.BooleanLiteral(true)
+		case "false", "f", "0", "no":
+			return d.BooleanLiteral(false)
+		}
+	}
+
+	return c.Default
+}
+
+// isBoolean checks if the column stores a boolean, by its Go type or its
+// explicit type
+func (c *Column) isBoolean() bool {
+	if c.Type != "" {
+		columnType := strings.ToLower(c.Type)
+		return columnType == "bool" || columnType == "boolean"
+	}
+
+	goType := c.GoType
+	if goType != nil && goType.Kind() == reflect.Ptr {
+		goType = goType.Elem()
+	}
+	return goType != nil && goType.Kind() == reflect.Bool
+}
+
+// GenerateCreateIndexSQL generates SQL for creating the table's indexes. It
+// fails for partial indexes on databases that do not support them rather
+// than creating an index over every row.
+func (t *Table) GenerateCreateIndexSQL(d dialect.Dialect) ([]string, error) {
+	statements := make([]string, 0, len(t.Indexes))
+	for _, index := range t.Indexes {
+		statement := d.CreateIndexSQL(t.Name, index.Name, index.Columns, index.Unique)
+
+		if index.Where != "" {
+			clause := d.IndexWhereClause(index.Where)
+			if clause == "" {
+				return nil, fmt.Errorf("partial index %s: %s does not support partial indexes", index.Name, d.Name())
+			}
+			statement += " " + clause
+		}
+
+		statements = append(statements, statement)
+	}
+	return statements, nil
+}
+
+// GenerateCreateSQL generates SQL for creating every table in the schema,
+// ordered so that referenced tables are created before the tables referencing them
+func (s *Schema) GenerateCreateSQL(d dialect.Dialect) []string {
+	tables := s.dependencyOrder()
+	statements := make([]string, 0, len(tables))
+	for _, table := range tables {
+		statements = append(statements, table.GenerateCreateTableSQL(d))
+	}
+	return statements
+}
+
+// GenerateDropSQL generates SQL for dropping every table in the schema,
+// ordered so that referencing tables are dropped before the tables they reference
+func (s *Schema) GenerateDropSQL(d dialect.Dialect) []string {
+	tables := s.dependencyOrder()
+	statements := make([]string, 0, len(tables))
+	for i := len(tables) - 1; i >= 0; i-- {
+		statements = append(statements, d.DropTableSQL(tables[i].Name))
+	}
+	return statements
+}
+
+// dependencyOrder sorts the tables topologically by their foreign keys.
+// Self references are ignored, and tables in a reference cycle keep their
+// declaration order after all other tables.
+func (s *Schema) dependencyOrder() []*Table {
+	ordered := make([]*Table, 0, len(s.Tables))
+	placed := make(map[string]bool, len(s.Tables))
+
+	for len(ordered) < len(s.Tables) {
+		progress := false
+		for _, table := range s.Tables {
+			if placed[table.Name] || !s.dependenciesPlaced(table, placed) {
+				continue
+			}
+			ordered = append(ordered, table)
+			placed[table.Name] = true
+			progress = true
+		}
+
+		if !progress {
+			for _, table := range s.Tables {
+				if !placed[table.Name] {
+					ordered = append(ordered, table)
+					placed[table.Name] = true
+				}
+			}
+		}
+	}
+
+	return ordered
 }
 
-// BuildFromStruct builds a schema from a struct
+// dependenciesPlaced checks if every table referenced by the table's foreign
+// keys is either placed or not part of the schema
+func (s *Schema) dependenciesPlaced(table *Table, placed map[string]bool) bool {
+	for _, foreignKey := range table.ForeignKeys {
+		ref := foreignKey.ReferenceTable
+		if ref == table.Name || placed[ref] || s.GetTable(ref) == nil {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// BuildFromStruct builds a schema from a struct, naming indexes and
+// constraints with the DefaultNamingStrategy
 func BuildFromStruct(model interface{}, tableName string) (*Table, error) {
+	return BuildFromStructWithNaming(model, tableName, DefaultNamingStrategy{})
+}
+
+// BuildFromStructWithNaming builds a schema from a struct, naming the indexes
+// and constraints that the tags do not name with the naming strategy
+func BuildFromStructWithNaming(model interface{}, tableName string, naming NamingStrategy) (*Table, error) {
 	v := reflect.ValueOf(model)
 	if v.Kind() == reflect.Ptr {
 		v = v.Elem()
@@ -248,6 +419,10 @@ func BuildFromStruct(model interface{}, tableName string) (*Table, error) {
 	t := v.Type()
 	table := NewTable(tableName)
 
+	// Named unique constraints and indexes shared by several fields
+	uniqueKeys := make(map[string]*UniqueKey)
+	indexes := make(map[string]*Index)
+
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
 
@@ -262,6 +437,11 @@ func BuildFromStruct(model interface{}, tableName string) (*Table, error) {
 			continue
 		}
 
+		// Skip relationship and other non-column fields unless explicitly tagged
+		if tag == "" && !dialect.IsColumnType(field.Type) {
+			continue
+		}
+
 		tagParts := strings.Split(tag, ",")
 		columnName := field.Name
 		if len(tagParts) > 0 && tagParts[0] != "" {
@@ -272,6 +452,7 @@ func BuildFromStruct(model interface{}, tableName string) (*Table, error) {
 		}
 
 		column := NewColumn(columnName, "")
+		column.GoType = field.Type
 
 		// Process tag options
 		for _, opt := range tagParts[1:] {
@@ -284,6 +465,8 @@ func BuildFromStruct(model interface{}, tableName string) (*Table, error) {
 				column.Nullable = true
 			case "unique":
 				column.Unique = true
+			case "onupdate_now":
+				column.OnUpdateNow = true
 			}
 
 			if strings.HasPrefix(opt, "size:") {
@@ -301,6 +484,81 @@ func BuildFromStruct(model interface{}, tableName string) (*Table, error) {
 			if strings.HasPrefix(opt, "default:") {
 				column.Default = strings.TrimPrefix(opt, "default:")
 			}
+
+			if strings.HasPrefix(opt, "default_expr:") {
+				column.DefaultExpr = strings.TrimPrefix(opt, "default_expr:")
+			}
+
+			if strings.HasPrefix(opt, "type:") {
+				column.Type = strings.TrimPrefix(opt, "type:")
+			}
+
+			// bool_as:YN stores a boolean as one of two characters
+			if strings.HasPrefix(opt, "bool_as:") && column.Type == "" {
+				column.Type = "CHAR(1)"
+			}
+
+			// references:<table>.<column> adds a foreign key to the column
+			if strings.HasPrefix(opt, "references:") {
+				reference := strings.TrimPrefix(opt, "references:")
+				referenceTable, referenceColumn, ok := strings.Cut(reference, ".")
+				if !ok {
+					return nil, fmt.Errorf("field %s: references must be <table>.<column>, got %q", field.Name, reference)
+				}
+				table.AddForeignKey(NewForeignKey(
+					naming.ForeignKeyName(tableName, []string{columnName}, referenceTable),
+					[]string{columnName},
+					referenceTable,
+					[]string{referenceColumn},
+				))
+			}
+
+			if strings.HasPrefix(opt, "unique:") {
+				name := strings.TrimPrefix(opt, "unique:")
+				uniqueKey, ok := uniqueKeys[name]
+				if !ok {
+					uniqueKey = NewUniqueKey(name, nil)
+					uniqueKeys[name] = uniqueKey
+					table.AddUniqueKey(uniqueKey)
+				}
+				uniqueKey.Columns = append(uniqueKey.Columns, columnName)
+			}
+
+			if opt == "index" || strings.HasPrefix(opt, "index:") {
+				name := strings.TrimPrefix(strings.TrimPrefix(opt, "index"), ":")
+				if name == "" {
+					name = naming.IndexName(tableName, []string{columnName})
+				}
+				index, ok := indexes[name]
+				if !ok {
+					index = NewIndex(name, nil, false)
+					indexes[name] = index
+					table.AddIndex(index)
+				}
+
+				// The index_expr tag indexes an expression over the column,
+				// e.g. lower(email), rather than the column itself
+				keyPart := columnName
+				if expr := field.Tag.Get("index_expr"); expr != "" {
+					keyPart = dialect.IndexExpression(expr)
+				}
+				index.Columns = append(index.Columns, keyPart)
+
+				// The predicate is a separate tag since it may contain commas
+				if where := field.Tag.Get("index_where"); where != "" {
+					index.Where = where
+				}
+			}
+		}
+
+		// Single-column unique constraints are named by the naming strategy
+		if column.Unique {
+			table.AddUniqueKey(NewUniqueKey(naming.UniqueKeyName(tableName, []string{columnName}), []string{columnName}))
+		}
+
+		// Apply size or precision to an explicit type that has no modifiers
+		if column.Type != "" {
+			column.Type = typeWithModifiers(column.Type, column.Size, column.Precision, column.Scale)
 		}
 
 		table.AddColumn(column)
@@ -309,6 +567,25 @@ func BuildFromStruct(model interface{}, tableName string) (*Table, error) {
 	return table, nil
 }
 
+// typeWithModifiers appends the size or precision and scale to a column type,
+// e.g. timestamptz with precision 6 becomes timestamptz(6)
+func typeWithModifiers(columnType string, size, precision, scale int) string {
+	if strings.Contains(columnType, "(") {
+		return columnType
+	}
+
+	switch {
+	case precision > 0 && scale > 0:
+		return fmt.Sprintf("%s(%d,%d)", columnType, precision, scale)
+	case precision > 0:
+		return fmt.Sprintf("%s(%d)", columnType, precision)
+	case size > 0:
+		return fmt.Sprintf("%s(%d)", columnType, size)
+	}
+
+	return columnType
+}
+
 // toSnakeCase converts a camelCase string to snake_case
 func toSnakeCase(s string) string {
 	var result strings.Builder
@@ -0,0 +1,291 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IMPHNEN/sage/internal/dialect"
+)
+
+func TestBuildFromStructCompositeUnique(t *testing.T) {
+	type account struct {
+		ID       int64  `db:"id,pk,auto"`
+		TenantID int64  `db:"tenant_id,unique:uq_tenant_email"`
+		Email    string `db:"email,unique:uq_tenant_email"`
+	}
+
+	table, err := BuildFromStruct(account{}, "accounts")
+	if err != nil {
+		t.Fatalf("BuildFromStruct: %v", err)
+	}
+
+	if len(table.UniqueKeys) != 1 {
+		t.Fatalf("got %d unique keys, want 1", len(table.UniqueKeys))
+	}
+	uniqueKey := table.UniqueKeys[0]
+	if uniqueKey.Name != "uq_tenant_email" || !reflect.DeepEqual(uniqueKey.Columns, []string{"tenant_id", "email"}) {
+		t.Errorf("unique key = %s %v, want uq_tenant_email [tenant_id email]", uniqueKey.Name, uniqueKey.Columns)
+	}
+
+	sql := table.GenerateCreateTableSQL(dialect.NewDialect("postgres", dialect.Options{}))
+	if want := `CONSTRAINT "uq_tenant_email" UNIQUE ("tenant_id", "email")`; strings.Count(sql, "UNIQUE") != 1 || !strings.Contains(sql, want) {
+		t.Errorf("CREATE TABLE %q lacks the single constraint %s", sql, want)
+	}
+}
+
+func TestBuildFromStructSkipsRelationships(t *testing.T) {
+	type comment struct {
+		ID     int64 `db:"id,pk,auto"`
+		PostID int64 `db:"post_id"`
+	}
+	type post struct {
+		ID       int64      `db:"id,pk,auto"`
+		Title    string     `db:"title"`
+		Comments []*comment // HasMany
+		Pinned   *comment   // HasOne
+	}
+
+	table, err := BuildFromStruct(post{}, "posts")
+	if err != nil {
+		t.Fatalf("BuildFromStruct: %v", err)
+	}
+
+	var columns []string
+	for _, column := range table.Columns {
+		columns = append(columns, column.Name)
+	}
+	if want := []string{"id", "title"}; !reflect.DeepEqual(columns, want) {
+		t.Errorf("columns = %v, want %v", columns, want)
+	}
+}
+
+func TestBuildFromStructTimestampTypes(t *testing.T) {
+	type event struct {
+		CreatedAt time.Time `db:"created_at,type:timestamptz"`
+		LocalAt   time.Time `db:"local_at,type:timestamp"`
+		PreciseAt time.Time `db:"precise_at,precision:6"`
+		NaiveAt   time.Time `db:"naive_at,type:timestamp,precision:3"`
+	}
+
+	table, err := BuildFromStruct(event{}, "events")
+	if err != nil {
+		t.Fatalf("BuildFromStruct: %v", err)
+	}
+
+	tests := []struct {
+		driver  string
+		columns []string
+	}{
+		{"postgres", []string{
+			`"created_at" timestamptz NOT NULL`,
+			`"local_at" timestamp NOT NULL`,
+			`"precise_at" TIMESTAMP(6) WITH TIME ZONE NOT NULL`,
+			`"naive_at" timestamp(3) NOT NULL`,
+		}},
+		{"mysql", []string{"`precise_at` DATETIME(6) NOT NULL"}},
+	}
+
+	for _, tt := range tests {
+		sql := table.GenerateCreateTableSQL(dialect.NewDialect(tt.driver, dialect.Options{}))
+		for _, column := range tt.columns {
+			if !strings.Contains(sql, column) {
+				t.Errorf("%s: CREATE TABLE %q lacks %s", tt.driver, sql, column)
+			}
+		}
+	}
+}
+
+func TestSchemaDependencyOrder(t *testing.T) {
+	type user struct {
+		ID int64 `db:"id,pk,auto"`
+	}
+	type order struct {
+		ID     int64 `db:"id,pk,auto"`
+		UserID int64 `db:"user_id,references:users.id"`
+	}
+
+	orders, err := BuildFromStruct(order{}, "orders")
+	if err != nil {
+		t.Fatalf("BuildFromStruct: %v", err)
+	}
+	users, err := BuildFromStruct(user{}, "users")
+	if err != nil {
+		t.Fatalf("BuildFromStruct: %v", err)
+	}
+
+	// The referencing table is declared first
+	s := NewSchema()
+	s.AddTable(orders)
+	s.AddTable(users)
+
+	d := dialect.NewDialect("postgres", dialect.Options{})
+
+	create := s.GenerateCreateSQL(d)
+	if len(create) != 2 || !strings.Contains(create[0], `"users" (`) || !strings.Contains(create[1], `"orders" (`) {
+		t.Errorf("create statements %q do not create users before orders", create)
+	}
+
+	drop := s.GenerateDropSQL(d)
+	if want := []string{`DROP TABLE IF EXISTS "orders"`, `DROP TABLE IF EXISTS "users"`}; !reflect.DeepEqual(drop, want) {
+		t.Errorf("drop statements = %q, want %q", drop, want)
+	}
+}
+
+func TestBuildFromStructDefaultExpr(t *testing.T) {
+	type session struct {
+		ID     string `db:"id,pk,type:uuid,default_expr:gen_random_uuid()"`
+		UserID int64  `db:"user_id"`
+	}
+
+	table, err := BuildFromStruct(session{}, "sessions")
+	if err != nil {
+		t.Fatalf("BuildFromStruct: %v", err)
+	}
+
+	sql := table.GenerateCreateTableSQL(dialect.NewDialect("postgres", dialect.Options{}))
+	if want := `"id" uuid NOT NULL DEFAULT (gen_random_uuid()),`; !strings.Contains(sql, want) {
+		t.Errorf("CREATE TABLE %q lacks %s", sql, want)
+	}
+}
+
+func TestBooleanAndNullDefaults(t *testing.T) {
+	type flag struct {
+		ID       int64   `db:"id,pk,auto"`
+		Enabled  bool    `db:"enabled,default:true"`
+		Archived *bool   `db:"archived,nullable,default:f"`
+		Visible  int     `db:"visible,type:boolean,default:1"`
+		Note     *string `db:"note,nullable,default:null"`
+		Count    int     `db:"count,default:1"`
+	}
+
+	table, err := BuildFromStruct(flag{}, "flags")
+	if err != nil {
+		t.Fatalf("BuildFromStruct: %v", err)
+	}
+
+	tests := []struct {
+		driver string
+		want   []string
+	}{
+		{"postgres", []string{`"enabled" BOOLEAN NOT NULL DEFAULT TRUE`, `"archived" BOOLEAN DEFAULT FALSE`, `"visible" boolean NOT NULL DEFAULT TRUE`, `DEFAULT NULL`, `NOT NULL DEFAULT 1`}},
+		{"mysql", []string{"`enabled` TINYINT(1) NOT NULL DEFAULT 1", "`archived` TINYINT(1) DEFAULT 0", "`visible` boolean NOT NULL DEFAULT 1", `DEFAULT NULL`, `NOT NULL DEFAULT 1`}},
+		{"sqlite", []string{`"enabled" BOOLEAN NOT NULL DEFAULT 1`, `"archived" BOOLEAN DEFAULT 0`, `"visible" boolean NOT NULL DEFAULT 1`, `DEFAULT NULL`, `NOT NULL DEFAULT 1`}},
+	}
+
+	for _, tt := range tests {
+		sql := table.GenerateCreateTableSQL(dialect.NewDialect(tt.driver, dialect.Options{}))
+		for _, want := range tt.want {
+			if !strings.Contains(sql, want) {
+				t.Errorf("%s: CREATE TABLE %q lacks %s", tt.driver, sql, want)
+			}
+		}
+	}
+}
+
+func TestOnUpdateNowDDL(t *testing.T) {
+	type document struct {
+		ID        int64     `db:"id,pk,auto"`
+		UpdatedAt time.Time `db:"updated_at,onupdate_now"`
+	}
+
+	table, err := BuildFromStruct(document{}, "documents")
+	if err != nil {
+		t.Fatalf("BuildFromStruct: %v", err)
+	}
+
+	for _, driver := range []string{"postgres", "mysql", "sqlite"} {
+		sql := table.GenerateCreateTableSQL(dialect.NewDialect(driver, dialect.Options{}))
+		// Other databases leave the stamping to updates
+		if got, want := strings.Contains(sql, "ON UPDATE CURRENT_TIMESTAMP"), driver == "mysql"; got != want {
+			t.Errorf("%s: CREATE TABLE %q has ON UPDATE CURRENT_TIMESTAMP = %t, want %t", driver, sql, got, want)
+		}
+	}
+}
+
+func TestDeferrableForeignKey(t *testing.T) {
+	table := NewTable("employees")
+	table.AddColumn(NewColumn("id", "BIGINT"))
+	table.AddColumn(NewColumn("manager_id", "BIGINT"))
+	foreignKey := NewForeignKey("fk_manager", []string{"manager_id"}, "employees", []string{"id"})
+	foreignKey.Deferrable = true
+	table.AddForeignKey(foreignKey)
+
+	tests := []struct {
+		driver     string
+		deferrable bool
+	}{
+		{"postgres", true},
+		{"mysql", false},
+		{"sqlite", true},
+	}
+
+	for _, tt := range tests {
+		sql := table.GenerateCreateTableSQL(dialect.NewDialect(tt.driver, dialect.Options{}))
+		if got := strings.Contains(sql, "DEFERRABLE INITIALLY DEFERRED"); got != tt.deferrable {
+			t.Errorf("%s: CREATE TABLE %q deferrable = %t, want %t", tt.driver, sql, got, tt.deferrable)
+		}
+	}
+}
+
+func TestPartialIndex(t *testing.T) {
+	type session struct {
+		ID     int64  `db:"id,pk,auto"`
+		UserID int64  `db:"user_id,index:idx_active_sessions" index_where:"revoked_at IS NULL"`
+		Token  string `db:"token"`
+	}
+
+	table, err := BuildFromStruct(session{}, "sessions")
+	if err != nil {
+		t.Fatalf("BuildFromStruct: %v", err)
+	}
+	if len(table.Indexes) != 1 || table.Indexes[0].Where != "revoked_at IS NULL" {
+		t.Fatalf("indexes = %+v, want idx_active_sessions with its predicate", table.Indexes)
+	}
+
+	tests := []struct {
+		driver string
+		suffix string
+	}{
+		{"postgres", ` WHERE revoked_at IS NULL`},
+		{"sqlite", ` WHERE revoked_at IS NULL`},
+		{"mysql", ""},
+	}
+
+	for _, tt := range tests {
+		statements, err := table.GenerateCreateIndexSQL(dialect.NewDialect(tt.driver, dialect.Options{}))
+		if tt.suffix == "" {
+			if err == nil {
+				t.Errorf("%s: GenerateCreateIndexSQL = %q, want an unsupported partial index error", tt.driver, statements)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: GenerateCreateIndexSQL: %v", tt.driver, err)
+		}
+		if len(statements) != 1 || !strings.HasSuffix(statements[0], tt.suffix) || !strings.Contains(statements[0], "idx_active_sessions") {
+			t.Errorf("%s: statements = %q, want the index ending with %q", tt.driver, statements, tt.suffix)
+		}
+	}
+}
+
+func TestExpressionIndex(t *testing.T) {
+	type user struct {
+		ID    int64  `db:"id,pk,auto"`
+		Email string `db:"email,index:idx_users_email_lower" index_expr:"lower(email)"`
+	}
+
+	table, err := BuildFromStruct(user{}, "users")
+	if err != nil {
+		t.Fatalf("BuildFromStruct: %v", err)
+	}
+
+	statements, err := table.GenerateCreateIndexSQL(dialect.NewDialect("postgres", dialect.Options{}))
+	if err != nil {
+		t.Fatalf("GenerateCreateIndexSQL: %v", err)
+	}
+	if want := `CREATE INDEX "idx_users_email_lower" ON "users" ((lower(email)))`; len(statements) != 1 || statements[0] != want {
+		t.Errorf("statements = %q, want %q", statements, want)
+	}
+}
@@ -0,0 +1,397 @@
+// Package testdb provides a fake database/sql driver for tests. It is
+// registered under the postgres, mysql and sqlite driver names, records every
+// statement it receives and answers them with responses configured per test,
+// so that the SQL generated for each dialect can be checked without a
+// database server.
+package testdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Drivers are the driver names the fake driver is registered under
+var Drivers = []string{"postgres", "mysql", "sqlite"}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*DB)
+)
+
+func init() {
+	for _, name := range Drivers {
+		sql.Register(name, fakeDriver{})
+	}
+}
+
+// Statement is a statement received by a fake database. Transactions are
+// recorded as BEGIN, COMMIT and ROLLBACK statements.
+type Statement struct {
+	Query string
+	Args  []driver.Value
+	// Conn identifies the pooled connection the statement ran on
+	Conn int
+}
+
+// rule answers the statements containing match
+type rule struct {
+	match    string
+	columns  []string
+	rows     [][]driver.Value
+	count    int
+	row      func(i int) []driver.Value
+	err      error
+	affected int64
+	insertID int64
+	idFunc   func(args []driver.Value) int64
+	hasID    bool
+	block    bool
+	delay    time.Duration
+	once     bool
+}
+
+// DB is a fake database. Its DSN opens connections to it with any of the
+// registered driver names.
+type DB struct {
+	mu         sync.Mutex
+	dsn        string
+	statements []Statement
+	rules      []*rule
+	txOptions  []driver.TxOptions
+	conns      int
+}
+
+// New returns an empty fake database. Statements affect one row and queries
+// return no rows until responses are configured.
+func New() *DB {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	db := &DB{dsn: fmt.Sprintf("testdb-%d", len(registry)+1)}
+	registry[db.dsn] = db
+	return db
+}
+
+// DSN returns the data source name opening connections to the database
+func (db *DB) DSN() string {
+	return db.dsn
+}
+
+// Returns makes queries containing match return the rows. The responses
+// configured last take precedence.
+func (db *DB) Returns(match string, columns []string, rows ...[]driver.Value) {
+	db.add(&rule{match: match, columns: columns, rows: rows, affected: int64(len(rows))})
+}
+
+// ReturnsOnce is like Returns but only answers the next matching query
+func (db *DB) ReturnsOnce(match string, columns []string, rows ...[]driver.Value) {
+	db.add(&rule{match: match, columns: columns, rows: rows, affected: int64(len(rows)), once: true})
+}
+
+// ReturnsFunc makes queries containing match return n rows, each generated
+// by row as it is read, e.g. to cancel a context partway through a result
+func (db *DB) ReturnsFunc(match string, columns []string, n int, row func(i int) []driver.Value) {
+	db.add(&rule{match: match, columns: columns, count: n, row: row})
+}
+
+// Affects makes statements containing match report n affected rows
+func (db *DB) Affects(match string, n int64) {
+	db.add(&rule{match: match, affected: n})
+}
+
+// InsertID makes statements containing match affect one row and report id as
+// the last insert id
+func (db *DB) InsertID(match string, id int64) {
+	db.add(&rule{match: match, affected: 1, insertID: id, hasID: true})
+}
+
+// InsertIDFunc is like InsertID but reports the id fn returns for the
+// arguments of each statement
+func (db *DB) InsertIDFunc(match string, fn func(args []driver.Value) int64) {
+	db.add(&rule{match: match, affected: 1, idFunc: fn, hasID: true})
+}
+
+// Fails makes statements containing match fail with err
+func (db *DB) Fails(match string, err error) {
+	db.add(&rule{match: match, err: err})
+}
+
+// FailsOnce makes the next statement containing match fail with err
+func (db *DB) FailsOnce(match string, err error) {
+	db.add(&rule{match: match, err: err, once: true})
+}
+
+// Blocks makes statements containing match wait until their context is done
+// and fail with its error
+func (db *DB) Blocks(match string) {
+	db.add(&rule{match: match, block: true})
+}
+
+// Delays makes statements containing match take at least d, or until their
+// context is done
+func (db *DB) Delays(match string, d time.Duration) {
+	db.add(&rule{match: match, delay: d})
+}
+
+// add adds a response rule
+func (db *DB) add(r *rule) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.rules = append(db.rules, r)
+}
+
+// Statements returns the statements received so far, in order
+func (db *DB) Statements() []Statement {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]Statement(nil), db.statements...)
+}
+
+// Queries returns the text of the statements received so far, in order
+func (db *DB) Queries() []string {
+	statements := db.Statements()
+	queries := make([]string, len(statements))
+	for i, statement := range statements {
+		queries[i] = statement.Query
+	}
+	return queries
+}
+
+// TxOptions returns the options of the transactions begun so far
+func (db *DB) TxOptions() []driver.TxOptions {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]driver.TxOptions(nil), db.txOptions...)
+}
+
+// Reset forgets the statements received so far, keeping the responses
+func (db *DB) Reset() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.statements = nil
+	db.txOptions = nil
+}
+
+// receive records a statement and returns the rule answering it, if any
+func (db *DB) receive(conn int, query string, args []driver.Value) *rule {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.statements = append(db.statements, Statement{Query: query, Args: args, Conn: conn})
+	for i := len(db.rules) - 1; i >= 0; i-- {
+		r := db.rules[i]
+		if strings.Contains(query, r.match) {
+			if r.once {
+				db.rules = append(db.rules[:i], db.rules[i+1:]...)
+			}
+			return r
+		}
+	}
+	return nil
+}
+
+// fakeDriver opens connections to the fake database named by the DSN
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	registryMu.Lock()
+	db, ok := registry[dsn]
+	registryMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("testdb: unknown database %q", dsn)
+	}
+
+	db.mu.Lock()
+	db.conns++
+	id := db.conns
+	db.mu.Unlock()
+
+	return &conn{db: db, id: id}, nil
+}
+
+// conn is a connection to a fake database
+type conn struct {
+	db *DB
+	id int
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+func (c *conn) Close() error { return nil }
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.db.mu.Lock()
+	c.db.txOptions = append(c.db.txOptions, opts)
+	c.db.mu.Unlock()
+
+	if r := c.db.receive(c.id, "BEGIN", nil); r != nil && r.err != nil {
+		return nil, r.err
+	}
+	return &tx{conn: c}, nil
+}
+
+func (c *conn) Ping(ctx context.Context) error { return nil }
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r, err := c.answer(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return result{affected: 1}, nil
+	}
+	if r.idFunc != nil {
+		return result{affected: r.affected, insertID: r.idFunc(values(args)), hasID: true}, nil
+	}
+	return result{affected: r.affected, insertID: r.insertID, hasID: r.hasID}, nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	r, err := c.answer(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return &rows{}, nil
+	}
+	return &rows{columns: r.columns, rows: r.rows, count: r.count, row: r.row}, nil
+}
+
+// answer records a statement and returns the rule answering it
+func (c *conn) answer(ctx context.Context, query string, named []driver.NamedValue) (*rule, error) {
+	r := c.db.receive(c.id, query, values(named))
+	if r == nil {
+		return nil, nil
+	}
+	if r.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if r.delay > 0 {
+		select {
+		case <-time.After(r.delay):
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r, nil
+}
+
+// stmt is a prepared statement of a fake connection
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Close() error  { return nil }
+func (s *stmt) NumInput() int { return -1 }
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, named(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, named(args))
+}
+
+// values converts named values to positional values
+func values(named []driver.NamedValue) []driver.Value {
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+	return args
+}
+
+// named converts positional values to named values
+func named(args []driver.Value) []driver.NamedValue {
+	values := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		values[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return values
+}
+
+// tx is a transaction of a fake connection
+type tx struct {
+	conn *conn
+}
+
+func (t *tx) Commit() error {
+	if r := t.conn.db.receive(t.conn.id, "COMMIT", nil); r != nil && r.err != nil {
+		return r.err
+	}
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	if r := t.conn.db.receive(t.conn.id, "ROLLBACK", nil); r != nil && r.err != nil {
+		return r.err
+	}
+	return nil
+}
+
+// result is the result of a statement
+type result struct {
+	affected int64
+	insertID int64
+	hasID    bool
+}
+
+func (r result) LastInsertId() (int64, error) {
+	if !r.hasID {
+		return 0, errors.New("testdb: no insert id")
+	}
+	return r.insertID, nil
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return r.affected, nil
+}
+
+// rows are the rows returned by a query
+type rows struct {
+	columns []string
+	rows    [][]driver.Value
+	count   int
+	row     func(i int) []driver.Value
+	next    int
+}
+
+func (r *rows) Columns() []string { return r.columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.row != nil {
+		if r.next >= r.count {
+			return io.EOF
+		}
+		copy(dest, r.row(r.next))
+		r.next++
+		return nil
+	}
+
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
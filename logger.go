@@ -0,0 +1,163 @@
+package sage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/IMPHNEN/sage/internal/dialect"
+)
+
+// LogLevel indicates the kind of event being logged for a query
+type LogLevel int
+
+const (
+	// LogLevelQuery is used for queries that completed normally
+	LogLevelQuery LogLevel = iota
+	// LogLevelSlow is used for queries that took longer than the slow threshold
+	LogLevelSlow
+	// LogLevelError is used for queries that returned an error
+	LogLevelError
+)
+
+// String returns the name of the log level
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelQuery:
+		return "query"
+	case LogLevelSlow:
+		return "slow"
+	case LogLevelError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// Logger receives every query executed through a Connection
+type Logger interface {
+	LogQuery(ctx context.Context, level LogLevel, query string, args []interface{}, duration time.Duration, err error)
+}
+
+// LoggerFunc adapts a function to the Logger interface
+type LoggerFunc func(ctx context.Context, level LogLevel, query string, args []interface{}, duration time.Duration, err error)
+
+// LogQuery calls f with the query details
+func (f LoggerFunc) LogQuery(ctx context.Context, level LogLevel, query string, args []interface{}, duration time.Duration, err error) {
+	f(ctx, level, query, args, duration, err)
+}
+
+// logQuery reports a finished query to the configured logger
+func (c *Connection) logQuery(ctx context.Context, query string, args []interface{}, duration time.Duration, err error) {
+	if c.options.Logger == nil {
+		return
+	}
+
+	level := LogLevelQuery
+	switch {
+	case err != nil && err != sql.ErrNoRows:
+		level = LogLevelError
+	case c.options.SlowThreshold > 0 && duration >= c.options.SlowThreshold:
+		level = LogLevelSlow
+	}
+
+	c.options.Logger.LogQuery(ctx, level, query, args, duration, err)
+}
+
+// exec executes a statement, in the context's transaction if any, and logs it.
+// Statements are rejected with ErrReadOnlyMode while the connection is read-only.
+func (c *Connection) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if c.IsReadOnly() {
+		return nil, ErrReadOnlyMode
+	}
+
+	query, args, err := c.prepare(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	c.record(query, args)
+	start := time.Now()
+	result, err := c.executor(ctx).ExecContext(ctx, query, args...)
+	c.logQuery(ctx, query, args, time.Since(start), err)
+	return result, err
+}
+
+// query executes a query that returns rows, in the context's transaction if
+// any, and logs it
+func (c *Connection) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	query, args, err := c.prepare(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	c.record(query, args)
+	start := time.Now()
+	rows, err := c.executor(ctx).QueryContext(ctx, query, args...)
+	c.logQuery(ctx, query, args, time.Since(start), err)
+	return rows, err
+}
+
+// queryRow executes a query that returns a single row, in the context's
+// transaction if any, and logs it
+func (c *Connection) queryRow(ctx context.Context, query string, args ...interface{}) rowScanner {
+	query, args, err := c.prepare(ctx, query, args)
+	if err != nil {
+		return errRow{err: err}
+	}
+
+	c.record(query, args)
+	start := time.Now()
+	row := c.executor(ctx).QueryRowContext(ctx, query, args...)
+	c.logQuery(ctx, query, args, time.Since(start), row.Err())
+	return row
+}
+
+// prepare rewrites a statement with the interceptors, checks that it has a
+// placeholder for every argument and binds its ? placeholders to the
+// connection's dialect, so that SQL built without a dialect runs on every
+// database
+func (c *Connection) prepare(ctx context.Context, query string, args []interface{}) (string, []interface{}, error) {
+	query, args, err := c.intercept(ctx, query, args)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := checkPlaceholders(query, args); err != nil {
+		return "", nil, err
+	}
+	return dialect.Rebind(c.dialect, query), args, nil
+}
+
+// checkPlaceholders returns ErrInvalidArgument when the number of
+// placeholders in a query does not match the number of arguments, which the
+// drivers otherwise report with a less helpful error. Queries with named
+// arguments are not checked.
+func checkPlaceholders(query string, args []interface{}) error {
+	for _, arg := range args {
+		if _, ok := arg.(sql.NamedArg); ok {
+			return nil
+		}
+	}
+
+	if expected := dialect.CountPlaceholders(query); expected != len(args) {
+		return fmt.Errorf("%w: query has %d placeholders but %d arguments were given: %s",
+			ErrInvalidArgument, expected, len(args), query)
+	}
+	return nil
+}
+
+// rowScanner is a single row result returned by queryRow
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// errRow is a row whose query failed before it was executed
+type errRow struct {
+	err error
+}
+
+// Scan returns the error that prevented the query from running
+func (r errRow) Scan(dest ...interface{}) error {
+	return r.err
+}
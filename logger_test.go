@@ -0,0 +1,111 @@
+package sage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// logEntry is a query reported to a test logger
+type logEntry struct {
+	level    LogLevel
+	query    string
+	duration time.Duration
+}
+
+// testLogger collects the queries reported to it
+type testLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *testLogger) LogQuery(ctx context.Context, level LogLevel, query string, args []interface{}, duration time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, logEntry{level: level, query: query, duration: duration})
+}
+
+func TestSlowQueryLogging(t *testing.T) {
+	logger := &testLogger{}
+	c, db := openTestConnection(t, ConnectionOptions{
+		Driver:        "postgres",
+		Logger:        logger,
+		SlowThreshold: 50 * time.Millisecond,
+	})
+	db.Delays("pg_sleep", 60*time.Millisecond)
+
+	ctx := context.Background()
+	if _, err := c.Exec(ctx, "SELECT 1"); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if _, err := c.Exec(ctx, "SELECT pg_sleep(0.06)"); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	if len(logger.entries) != 2 {
+		t.Fatalf("logged %d queries, want 2", len(logger.entries))
+	}
+	if fast := logger.entries[0]; fast.level != LogLevelQuery {
+		t.Errorf("fast query logged at %s, want query", fast.level)
+	}
+	slow := logger.entries[1]
+	if slow.level != LogLevelSlow {
+		t.Errorf("slow query logged at %s, want slow", slow.level)
+	}
+	if slow.query != "SELECT pg_sleep(0.06)" || slow.duration < 50*time.Millisecond {
+		t.Errorf("slow query logged as %q taking %s", slow.query, slow.duration)
+	}
+}
+
+func TestRawStatementsAreLogged(t *testing.T) {
+	logger := &testLogger{}
+	c, _ := openTestConnection(t, ConnectionOptions{Driver: "postgres", Logger: logger})
+	ctx := context.Background()
+
+	if _, err := c.Exec(ctx, "UPDATE users SET name = ? WHERE id = ?", "Ann", 1); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	rows, err := c.QueryRaw(ctx, "SELECT id FROM users")
+	if err != nil {
+		t.Fatalf("QueryRaw: %v", err)
+	}
+	rows.Close()
+
+	if len(logger.entries) != 2 {
+		t.Fatalf("logged %d statements, want 2", len(logger.entries))
+	}
+	if got, want := logger.entries[0].query, "UPDATE users SET name = $1 WHERE id = $2"; got != want {
+		t.Errorf("logged Exec %q, want %q", got, want)
+	}
+	if got, want := logger.entries[1].query, "SELECT id FROM users"; got != want {
+		t.Errorf("logged QueryRaw %q, want %q", got, want)
+	}
+}
+
+func TestPlaceholderCountMismatch(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	ctx := context.Background()
+
+	var users []testUser
+	err := c.All(ctx, &users, "name = ? AND email = ?", "Ann")
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("All with too few arguments = %v, want ErrInvalidArgument", err)
+	}
+	if !strings.Contains(err.Error(), "query has 2 placeholders but 1 arguments were given") {
+		t.Errorf("error %q does not describe the mismatch", err)
+	}
+	if _, err := c.Exec(ctx, "DELETE FROM users WHERE id = ?", 1, 2); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Exec with too many arguments = %v, want ErrInvalidArgument", err)
+	}
+	if queries := db.Queries(); len(queries) != 0 {
+		t.Errorf("executed %q despite the mismatch", queries)
+	}
+
+	// Numbered placeholders may repeat an argument
+	if _, err := c.Exec(ctx, "UPDATE users SET name = $1 WHERE name = $1 OR email = $2", "Ann", "a@example.com"); err != nil {
+		t.Errorf("Exec with repeated numbered placeholders: %v", err)
+	}
+}
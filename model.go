@@ -1,9 +1,15 @@
 package sage
 
 import (
+	"context"
+	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/IMPHNEN/sage/internal/dialect"
 )
 
 // Model represents a database model
@@ -12,11 +18,58 @@ type Model interface {
 	PrimaryKey() string
 }
 
+// ModelConfig configures the mapping of a model without struct tags, e.g.
+// for types declared in another package. Set values override the struct's
+// tags and its Model methods.
+type ModelConfig struct {
+	// TableName is the table the model is stored in
+	TableName string
+	// PrimaryKey is the primary key column
+	PrimaryKey string
+	// AutoIncrement marks the primary key as generated by the database
+	AutoIncrement bool
+	// Columns maps field names to column names
+	Columns map[string]string
+}
+
+var (
+	modelConfigsMu sync.RWMutex
+	modelConfigs   = make(map[reflect.Type]ModelConfig)
+)
+
+// RegisterModel registers the mapping of a model's struct type, used by every
+// connection. model is a struct or a pointer to one.
+func RegisterModel(model interface{}, config ModelConfig) error {
+	t := reflect.TypeOf(model)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return ErrNotAStruct
+	}
+
+	modelConfigsMu.Lock()
+	defer modelConfigsMu.Unlock()
+	modelConfigs[t] = config
+	return nil
+}
+
+// modelConfig returns the configuration registered for the struct type
+func modelConfig(t reflect.Type) (ModelConfig, bool) {
+	modelConfigsMu.RLock()
+	defer modelConfigsMu.RUnlock()
+	config, ok := modelConfigs[t]
+	return config, ok
+}
+
 // ModelInfo contains metadata about a model
 type ModelInfo struct {
 	TableName  string
 	PrimaryKey string
-	Fields     []FieldInfo
+	// PrimaryKeyField is the Go name of the field mapped to PrimaryKey, or
+	// empty if no field maps to it
+	PrimaryKeyField string
+	Fields          []FieldInfo
 }
 
 // FieldInfo contains metadata about a model field
@@ -33,6 +86,21 @@ type FieldInfo struct {
 	Precision int
 	Scale     int
 	Tags      map[string]string
+
+	// DefaultExpr is a database expression generating the column's default value
+	DefaultExpr string
+	// Transform names the Transformer applied to the column, see RegisterTransformer
+	Transform string
+	// OnUpdateNow sets the timestamp column to the current time on every update
+	OnUpdateNow bool
+	// BoolAs holds the characters storing true and false, e.g. "YN", for a
+	// boolean stored as text, see the bool_as tag option
+	BoolAs string
+	// Immutable fields are inserted but never updated, see the immutable tag option
+	Immutable bool
+	// OmitEmpty leaves the column out of the INSERT of Create when the field
+	// is its zero value, so that the column's default or NULL applies
+	OmitEmpty bool
 }
 
 // extractModelInfo extracts model information from a struct using reflection
@@ -65,6 +133,11 @@ func extractModelInfo(model interface{}) (*ModelInfo, error) {
 		primaryKey = "id"
 	}
 
+	config, _ := modelConfig(t)
+	if config.TableName != "" {
+		tableName = config.TableName
+	}
+
 	info := &ModelInfo{
 		TableName:  tableName,
 		PrimaryKey: primaryKey,
@@ -86,6 +159,12 @@ func extractModelInfo(model interface{}) (*ModelInfo, error) {
 			continue
 		}
 
+		// Skip relationships and fields no database can store, such as
+		// callbacks, unless tagged, as the schema package does
+		if tag == "" && !dialect.IsColumnType(field.Type) {
+			continue
+		}
+
 		fieldInfo := FieldInfo{
 			Name:   field.Name,
 			Type:   field.Type,
@@ -98,6 +177,9 @@ func extractModelInfo(model interface{}) (*ModelInfo, error) {
 		if len(tagParts) > 0 && tagParts[0] != "" {
 			fieldInfo.DBName = tagParts[0]
 		}
+		if column, ok := config.Columns[field.Name]; ok {
+			fieldInfo.DBName = column
+		}
 
 		for _, opt := range tagParts[1:] {
 			switch opt {
@@ -112,6 +194,12 @@ func extractModelInfo(model interface{}) (*ModelInfo, error) {
 				fieldInfo.Unique = true
 			case "index":
 				fieldInfo.Index = true
+			case "onupdate_now":
+				fieldInfo.OnUpdateNow = true
+			case "immutable":
+				fieldInfo.Immutable = true
+			case "omitempty":
+				fieldInfo.OmitEmpty = true
 			}
 
 			// Handle size, precision, scale
@@ -132,14 +220,179 @@ func extractModelInfo(model interface{}) (*ModelInfo, error) {
 				scale := strings.TrimPrefix(opt, "scale:")
 				fieldInfo.Scale, _ = strconv.Atoi(scale)
 			}
+
+			if strings.HasPrefix(opt, "default_expr:") {
+				fieldInfo.DefaultExpr = strings.TrimPrefix(opt, "default_expr:")
+			}
+
+			if strings.HasPrefix(opt, "transform:") {
+				fieldInfo.Transform = strings.TrimPrefix(opt, "transform:")
+			}
+
+			// bool_as:YN stores a boolean as Y or N, e.g. in a CHAR(1) column
+			if strings.HasPrefix(opt, "bool_as:") {
+				if chars := strings.TrimPrefix(opt, "bool_as:"); utf8.RuneCountInString(chars) == 2 {
+					fieldInfo.BoolAs = chars
+				}
+			}
 		}
 
 		info.Fields = append(info.Fields, fieldInfo)
 	}
 
+	// A configured primary key replaces the one tagged pk
+	if config.PrimaryKey != "" {
+		info.PrimaryKey = config.PrimaryKey
+		for i := range info.Fields {
+			field := &info.Fields[i]
+			field.IsKey = field.DBName == config.PrimaryKey
+			field.IsAuto = field.IsAuto || field.IsKey && config.AutoIncrement
+		}
+	}
+
+	if pk, ok := fieldByColumn(info, info.PrimaryKey); ok {
+		info.PrimaryKeyField = pk.Name
+	}
+
 	return info, nil
 }
 
+// modelInfo extracts the model information of a model used with the context,
+// prefixing its table name with ConnectionOptions.TablePrefix
+func (c *Connection) modelInfo(ctx context.Context, model interface{}) (*ModelInfo, error) {
+	info, err := extractModelInfo(model)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.options.TablePrefix != nil {
+		info.TableName = c.options.TablePrefix(ctx) + info.TableName
+	}
+	return info, nil
+}
+
+// fieldByColumn returns the field of the model mapped to the column
+func fieldByColumn(info *ModelInfo, column string) (FieldInfo, bool) {
+	for _, field := range info.Fields {
+		if field.DBName == column {
+			return field, true
+		}
+	}
+	return FieldInfo{}, false
+}
+
+// columnField returns the field of the struct value mapped to the column,
+// resolved through the model info so that custom db tags are honored
+func columnField(v reflect.Value, info *ModelInfo, column string) (reflect.Value, error) {
+	field, ok := fieldByColumn(info, column)
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("%w: no field of %s maps to column %s", ErrInvalidArgument, info.TableName, column)
+	}
+	return v.FieldByName(field.Name), nil
+}
+
+// primaryKeyField returns the primary key field of the struct value
+func primaryKeyField(v reflect.Value, info *ModelInfo) (reflect.Value, error) {
+	if info.PrimaryKeyField == "" {
+		return reflect.Value{}, fmt.Errorf("%w: no field of %s maps to primary key %s", ErrNoID, info.TableName, info.PrimaryKey)
+	}
+	return v.FieldByName(info.PrimaryKeyField), nil
+}
+
+// setColumnField sets the field of the addressable struct value mapped to the
+// column, converting value to the field's type
+func setColumnField(v reflect.Value, column string, value reflect.Value) error {
+	if !v.CanAddr() {
+		return fmt.Errorf("%w: cannot set column %s of an unaddressable model", ErrInvalidArgument, column)
+	}
+
+	info, err := extractModelInfo(v.Addr().Interface())
+	if err != nil {
+		return err
+	}
+
+	field, err := columnField(v, info, column)
+	if err != nil {
+		return err
+	}
+	if !value.Type().ConvertibleTo(field.Type()) {
+		return fmt.Errorf("%w: cannot set column %s of %s to a %s", ErrInvalidArgument, column, info.TableName, value.Type())
+	}
+
+	field.Set(value.Convert(field.Type()))
+	return nil
+}
+
+// IndexByPK returns the models of the slice keyed by their primary key value.
+// Models are structs or pointers to structs; []byte keys are converted to string.
+func IndexByPK[T any](models []T) (map[interface{}]T, error) {
+	index := make(map[interface{}]T, len(models))
+	if len(models) == 0 {
+		return index, nil
+	}
+
+	info, err := extractModelInfo(models[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if info.PrimaryKeyField == "" {
+		return nil, ErrNoID
+	}
+
+	for _, model := range models {
+		v := reflect.ValueOf(model)
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil, ErrNotAStruct
+			}
+			v = v.Elem()
+		}
+
+		key := v.FieldByName(info.PrimaryKeyField).Interface()
+		if b, ok := key.([]byte); ok {
+			key = string(b)
+		}
+		index[key] = model
+	}
+
+	return index, nil
+}
+
+// columnFieldIndexes returns, for each column, the index of the model field it
+// maps to in the struct type t, or nil when the column has no matching field.
+// Columns are matched to field DB names case-insensitively.
+func columnFieldIndexes(info *ModelInfo, t reflect.Type, columns []string) [][]int {
+	byColumn := make(map[string][]int, len(info.Fields))
+	for _, field := range info.Fields {
+		if structField, ok := t.FieldByName(field.Name); ok {
+			byColumn[strings.ToLower(field.DBName)] = structField.Index
+		}
+	}
+
+	indexes := make([][]int, len(columns))
+	for i, col := range columns {
+		indexes[i] = byColumn[strings.ToLower(col)]
+	}
+	return indexes
+}
+
+// columnFields returns, for each column, the model field it maps to, or the
+// zero FieldInfo when the column has no matching field. Columns are matched
+// like columnFieldIndexes.
+func columnFields(info *ModelInfo, columns []string) []FieldInfo {
+	fields := make([]FieldInfo, len(columns))
+	for i, col := range columns {
+		for _, field := range info.Fields {
+			if strings.EqualFold(field.DBName, col) {
+				fields[i] = field
+				break
+			}
+		}
+	}
+	return fields
+}
+
 // parseTags parses struct tags into a map
 func parseTags(tag reflect.StructTag) map[string]string {
 	result := make(map[string]string)
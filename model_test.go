@@ -0,0 +1,301 @@
+package sage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/IMPHNEN/sage/internal/schema"
+)
+
+func TestIndexByPK(t *testing.T) {
+	users := []*testUser{{ID: 3, Name: "Ann"}, {ID: 7, Name: "Bob"}}
+	index, err := IndexByPK(users)
+	if err != nil {
+		t.Fatalf("IndexByPK: %v", err)
+	}
+	if len(index) != 2 || index[int64(3)] != users[0] || index[int64(7)] != users[1] {
+		t.Errorf("IndexByPK = %v, want users 3 and 7", index)
+	}
+	if _, ok := index[int64(5)]; ok {
+		t.Error("IndexByPK has a user 5")
+	}
+
+	// Values and string keys
+	settings, err := IndexByPK([]testSetting{{"theme", "dark"}, {"lang", "en"}})
+	if err != nil {
+		t.Fatalf("IndexByPK: %v", err)
+	}
+	if settings["lang"].Value != "en" {
+		t.Errorf("setting lang = %+v, want en", settings["lang"])
+	}
+
+	if _, err := IndexByPK([]*testUser{nil}); !errors.Is(err, ErrNotAStruct) {
+		t.Errorf("IndexByPK with a nil model = %v, want ErrNotAStruct", err)
+	}
+}
+
+// testOwner's primary key column is not the snake case of its field name
+type testOwner struct {
+	ID     int64        `db:"user_id,pk,auto"`
+	Name   string       `db:"name"`
+	Tokens []*testToken `db:"-"`
+}
+
+func (testOwner) TableName() string  { return "owners" }
+func (testOwner) PrimaryKey() string { return "user_id" }
+
+// testToken belongs to an owner
+type testToken struct {
+	ID     int64  `db:"id,pk,auto"`
+	UserID int64  `db:"user_id"`
+	Value  string `db:"value"`
+}
+
+func (testToken) TableName() string  { return "tokens" }
+func (testToken) PrimaryKey() string { return "id" }
+
+func TestPrimaryKeyFieldName(t *testing.T) {
+	info, err := extractModelInfo(&testOwner{})
+	if err != nil {
+		t.Fatalf("extractModelInfo: %v", err)
+	}
+	if info.PrimaryKeyField != "ID" {
+		t.Errorf("PrimaryKeyField = %q, want ID", info.PrimaryKeyField)
+	}
+
+	c, db := newTestConnection(t, "postgres")
+	ctx := context.Background()
+	db.Returns("FROM owners", []string{"user_id", "name"}, []driver.Value{int64(5), "Ann"})
+	db.Returns(`FROM tokens`, []string{"id", "user_id", "value"},
+		[]driver.Value{int64(1), int64(5), "a"},
+		[]driver.Value{int64(2), int64(5), "b"},
+	)
+
+	owner := &testOwner{}
+	if err := c.Find(ctx, owner, 5); err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if owner.ID != 5 || owner.Name != "Ann" {
+		t.Errorf("Find = %+v, want owner 5", owner)
+	}
+	tokens := &Relationship{Type: HasMany, Model: &testToken{}, ForeignKey: "user_id", ReferenceKey: "user_id"}
+	if err := c.Preload(ctx, owner, map[string]*Relationship{"Tokens": tokens}); err != nil {
+		t.Fatalf("Preload: %v", err)
+	}
+	if len(owner.Tokens) != 2 {
+		t.Errorf("preloaded %d tokens, want 2", len(owner.Tokens))
+	}
+	if err := c.Refresh(ctx, owner); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if err := c.Delete(ctx, owner); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	statements := db.Statements()
+	if len(statements) != 4 {
+		t.Fatalf("got %d statements, want 4", len(statements))
+	}
+	for _, statement := range statements {
+		if len(statement.Args) != 1 || statement.Args[0] != int64(5) {
+			t.Errorf("%q with %v does not select owner 5", statement.Query, statement.Args)
+		}
+	}
+
+	index, err := IndexByPK([]*testOwner{owner})
+	if err != nil || index[int64(5)] != owner {
+		t.Errorf("IndexByPK = %v, %v, want owner 5", index, err)
+	}
+}
+
+// legacyInvoice is mapped with RegisterModel rather than tags
+type legacyInvoice struct {
+	Number       int64
+	CustomerName string
+	Amount       float64
+}
+
+func TestRegisterModel(t *testing.T) {
+	err := RegisterModel(&legacyInvoice{}, ModelConfig{
+		TableName:     "invoices",
+		PrimaryKey:    "invoice_no",
+		AutoIncrement: true,
+		Columns:       map[string]string{"Number": "invoice_no", "CustomerName": "customer"},
+	})
+	if err != nil {
+		t.Fatalf("RegisterModel: %v", err)
+	}
+
+	c, db := newTestConnection(t, "mysql")
+	db.InsertID("INSERT INTO", 12)
+	ctx := context.Background()
+
+	invoice := &legacyInvoice{CustomerName: "Ann", Amount: 9.5}
+	if err := c.Create(ctx, invoice); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if invoice.Number != 12 {
+		t.Errorf("Number = %d, want the generated 12", invoice.Number)
+	}
+	if err := c.Find(ctx, &legacyInvoice{}, 12); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Find = %v, want ErrNotFound", err)
+	}
+	assertQueries(t, db,
+		"INSERT INTO invoices (customer, amount) VALUES (?, ?)",
+		"SELECT * FROM invoices WHERE invoice_no = ?",
+	)
+
+	if err := RegisterModel(42, ModelConfig{}); !errors.Is(err, ErrNotAStruct) {
+		t.Errorf("RegisterModel of an int = %v, want ErrNotAStruct", err)
+	}
+}
+
+// testHook has exported fields no column can store
+type testHook struct {
+	ID      int64  `db:"id,pk,auto"`
+	URL     string `db:"url"`
+	OnFire  func()
+	Events  chan string
+	Weight  complex128
+	Retries int
+}
+
+func (testHook) TableName() string  { return "hooks" }
+func (testHook) PrimaryKey() string { return "id" }
+
+func TestUnstorableFieldsAreSkipped(t *testing.T) {
+	info, err := extractModelInfo(&testHook{})
+	if err != nil {
+		t.Fatalf("extractModelInfo: %v", err)
+	}
+	var columns []string
+	for _, field := range info.Fields {
+		columns = append(columns, field.DBName)
+	}
+	if want := []string{"id", "url", "retries"}; !reflect.DeepEqual(columns, want) {
+		t.Errorf("columns = %v, want %v", columns, want)
+	}
+
+	c, db := newTestConnection(t, "mysql")
+	db.InsertID("INSERT INTO", 1)
+	db.Returns("FROM hooks", []string{"id", "url", "retries"}, []driver.Value{int64(1), "https://example.com", int64(3)})
+	ctx := context.Background()
+
+	fired := false
+	if err := c.Create(ctx, &testHook{URL: "https://example.com", OnFire: func() { fired = true }, Events: make(chan string)}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// SELECT * returns only the stored columns, which fill their fields
+	// without disturbing the others
+	hook := testHook{OnFire: func() { fired = true }}
+	if err := c.Find(ctx, &hook, 1); err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if hook.ID != 1 || hook.URL != "https://example.com" || hook.Retries != 3 || hook.OnFire == nil {
+		t.Errorf("Find = %+v, want hook 1 keeping its callback", hook)
+	}
+	var first testHook
+	if err := c.First(ctx, &first, "url = ?", "https://example.com"); err != nil {
+		t.Fatalf("First: %v", err)
+	}
+	if first.ID != 1 || first.Retries != 3 {
+		t.Errorf("First = %+v, want hook 1", first)
+	}
+	if fired {
+		t.Error("a callback was called")
+	}
+
+	assertQueries(t, db,
+		"INSERT INTO hooks (url, retries) VALUES (?, ?)",
+		"SELECT * FROM hooks WHERE id = ?",
+		"SELECT * FROM hooks WHERE url = ? LIMIT 1",
+	)
+}
+
+// testAuthor has untagged relationship and map fields next to a tagged map
+type testAuthor struct {
+	ID       int64             `db:"id,pk,auto"`
+	Name     string            `db:"name"`
+	Meta     map[string]string `db:"meta"`
+	Avatar   []byte
+	Settings map[string]string
+	Profile  *testProfile
+	Posts    []*testPost
+}
+
+func (testAuthor) TableName() string  { return "authors" }
+func (testAuthor) PrimaryKey() string { return "id" }
+
+func TestModelColumnsMatchSchema(t *testing.T) {
+	info, err := extractModelInfo(&testAuthor{})
+	if err != nil {
+		t.Fatalf("extractModelInfo: %v", err)
+	}
+	var columns []string
+	for _, field := range info.Fields {
+		columns = append(columns, field.DBName)
+	}
+
+	table, err := schema.BuildFromStruct(testAuthor{}, "authors")
+	if err != nil {
+		t.Fatalf("BuildFromStruct: %v", err)
+	}
+	var ddl []string
+	for _, column := range table.Columns {
+		ddl = append(ddl, column.Name)
+	}
+
+	if want := []string{"id", "name", "meta", "avatar"}; !reflect.DeepEqual(columns, want) || !reflect.DeepEqual(ddl, want) {
+		t.Errorf("model columns %v and table columns %v, want %v", columns, ddl, want)
+	}
+}
+
+// tenantKey is the context key of the tenant in TablePrefix tests
+type tenantKey struct{}
+
+func TestTablePrefixFromContext(t *testing.T) {
+	c, db := openTestConnection(t, ConnectionOptions{Driver: "postgres", TablePrefix: func(ctx context.Context) string {
+		if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+			return tenant + "_"
+		}
+		return ""
+	}})
+
+	for _, tenant := range []string{"tenantA", "tenantB"} {
+		ctx := context.WithValue(context.Background(), tenantKey{}, tenant)
+		if err := c.Create(ctx, &testUser{Name: "Ann"}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		var users []testUser
+		if err := c.All(ctx, &users, "name = ?", "Ann"); err != nil {
+			t.Fatalf("All: %v", err)
+		}
+	}
+	// Without a tenant the model's own table is used
+	if err := c.Delete(context.Background(), &testUser{ID: 1}); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	assertQueries(t, db,
+		"INSERT INTO tenantA_users (name, email) VALUES ($1, $2)",
+		"SELECT * FROM tenantA_users WHERE name = $1",
+		"INSERT INTO tenantB_users (name, email) VALUES ($1, $2)",
+		"SELECT * FROM tenantB_users WHERE name = $1",
+		"DELETE FROM users WHERE id = $1",
+	)
+
+	// Schema checks look at the tenant's table
+	db.Reset()
+	db.Returns("'tenantA_users'", []string{"exists"}, []driver.Value{true})
+	db.Returns(`SELECT * FROM "tenantA_users" WHERE 1 = 0`, []string{"id", "name", "email"})
+	drift, err := c.CheckSchema(context.WithValue(context.Background(), tenantKey{}, "tenantA"), &testUser{})
+	if err != nil {
+		t.Fatalf("CheckSchema: %v", err)
+	}
+	if drift.HasDrift() {
+		t.Errorf("CheckSchema of the tenant's table reports %s", drift)
+	}
+}
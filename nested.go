@@ -2,8 +2,12 @@ package sage
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"math/big"
 	"reflect"
+	"sort"
 	"strings"
 )
 
@@ -46,21 +50,20 @@ func (c *Connection) nestedCreateHasOne(ctx context.Context, source interface{},
 	}
 
 	// Get the primary key value from the source
-	sourceInfo, err := extractModelInfo(source)
+	sourceInfo, err := c.modelInfo(ctx, source)
 	if err != nil {
 		return err
 	}
 
-	pkField := sourceValue.FieldByName(toFieldName(sourceInfo.PrimaryKey))
-	if !pkField.IsValid() {
-		return fmt.Errorf("primary key field %s not found in source model", sourceInfo.PrimaryKey)
+	pkField, err := primaryKeyField(sourceValue, sourceInfo)
+	if err != nil {
+		return err
 	}
 
 	// Set the foreign key in the related model
 	relValue := fieldValue.Elem()
-	fkField := relValue.FieldByName(toFieldName(rel.ForeignKey))
-	if fkField.IsValid() && fkField.CanSet() {
-		fkField.Set(pkField)
+	if err := setColumnField(relValue, rel.ForeignKey, pkField); err != nil {
+		return err
 	}
 
 	// Create the related model
@@ -92,20 +95,19 @@ func (c *Connection) nestedCreateBelongsTo(ctx context.Context, source interface
 
 	// Get the primary key from the related model
 	relValue := fieldValue.Elem()
-	relInfo, err := extractModelInfo(fieldValue.Interface())
+	relInfo, err := c.modelInfo(ctx, fieldValue.Interface())
 	if err != nil {
 		return err
 	}
 
-	pkField := relValue.FieldByName(toFieldName(relInfo.PrimaryKey))
-	if !pkField.IsValid() {
-		return fmt.Errorf("primary key field %s not found in related model", relInfo.PrimaryKey)
+	pkField, err := primaryKeyField(relValue, relInfo)
+	if err != nil {
+		return err
 	}
 
 	// Set the foreign key in the source model
-	fkField := sourceValue.FieldByName(toFieldName(rel.ForeignKey))
-	if fkField.IsValid() && fkField.CanSet() {
-		fkField.Set(pkField)
+	if err := setColumnField(sourceValue, rel.ForeignKey, pkField); err != nil {
+		return err
 	}
 
 	// Update the source model to save the foreign key
@@ -131,14 +133,14 @@ func (c *Connection) nestedCreateHasMany(ctx context.Context, source interface{}
 	}
 
 	// Get the primary key value from the source
-	sourceInfo, err := extractModelInfo(source)
+	sourceInfo, err := c.modelInfo(ctx, source)
 	if err != nil {
 		return err
 	}
 
-	pkField := sourceValue.FieldByName(toFieldName(sourceInfo.PrimaryKey))
-	if !pkField.IsValid() {
-		return fmt.Errorf("primary key field %s not found in source model", sourceInfo.PrimaryKey)
+	pkField, err := primaryKeyField(sourceValue, sourceInfo)
+	if err != nil {
+		return err
 	}
 
 	// Create each related model
@@ -152,9 +154,8 @@ func (c *Connection) nestedCreateHasMany(ctx context.Context, source interface{}
 
 		// Set the foreign key in the related model
 		relValue := relModel.Elem()
-		fkField := relValue.FieldByName(toFieldName(rel.ForeignKey))
-		if fkField.IsValid() && fkField.CanSet() {
-			fkField.Set(pkField)
+		if err := setColumnField(relValue, rel.ForeignKey, pkField); err != nil {
+			return err
 		}
 
 		// Create the related model
@@ -185,14 +186,13 @@ func (c *Connection) nestedCreateManyToMany(ctx context.Context, source interfac
 	}
 
 	// Get the primary key value from the source
-	sourceInfo, err := extractModelInfo(source)
+	sourceInfo, err := c.modelInfo(ctx, source)
 	if err != nil {
 		return err
 	}
 
-	pkField := sourceValue.FieldByName(toFieldName(sourceInfo.PrimaryKey))
-	if !pkField.IsValid() {
-		return fmt.Errorf("primary key field %s not found in source model", sourceInfo.PrimaryKey)
+	if _, err := primaryKeyField(sourceValue, sourceInfo); err != nil {
+		return err
 	}
 
 	// Create each related model first
@@ -206,14 +206,14 @@ func (c *Connection) nestedCreateManyToMany(ctx context.Context, source interfac
 
 		// Check if the model already exists
 		relValue := relModel.Elem()
-		relInfo, err := extractModelInfo(relModel.Interface())
+		relInfo, err := c.modelInfo(ctx, relModel.Interface())
 		if err != nil {
 			return err
 		}
 
-		pkRelField := relValue.FieldByName(toFieldName(relInfo.PrimaryKey))
-		if !pkRelField.IsValid() {
-			return fmt.Errorf("primary key field %s not found in related model", relInfo.PrimaryKey)
+		pkRelField, err := primaryKeyField(relValue, relInfo)
+		if err != nil {
+			return err
 		}
 
 		// If the model doesn't have a primary key, create it
@@ -256,32 +256,31 @@ func (c *Connection) nestedUpdateHasOne(ctx context.Context, source interface{},
 	}
 
 	// Get the primary key value from the source
-	sourceInfo, err := extractModelInfo(source)
+	sourceInfo, err := c.modelInfo(ctx, source)
 	if err != nil {
 		return err
 	}
 
-	pkField := sourceValue.FieldByName(toFieldName(sourceInfo.PrimaryKey))
-	if !pkField.IsValid() {
-		return fmt.Errorf("primary key field %s not found in source model", sourceInfo.PrimaryKey)
+	pkField, err := primaryKeyField(sourceValue, sourceInfo)
+	if err != nil {
+		return err
 	}
 
 	// Set the foreign key in the related model
 	relValue := fieldValue.Elem()
-	fkField := relValue.FieldByName(toFieldName(rel.ForeignKey))
-	if fkField.IsValid() && fkField.CanSet() {
-		fkField.Set(pkField)
+	if err := setColumnField(relValue, rel.ForeignKey, pkField); err != nil {
+		return err
 	}
 
 	// Get the related model's primary key
-	relInfo, err := extractModelInfo(fieldValue.Interface())
+	relInfo, err := c.modelInfo(ctx, fieldValue.Interface())
 	if err != nil {
 		return err
 	}
 
-	pkRelField := relValue.FieldByName(toFieldName(relInfo.PrimaryKey))
-	if !pkRelField.IsValid() {
-		return fmt.Errorf("primary key field %s not found in related model", relInfo.PrimaryKey)
+	pkRelField, err := primaryKeyField(relValue, relInfo)
+	if err != nil {
+		return err
 	}
 
 	// If the model doesn't have a primary key, create it
@@ -313,14 +312,14 @@ func (c *Connection) nestedUpdateBelongsTo(ctx context.Context, source interface
 
 	// Get the related model's primary key
 	relValue := fieldValue.Elem()
-	relInfo, err := extractModelInfo(fieldValue.Interface())
+	relInfo, err := c.modelInfo(ctx, fieldValue.Interface())
 	if err != nil {
 		return err
 	}
 
-	pkRelField := relValue.FieldByName(toFieldName(relInfo.PrimaryKey))
-	if !pkRelField.IsValid() {
-		return fmt.Errorf("primary key field %s not found in related model", relInfo.PrimaryKey)
+	pkRelField, err := primaryKeyField(relValue, relInfo)
+	if err != nil {
+		return err
 	}
 
 	// If the model doesn't have a primary key, create it
@@ -336,9 +335,8 @@ func (c *Connection) nestedUpdateBelongsTo(ctx context.Context, source interface
 	}
 
 	// Set the foreign key in the source model
-	fkField := sourceValue.FieldByName(toFieldName(rel.ForeignKey))
-	if fkField.IsValid() && fkField.CanSet() {
-		fkField.Set(pkRelField)
+	if err := setColumnField(sourceValue, rel.ForeignKey, pkRelField); err != nil {
+		return err
 	}
 
 	return nil
@@ -363,14 +361,14 @@ func (c *Connection) nestedUpdateHasMany(ctx context.Context, source interface{}
 	}
 
 	// Get the primary key value from the source
-	sourceInfo, err := extractModelInfo(source)
+	sourceInfo, err := c.modelInfo(ctx, source)
 	if err != nil {
 		return err
 	}
 
-	pkField := sourceValue.FieldByName(toFieldName(sourceInfo.PrimaryKey))
-	if !pkField.IsValid() {
-		return fmt.Errorf("primary key field %s not found in source model", sourceInfo.PrimaryKey)
+	pkField, err := primaryKeyField(sourceValue, sourceInfo)
+	if err != nil {
+		return err
 	}
 
 	// Update each related model
@@ -384,20 +382,19 @@ func (c *Connection) nestedUpdateHasMany(ctx context.Context, source interface{}
 
 		// Set the foreign key in the related model
 		relValue := relModel.Elem()
-		fkField := relValue.FieldByName(toFieldName(rel.ForeignKey))
-		if fkField.IsValid() && fkField.CanSet() {
-			fkField.Set(pkField)
+		if err := setColumnField(relValue, rel.ForeignKey, pkField); err != nil {
+			return err
 		}
 
 		// Get the related model's primary key
-		relInfo, err := extractModelInfo(relModel.Interface())
+		relInfo, err := c.modelInfo(ctx, relModel.Interface())
 		if err != nil {
 			return err
 		}
 
-		pkRelField := relValue.FieldByName(toFieldName(relInfo.PrimaryKey))
-		if !pkRelField.IsValid() {
-			return fmt.Errorf("primary key field %s not found in related model", relInfo.PrimaryKey)
+		pkRelField, err := primaryKeyField(relValue, relInfo)
+		if err != nil {
+			return err
 		}
 
 		// If the model doesn't have a primary key, create it
@@ -430,14 +427,14 @@ func (c *Connection) nestedUpdateManyToMany(ctx context.Context, source interfac
 	}
 
 	// Get the primary key value from the source
-	sourceInfo, err := extractModelInfo(source)
+	sourceInfo, err := c.modelInfo(ctx, source)
 	if err != nil {
 		return err
 	}
 
-	pkField := sourceValue.FieldByName(toFieldName(sourceInfo.PrimaryKey))
-	if !pkField.IsValid() {
-		return fmt.Errorf("primary key field %s not found in source model", sourceInfo.PrimaryKey)
+	pkField, err := primaryKeyField(sourceValue, sourceInfo)
+	if err != nil {
+		return err
 	}
 
 	// If the field is nil or empty, clear all associations
@@ -445,23 +442,23 @@ func (c *Connection) nestedUpdateManyToMany(ctx context.Context, source interfac
 		// Delete all associations in the join table
 		query := fmt.Sprintf(
 			"DELETE FROM %s WHERE %s = ?",
-			rel.JoinTable,
-			rel.JoinForeignKey,
+			c.dialect.Quote(rel.JoinTable),
+			c.dialect.Quote(rel.JoinForeignKey),
 		)
 
-		_, err := c.DB().ExecContext(ctx, query, pkField.Interface())
+		_, err := c.exec(ctx, query, pkField.Interface())
 		return err
 	}
 
 	// Get current associations
 	query := fmt.Sprintf(
 		"SELECT %s FROM %s WHERE %s = ?",
-		rel.JoinRefKey,
-		rel.JoinTable,
-		rel.JoinForeignKey,
+		c.dialect.Quote(rel.JoinRefKey),
+		c.dialect.Quote(rel.JoinTable),
+		c.dialect.Quote(rel.JoinForeignKey),
 	)
 
-	rows, err := c.DB().QueryContext(ctx, query, pkField.Interface())
+	rows, err := c.query(ctx, query, pkField.Interface())
 	if err != nil {
 		return err
 	}
@@ -478,6 +475,7 @@ func (c *Connection) nestedUpdateManyToMany(ctx context.Context, source interfac
 
 	// Process each related model
 	newIDs := make(map[interface{}]bool)
+	pending := make(map[interface{}]interface{})
 	for i := 0; i < fieldValue.Len(); i++ {
 		relModel := fieldValue.Index(i)
 
@@ -488,14 +486,14 @@ func (c *Connection) nestedUpdateManyToMany(ctx context.Context, source interfac
 
 		// Check if the model already exists
 		relValue := relModel.Elem()
-		relInfo, err := extractModelInfo(relModel.Interface())
+		relInfo, err := c.modelInfo(ctx, relModel.Interface())
 		if err != nil {
 			return err
 		}
 
-		pkRelField := relValue.FieldByName(toFieldName(relInfo.PrimaryKey))
-		if !pkRelField.IsValid() {
-			return fmt.Errorf("primary key field %s not found in related model", relInfo.PrimaryKey)
+		pkRelField, err := primaryKeyField(relValue, relInfo)
+		if err != nil {
+			return err
 		}
 
 		// If the model doesn't have a primary key, create it
@@ -514,36 +512,140 @@ func (c *Connection) nestedUpdateManyToMany(ctx context.Context, source interfac
 		relID := pkRelField.Interface()
 		newIDs[relID] = true
 
-		// If not already associated, create the association
+		// If not already associated, queue the association
 		if !currentIDs[relID] {
-			if err := c.Associate(ctx, source, field, relModel.Interface(), rel); err != nil {
-				return err
-			}
+			pending[relID] = relModel.Interface()
 		}
 	}
 
-	// Remove associations that are no longer present
+	// Remove associations that are no longer present, in id order so that
+	// concurrent transactions acquire row locks in the same order
 	if opts.AutoDelete {
+		var staleIDs []interface{}
 		for id := range currentIDs {
 			if !newIDs[id] {
-				query := fmt.Sprintf(
-					"DELETE FROM %s WHERE %s = ? AND %s = ?",
-					rel.JoinTable,
-					rel.JoinForeignKey,
-					rel.JoinRefKey,
-				)
-
-				_, err := c.DB().ExecContext(ctx, query, pkField.Interface(), id)
-				if err != nil {
-					return err
-				}
+				staleIDs = append(staleIDs, id)
+			}
+		}
+		sortIDs(staleIDs)
+
+		query := fmt.Sprintf(
+			"DELETE FROM %s WHERE %s = ? AND %s = ?",
+			c.dialect.Quote(rel.JoinTable),
+			c.dialect.Quote(rel.JoinForeignKey),
+			c.dialect.Quote(rel.JoinRefKey),
+		)
+
+		for _, id := range staleIDs {
+			_, err := c.exec(ctx, query, pkField.Interface(), id)
+			if err != nil {
+				return err
 			}
 		}
 	}
 
+	// Create the new associations in id order
+	pendingIDs := make([]interface{}, 0, len(pending))
+	for id := range pending {
+		pendingIDs = append(pendingIDs, id)
+	}
+	sortIDs(pendingIDs)
+
+	for _, id := range pendingIDs {
+		if err := c.Associate(ctx, source, field, pending[id], rel); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// sortIDs sorts primary key values in ascending order
+func sortIDs(ids []interface{}) {
+	sort.SliceStable(ids, func(i, j int) bool {
+		return compareIDs(ids[i], ids[j]) < 0
+	})
+}
+
+// compareIDs compares two primary key values, falling back to their string form
+// when the values are not both numeric
+func compareIDs(a, b interface{}) int {
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+	if isIntegerKind(av) && isIntegerKind(bv) {
+		ai, bi := toBigInt(av), toBigInt(bv)
+		return ai.Cmp(bi)
+	}
+
+	if isNumberKind(av) && isNumberKind(bv) {
+		af, bf := toFloat(av), toFloat(bv)
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+		return 0
+	}
+
+	return strings.Compare(idString(a), idString(b))
+}
+
+// isIntegerKind checks if a value holds a signed or unsigned integer
+func isIntegerKind(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// isNumberKind checks if a value holds an integer or floating point number
+func isNumberKind(v reflect.Value) bool {
+	return isIntegerKind(v) || v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64
+}
+
+// toBigInt converts an integer value to a big.Int
+func toBigInt(v reflect.Value) *big.Int {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Int).SetUint64(v.Uint())
+	}
+	return big.NewInt(v.Int())
+}
+
+// toFloat converts a numeric value to a float64
+func toFloat(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	}
+	return float64(v.Int())
+}
+
+// idString returns the string form of a primary key value. Pointers are
+// dereferenced, so that a *int64 foreign key matches an int64 primary key, and
+// a nil pointer has the empty string form.
+func idString(id interface{}) string {
+	v := reflect.ValueOf(id)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return ""
+	}
+
+	if b, ok := v.Interface().([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
 // nestedDeleteHasOne deletes a HasOne related model
 func (c *Connection) nestedDeleteHasOne(ctx context.Context, source interface{}, field string, rel *Relationship, opts NestedOption) error {
 	if !opts.AutoDelete {
@@ -556,14 +658,14 @@ func (c *Connection) nestedDeleteHasOne(ctx context.Context, source interface{},
 	}
 
 	// Get the primary key value from the source
-	sourceInfo, err := extractModelInfo(source)
+	sourceInfo, err := c.modelInfo(ctx, source)
 	if err != nil {
 		return err
 	}
 
-	pkField := sourceValue.FieldByName(toFieldName(sourceInfo.PrimaryKey))
-	if !pkField.IsValid() {
-		return fmt.Errorf("primary key field %s not found in source model", sourceInfo.PrimaryKey)
+	pkField, err := primaryKeyField(sourceValue, sourceInfo)
+	if err != nil {
+		return err
 	}
 
 	// Find the related model
@@ -574,32 +676,33 @@ func (c *Connection) nestedDeleteHasOne(ctx context.Context, source interface{},
 	relModel := reflect.New(relType).Interface()
 
 	// Build the query to find the related model
-	relInfo, err := extractModelInfo(relModel)
+	relInfo, err := c.modelInfo(ctx, relModel)
 	if err != nil {
 		return err
 	}
+	defer c.invalidateTable(ctx, relInfo.TableName)
 
 	if opts.NullifyOnDelete {
 		// Update the foreign key to NULL
 		query := fmt.Sprintf(
 			"UPDATE %s SET %s = NULL WHERE %s = ?",
-			relInfo.TableName,
-			rel.ForeignKey,
-			rel.ForeignKey,
+			c.dialect.Quote(relInfo.TableName),
+			c.dialect.Quote(rel.ForeignKey),
+			c.dialect.Quote(rel.ForeignKey),
 		)
 
-		_, err := c.DB().ExecContext(ctx, query, pkField.Interface())
+		_, err := c.exec(ctx, query, pkField.Interface())
 		return err
 	}
 
 	// Delete the related model
 	query := fmt.Sprintf(
 		"DELETE FROM %s WHERE %s = ?",
-		relInfo.TableName,
-		rel.ForeignKey,
+		c.dialect.Quote(relInfo.TableName),
+		c.dialect.Quote(rel.ForeignKey),
 	)
 
-	_, err = c.DB().ExecContext(ctx, query, pkField.Interface())
+	_, err = c.exec(ctx, query, pkField.Interface())
 	return err
 }
 
@@ -615,14 +718,14 @@ func (c *Connection) nestedDeleteHasMany(ctx context.Context, source interface{}
 	}
 
 	// Get the primary key value from the source
-	sourceInfo, err := extractModelInfo(source)
+	sourceInfo, err := c.modelInfo(ctx, source)
 	if err != nil {
 		return err
 	}
 
-	pkField := sourceValue.FieldByName(toFieldName(sourceInfo.PrimaryKey))
-	if !pkField.IsValid() {
-		return fmt.Errorf("primary key field %s not found in source model", sourceInfo.PrimaryKey)
+	pkField, err := primaryKeyField(sourceValue, sourceInfo)
+	if err != nil {
+		return err
 	}
 
 	// Find the related model type
@@ -633,32 +736,33 @@ func (c *Connection) nestedDeleteHasMany(ctx context.Context, source interface{}
 	relModel := reflect.New(relType).Interface()
 
 	// Build the query to find the related models
-	relInfo, err := extractModelInfo(relModel)
+	relInfo, err := c.modelInfo(ctx, relModel)
 	if err != nil {
 		return err
 	}
+	defer c.invalidateTable(ctx, relInfo.TableName)
 
 	if opts.NullifyOnDelete {
 		// Update the foreign keys to NULL
 		query := fmt.Sprintf(
 			"UPDATE %s SET %s = NULL WHERE %s = ?",
-			relInfo.TableName,
-			rel.ForeignKey,
-			rel.ForeignKey,
+			c.dialect.Quote(relInfo.TableName),
+			c.dialect.Quote(rel.ForeignKey),
+			c.dialect.Quote(rel.ForeignKey),
 		)
 
-		_, err := c.DB().ExecContext(ctx, query, pkField.Interface())
+		_, err := c.exec(ctx, query, pkField.Interface())
 		return err
 	}
 
 	// Delete the related models
 	query := fmt.Sprintf(
 		"DELETE FROM %s WHERE %s = ?",
-		relInfo.TableName,
-		rel.ForeignKey,
+		c.dialect.Quote(relInfo.TableName),
+		c.dialect.Quote(rel.ForeignKey),
 	)
 
-	_, err = c.DB().ExecContext(ctx, query, pkField.Interface())
+	_, err = c.exec(ctx, query, pkField.Interface())
 	return err
 }
 
@@ -670,24 +774,24 @@ func (c *Connection) nestedDeleteManyToMany(ctx context.Context, source interfac
 	}
 
 	// Get the primary key value from the source
-	sourceInfo, err := extractModelInfo(source)
+	sourceInfo, err := c.modelInfo(ctx, source)
 	if err != nil {
 		return err
 	}
 
-	pkField := sourceValue.FieldByName(toFieldName(sourceInfo.PrimaryKey))
-	if !pkField.IsValid() {
-		return fmt.Errorf("primary key field %s not found in source model", sourceInfo.PrimaryKey)
+	pkField, err := primaryKeyField(sourceValue, sourceInfo)
+	if err != nil {
+		return err
 	}
 
 	// Delete the associations in the join table
 	query := fmt.Sprintf(
 		"DELETE FROM %s WHERE %s = ?",
-		rel.JoinTable,
-		rel.JoinForeignKey,
+		c.dialect.Quote(rel.JoinTable),
+		c.dialect.Quote(rel.JoinForeignKey),
 	)
 
-	_, err = c.DB().ExecContext(ctx, query, pkField.Interface())
+	_, err = c.exec(ctx, query, pkField.Interface())
 	if err != nil {
 		return err
 	}
@@ -697,12 +801,12 @@ func (c *Connection) nestedDeleteManyToMany(ctx context.Context, source interfac
 		// Get the IDs of the related models
 		query := fmt.Sprintf(
 			"SELECT %s FROM %s WHERE %s = ?",
-			rel.JoinRefKey,
-			rel.JoinTable,
-			rel.JoinForeignKey,
+			c.dialect.Quote(rel.JoinRefKey),
+			c.dialect.Quote(rel.JoinTable),
+			c.dialect.Quote(rel.JoinForeignKey),
 		)
 
-		rows, err := c.DB().QueryContext(ctx, query, pkField.Interface())
+		rows, err := c.query(ctx, query, pkField.Interface())
 		if err != nil {
 			return err
 		}
@@ -725,10 +829,11 @@ func (c *Connection) nestedDeleteManyToMany(ctx context.Context, source interfac
 			relModel := reflect.New(relType).Interface()
 
 			// Build the query to delete the related models
-			relInfo, err := extractModelInfo(relModel)
+			relInfo, err := c.modelInfo(ctx, relModel)
 			if err != nil {
 				return err
 			}
+			defer c.invalidateTable(ctx, relInfo.TableName)
 
 			// Build a placeholders string for the IN clause
 			placeholders := make([]string, len(ids))
@@ -738,8 +843,8 @@ func (c *Connection) nestedDeleteManyToMany(ctx context.Context, source interfac
 
 			query := fmt.Sprintf(
 				"DELETE FROM %s WHERE %s IN (%s)",
-				relInfo.TableName,
-				relInfo.PrimaryKey,
+				c.dialect.Quote(relInfo.TableName),
+				c.dialect.Quote(relInfo.PrimaryKey),
 				strings.Join(placeholders, ", "),
 			)
 
@@ -749,7 +854,7 @@ func (c *Connection) nestedDeleteManyToMany(ctx context.Context, source interfac
 				args[i] = id
 			}
 
-			_, err = c.DB().ExecContext(ctx, query, args...)
+			_, err = c.exec(ctx, query, args...)
 			if err != nil {
 				return err
 			}
@@ -835,10 +940,22 @@ func (c *Connection) UpdateNested(ctx context.Context, model interface{}, relati
 	return nil
 }
 
-// DeleteNested deletes a model and its nested relationships
+// DeleteNested deletes a model and its nested relationships. The OnDelete
+// action of a relationship takes precedence over opts.
 func (c *Connection) DeleteNested(ctx context.Context, model interface{}, relationships map[string]*Relationship, opts NestedOption) error {
+	// Check restricted relationships before deleting anything
+	for field, rel := range relationships {
+		if rel.OnDelete != OnDeleteRestrict || rel.Type == BelongsTo {
+			continue
+		}
+		if err := c.checkRestrict(ctx, model, field, rel); err != nil {
+			return err
+		}
+	}
+
 	// Process each relationship first
 	for field, rel := range relationships {
+		opts := rel.deleteOption(opts)
 		switch rel.Type {
 		case HasOne:
 			if err := c.nestedDeleteHasOne(ctx, model, field, rel, opts); err != nil {
@@ -859,6 +976,64 @@ func (c *Connection) DeleteNested(ctx context.Context, model interface{}, relati
 	return c.Delete(ctx, model)
 }
 
+// deleteOption returns the options of a nested delete with the relationship's
+// OnDelete action applied
+func (rel *Relationship) deleteOption(opts NestedOption) NestedOption {
+	switch rel.OnDelete {
+	case OnDeleteCascade:
+		opts.AutoDelete, opts.NullifyOnDelete = true, false
+	case OnDeleteSetNull:
+		opts.AutoDelete, opts.NullifyOnDelete = rel.Type != ManyToMany, true
+	case OnDeleteRestrict, OnDeleteNoAction:
+		opts.AutoDelete = false
+	}
+	return opts
+}
+
+// checkRestrict returns ErrInvalidOperation if the model has related models
+// through the relationship
+func (c *Connection) checkRestrict(ctx context.Context, model interface{}, field string, rel *Relationship) error {
+	sourceValue := reflect.ValueOf(model)
+	if sourceValue.Kind() == reflect.Ptr {
+		sourceValue = sourceValue.Elem()
+	}
+
+	sourceInfo, err := c.modelInfo(ctx, model)
+	if err != nil {
+		return err
+	}
+
+	pkField, err := primaryKeyField(sourceValue, sourceInfo)
+	if err != nil {
+		return err
+	}
+
+	table, column := rel.JoinTable, rel.JoinForeignKey
+	if rel.Type != ManyToMany {
+		relInfo, err := c.modelInfo(ctx, rel.Model)
+		if err != nil {
+			return err
+		}
+		table, column = relInfo.TableName, rel.ForeignKey
+	}
+
+	query := fmt.Sprintf(
+		"SELECT 1 FROM %s WHERE %s = ? LIMIT 1",
+		c.dialect.Quote(table),
+		c.dialect.Quote(column),
+	)
+
+	var found int
+	err = c.queryRow(ctx, query, pkField.Interface()).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: cannot delete %s with related %s", ErrInvalidOperation, sourceInfo.TableName, field)
+}
+
 // FindNested finds a model and preloads its relationships
 func (c *Connection) FindNested(ctx context.Context, model interface{}, id interface{}, relationships map[string]*Relationship) error {
 	// First find the model
@@ -871,7 +1046,7 @@ func (c *Connection) FindNested(ctx context.Context, model interface{}, id inter
 }
 
 // FirstNested finds the first model matching conditions and preloads its relationships
-func (c *Connection) FirstNested(ctx context.Context, model interface{}, relationships map[string]*Relationship, conditions string, args ...interface{}) error {
+func (c *Connection) FirstNested(ctx context.Context, model interface{}, relationships map[string]*Relationship, conditions interface{}, args ...interface{}) error {
 	// First find the model
 	if err := c.First(ctx, model, conditions, args...); err != nil {
 		return err
@@ -882,7 +1057,7 @@ func (c *Connection) FirstNested(ctx context.Context, model interface{}, relatio
 }
 
 // AllNested finds all models matching conditions and preloads their relationships
-func (c *Connection) AllNested(ctx context.Context, models interface{}, relationships map[string]*Relationship, conditions string, args ...interface{}) error {
+func (c *Connection) AllNested(ctx context.Context, models interface{}, relationships map[string]*Relationship, conditions interface{}, args ...interface{}) error {
 	// First find the models
 	if err := c.All(ctx, models, conditions, args...); err != nil {
 		return err
@@ -0,0 +1,252 @@
+package sage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testTag is the related model of ManyToMany tests
+type testTag struct {
+	ID   int64  `db:"id,pk,auto"`
+	Name string `db:"name"`
+}
+
+func (testTag) TableName() string  { return "tags" }
+func (testTag) PrimaryKey() string { return "id" }
+
+// testPost has tags through the post_tags join table
+type testPost struct {
+	ID    int64      `db:"id,pk,auto"`
+	Title string     `db:"title"`
+	Tags  []*testTag `db:"-"`
+}
+
+func (testPost) TableName() string  { return "posts" }
+func (testPost) PrimaryKey() string { return "id" }
+
+// postTags is the ManyToMany relationship of posts and tags
+var postTags = &Relationship{
+	Type:           ManyToMany,
+	Model:          &testTag{},
+	JoinTable:      "post_tags",
+	JoinForeignKey: "post_id",
+	JoinRefKey:     "tag_id",
+}
+
+func TestUpdateNestedManyToManySortsIDs(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	db.Returns(`SELECT "tag_id" FROM "post_tags"`, []string{"tag_id"},
+		[]driver.Value{int64(9)}, []driver.Value{int64(1)}, []driver.Value{int64(5)}, []driver.Value{int64(3)})
+
+	post := &testPost{ID: 1, Title: "Hello", Tags: []*testTag{
+		{ID: 8, Name: "h"}, {ID: 1, Name: "a"}, {ID: 4, Name: "d"}, {ID: 2, Name: "b"},
+	}}
+	opts := NestedOption{AutoSave: true, AutoDelete: true}
+	if err := c.UpdateNested(context.Background(), post, map[string]*Relationship{"Tags": postTags}, opts); err != nil {
+		t.Fatalf("UpdateNested: %v", err)
+	}
+
+	var deleted, inserted []driver.Value
+	for _, statement := range db.Statements() {
+		switch {
+		case strings.HasPrefix(statement.Query, `DELETE FROM "post_tags"`):
+			deleted = append(deleted, statement.Args[1])
+		case strings.HasPrefix(statement.Query, `INSERT INTO "post_tags"`):
+			inserted = append(inserted, statement.Args[1])
+		}
+	}
+
+	if want := []driver.Value{int64(3), int64(5), int64(9)}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("deleted tag ids %v, want %v", deleted, want)
+	}
+	if want := []driver.Value{int64(2), int64(4), int64(8)}; !reflect.DeepEqual(inserted, want) {
+		t.Errorf("inserted tag ids %v, want %v", inserted, want)
+	}
+}
+
+// testLine belongs to an order through a reserved-word column
+type testLine struct {
+	ID    int64  `db:"id,pk,auto"`
+	Order int64  `db:"order"`
+	Item  string `db:"item"`
+}
+
+func (testLine) TableName() string  { return "lines" }
+func (testLine) PrimaryKey() string { return "id" }
+
+// testOrder has lines
+type testOrder struct {
+	ID    int64       `db:"id,pk,auto"`
+	Lines []*testLine `db:"-"`
+}
+
+func (testOrder) TableName() string  { return "orders" }
+func (testOrder) PrimaryKey() string { return "id" }
+
+func TestNestedQueriesQuoteReservedWords(t *testing.T) {
+	c, db := newTestConnection(t, "mysql")
+	ctx := context.Background()
+
+	lines := &Relationship{Type: HasMany, Model: &testLine{}, ForeignKey: "order", ReferenceKey: "id"}
+	order := &testOrder{ID: 7}
+
+	if err := c.DeleteNested(ctx, order, map[string]*Relationship{"Lines": lines}, NestedOption{AutoDelete: true, NullifyOnDelete: true}); err != nil {
+		t.Fatalf("DeleteNested: %v", err)
+	}
+
+	// A join table whose keys are reserved words
+	groups := &Relationship{Type: ManyToMany, Model: &testTag{}, JoinTable: "group", JoinForeignKey: "order", JoinRefKey: "select"}
+	if err := c.Associate(ctx, order, "Tags", &testTag{ID: 3}, groups); err != nil {
+		t.Fatalf("Associate: %v", err)
+	}
+	if err := c.Dissociate(ctx, order, "Tags", &testTag{ID: 3}, groups); err != nil {
+		t.Fatalf("Dissociate: %v", err)
+	}
+
+	assertQueries(t, db,
+		"UPDATE `lines` SET `order` = NULL WHERE `order` = ?",
+		"DELETE FROM orders WHERE id = ?",
+		"INSERT INTO `group` (`order`, `select`) VALUES (?, ?)",
+		"DELETE FROM `group` WHERE `order` = ? AND `select` = ?",
+	)
+}
+
+func TestNestedOperationsJoinTheTransaction(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	db.InsertID("INSERT INTO", 1)
+
+	// Keep another connection busy so the transaction cannot share it
+	busy, err := c.DB().Conn(context.Background())
+	if err != nil {
+		t.Fatalf("Conn: %v", err)
+	}
+	defer busy.Close()
+
+	lines := &Relationship{Type: HasMany, Model: &testLine{}, ForeignKey: "order", ReferenceKey: "id"}
+	failed := errors.New("failed")
+	err = c.WithTransactionContext(context.Background(), func(ctx context.Context) error {
+		order := &testOrder{Lines: []*testLine{{Item: "a"}, {Item: "b"}}}
+		if err := c.CreateNested(ctx, order, map[string]*Relationship{"Lines": lines}, NestedOption{AutoSave: true}); err != nil {
+			return err
+		}
+		if err := c.Preload(ctx, order, map[string]*Relationship{"Lines": lines}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("WithTransactionContext = %v, want %v", err, failed)
+	}
+
+	statements := db.Statements()
+	if len(statements) < 2 || statements[0].Query != "BEGIN" || statements[len(statements)-1].Query != "ROLLBACK" {
+		t.Fatalf("statements %v are not wrapped in BEGIN and ROLLBACK", statements)
+	}
+
+	var inserts int
+	for _, statement := range statements {
+		if statement.Conn != statements[0].Conn {
+			t.Errorf("%q ran outside the transaction", statement.Query)
+		}
+		if strings.HasPrefix(statement.Query, "INSERT INTO lines") {
+			inserts++
+		}
+	}
+	if inserts != 2 {
+		t.Errorf("got %d child inserts, want 2", inserts)
+	}
+}
+
+// testChapter references its book through a field named unlike its column
+type testChapter struct {
+	ID    int64  `db:"id,pk,auto"`
+	Owner int64  `db:"book_ref"`
+	Title string `db:"title"`
+}
+
+func (testChapter) TableName() string  { return "chapters" }
+func (testChapter) PrimaryKey() string { return "id" }
+
+// testBook has chapters
+type testBook struct {
+	Key      int64          `db:"book_key,pk,auto"`
+	Chapters []*testChapter `db:"-"`
+}
+
+func (testBook) TableName() string  { return "books" }
+func (testBook) PrimaryKey() string { return "book_key" }
+
+func TestNestedKeysWithCustomColumnNames(t *testing.T) {
+	c, db := newTestConnection(t, "mysql")
+	db.InsertID("books", 5)
+	ctx := context.Background()
+
+	chapters := &Relationship{Type: HasMany, Model: &testChapter{}, ForeignKey: "book_ref", ReferenceKey: "book_key"}
+	book := &testBook{Chapters: []*testChapter{{Title: "One"}, {Title: "Two"}}}
+	if err := c.CreateNested(ctx, book, map[string]*Relationship{"Chapters": chapters}, NestedOption{AutoSave: true}); err != nil {
+		t.Fatalf("CreateNested: %v", err)
+	}
+
+	if book.Key != 5 {
+		t.Errorf("Key = %d, want 5", book.Key)
+	}
+	for _, chapter := range book.Chapters {
+		if chapter.Owner != 5 {
+			t.Errorf("chapter %q Owner = %d, want 5", chapter.Title, chapter.Owner)
+		}
+	}
+	for _, statement := range db.Statements()[1:] {
+		if statement.Args[0] != int64(5) {
+			t.Errorf("%q with %v does not reference book 5", statement.Query, statement.Args)
+		}
+	}
+
+	chapters.ForeignKey = "book_id"
+	err := c.CreateNested(ctx, &testBook{Chapters: []*testChapter{{Title: "One"}}}, map[string]*Relationship{"Chapters": chapters}, NestedOption{AutoSave: true})
+	if !errors.Is(err, ErrInvalidArgument) || !strings.Contains(err.Error(), "book_id") {
+		t.Errorf("CreateNested with an unknown foreign key = %v, want ErrInvalidArgument naming book_id", err)
+	}
+}
+
+func TestDeleteNestedPerRelationshipOnDelete(t *testing.T) {
+	c, db := newTestConnection(t, "mysql")
+	ctx := context.Background()
+
+	relationships := map[string]*Relationship{
+		"Comments": {Type: HasMany, Model: &testComment{}, ForeignKey: "thread_id", ReferenceKey: "id", OnDelete: OnDeleteCascade},
+		"Lines":    {Type: HasMany, Model: &testLine{}, ForeignKey: "order", ReferenceKey: "id", OnDelete: OnDeleteSetNull},
+	}
+	// The relationships override options that would leave both alone
+	if err := c.DeleteNested(ctx, &testThread{ID: 4}, relationships, NestedOption{}); err != nil {
+		t.Fatalf("DeleteNested: %v", err)
+	}
+
+	queries := db.Queries()
+	want := map[string]bool{
+		"DELETE FROM `comments` WHERE `thread_id` = ?":        true,
+		"UPDATE `lines` SET `order` = NULL WHERE `order` = ?": true,
+	}
+	if len(queries) != 3 || queries[2] != "DELETE FROM threads WHERE id = ?" {
+		t.Fatalf("queries = %q, want the related statements before the thread delete", queries)
+	}
+	for _, query := range queries[:2] {
+		if !want[query] {
+			t.Errorf("unexpected query %q", query)
+		}
+		delete(want, query)
+	}
+
+	// A restricted relationship with related rows stops the delete
+	db.Reset()
+	db.Returns("SELECT 1 FROM", []string{"1"}, []driver.Value{int64(1)})
+	relationships["Comments"].OnDelete = OnDeleteRestrict
+	err := c.DeleteNested(ctx, &testThread{ID: 4}, relationships, NestedOption{AutoDelete: true})
+	if !errors.Is(err, ErrInvalidOperation) {
+		t.Fatalf("DeleteNested = %v, want ErrInvalidOperation", err)
+	}
+	assertQueries(t, db, "SELECT 1 FROM `comments` WHERE `thread_id` = ? LIMIT 1")
+}
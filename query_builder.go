@@ -20,6 +20,7 @@ type QueryBuilder struct {
 	havingArgs   []interface{}
 	operation    string
 	values       map[string]interface{}
+	valueColumns []string
 }
 
 // NewQueryBuilder creates a new query builder for the given table
@@ -41,6 +42,36 @@ func NewQueryBuilder(table string) *QueryBuilder {
 	}
 }
 
+// Clone returns an independent copy of the query builder
+func (qb *QueryBuilder) Clone() *QueryBuilder {
+	clone := &QueryBuilder{
+		table:        qb.table,
+		columns:      append([]string{}, qb.columns...),
+		whereClause:  append([]string{}, qb.whereClause...),
+		whereArgs:    append([]interface{}{}, qb.whereArgs...),
+		orderBy:      append([]string{}, qb.orderBy...),
+		limit:        qb.limit,
+		offset:       qb.offset,
+		joins:        append([]string{}, qb.joins...),
+		groupBy:      append([]string{}, qb.groupBy...),
+		havingClause: append([]string{}, qb.havingClause...),
+		havingArgs:   append([]interface{}{}, qb.havingArgs...),
+		operation:    qb.operation,
+		values:       make(map[string]interface{}, len(qb.values)),
+		valueColumns: append([]string{}, qb.valueColumns...),
+	}
+	for column, value := range qb.values {
+		clone.values[column] = value
+	}
+	return clone
+}
+
+// Reset clears all clauses and values, keeping only the table
+func (qb *QueryBuilder) Reset() *QueryBuilder {
+	*qb = *NewQueryBuilder(qb.table)
+	return qb
+}
+
 // Select sets the columns to select
 func (qb *QueryBuilder) Select(columns ...string) *QueryBuilder {
 	qb.operation = "SELECT"
@@ -48,6 +79,20 @@ func (qb *QueryBuilder) Select(columns ...string) *QueryBuilder {
 	return qb
 }
 
+// SelectCoalesce adds COALESCE(column, fallback) to the selected columns,
+// aliased as alias unless it is empty. fallback is a SQL expression, e.g. 0
+// or 'unknown'. COALESCE is supported by every dialect, including MySQL.
+func (qb *QueryBuilder) SelectCoalesce(column, fallback, alias string) *QueryBuilder {
+	expr := fmt.Sprintf("COALESCE(%s, %s)", column, fallback)
+	if alias != "" {
+		expr += " AS " + alias
+	}
+
+	qb.operation = "SELECT"
+	qb.columns = append(qb.columns, expr)
+	return qb
+}
+
 // Insert prepares an insert operation
 func (qb *QueryBuilder) Insert() *QueryBuilder {
 	qb.operation = "INSERT"
@@ -110,8 +155,12 @@ func (qb *QueryBuilder) Having(condition string, args ...interface{}) *QueryBuil
 	return qb
 }
 
-// Set adds a column value for INSERT or UPDATE
+// Set adds a column value for INSERT or UPDATE. Columns are written in the
+// order they were first set, so the generated SQL is stable.
 func (qb *QueryBuilder) Set(column string, value interface{}) *QueryBuilder {
+	if _, ok := qb.values[column]; !ok {
+		qb.valueColumns = append(qb.valueColumns, column)
+	}
 	qb.values[column] = value
 	return qb
 }
@@ -141,7 +190,7 @@ func (qb *QueryBuilder) Build() (string, []interface{}) {
 		// Add where clause
 		if len(qb.whereClause) > 0 {
 			query.WriteString(" WHERE ")
-			query.WriteString(strings.Join(qb.whereClause, " AND "))
+			query.WriteString(joinConditions(qb.whereClause))
 			args = append(args, qb.whereArgs...)
 		}
 
@@ -181,7 +230,7 @@ func (qb *QueryBuilder) Build() (string, []interface{}) {
 		var columns []string
 		var placeholders []string
 
-		for column := range qb.values {
+		for _, column := range qb.valueColumns {
 			columns = append(columns, column)
 			placeholders = append(placeholders, "?")
 			args = append(args, qb.values[column])
@@ -199,9 +248,9 @@ func (qb *QueryBuilder) Build() (string, []interface{}) {
 		query.WriteString(" SET ")
 
 		var sets []string
-		for column, value := range qb.values {
+		for _, column := range qb.valueColumns {
 			sets = append(sets, fmt.Sprintf("%s = ?", column))
-			args = append(args, value)
+			args = append(args, qb.values[column])
 		}
 
 		query.WriteString(strings.Join(sets, ", "))
@@ -209,7 +258,7 @@ func (qb *QueryBuilder) Build() (string, []interface{}) {
 		// Add where clause
 		if len(qb.whereClause) > 0 {
 			query.WriteString(" WHERE ")
-			query.WriteString(strings.Join(qb.whereClause, " AND "))
+			query.WriteString(joinConditions(qb.whereClause))
 			args = append(args, qb.whereArgs...)
 		}
 
@@ -220,10 +269,100 @@ func (qb *QueryBuilder) Build() (string, []interface{}) {
 		// Add where clause
 		if len(qb.whereClause) > 0 {
 			query.WriteString(" WHERE ")
-			query.WriteString(strings.Join(qb.whereClause, " AND "))
+			query.WriteString(joinConditions(qb.whereClause))
 			args = append(args, qb.whereArgs...)
 		}
 	}
 
 	return query.String(), args
 }
+
+// joinConditions joins WHERE conditions with AND, parenthesizing each one when
+// there are several so that OR inside a condition cannot escape it
+func joinConditions(conditions []string) string {
+	if len(conditions) == 1 {
+		return conditions[0]
+	}
+
+	wrapped := make([]string, len(conditions))
+	for i, condition := range conditions {
+		wrapped[i] = "(" + condition + ")"
+	}
+	return strings.Join(wrapped, " AND ")
+}
+
+// EscapeLike escapes the LIKE wildcards in s so that it is matched literally
+func EscapeLike(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return replacer.Replace(s)
+}
+
+// Contains returns a condition matching rows where column contains value literally
+func (c *Connection) Contains(column, value string) (string, interface{}) {
+	return c.likeCondition(column), "%" + EscapeLike(value) + "%"
+}
+
+// StartsWith returns a condition matching rows where column starts with value literally
+func (c *Connection) StartsWith(column, value string) (string, interface{}) {
+	return c.likeCondition(column), EscapeLike(value) + "%"
+}
+
+// EndsWith returns a condition matching rows where column ends with value literally
+func (c *Connection) EndsWith(column, value string) (string, interface{}) {
+	return c.likeCondition(column), "%" + EscapeLike(value)
+}
+
+// ILike returns a condition matching rows where column matches the LIKE
+// pattern regardless of case, with ILIKE on PostgreSQL and LOWER() elsewhere
+func (c *Connection) ILike(column, pattern string) (string, interface{}) {
+	return c.dialect.ILikeCondition(column), pattern
+}
+
+// FullText returns a condition matching rows where column matches the
+// full-text search query: a text search on PostgreSQL, MATCH ... AGAINST over
+// a FULLTEXT index on MySQL and MATCH on an FTS5 table on SQLite
+func (c *Connection) FullText(column, query string) (string, interface{}) {
+	return c.dialect.FullTextCondition(column), query
+}
+
+// DistinctFrom returns a condition matching rows where column differs from
+// value, treating NULL as a value: NULL differs from 1 and not from NULL
+func (c *Connection) DistinctFrom(column string, value interface{}) (string, interface{}) {
+	return c.dialect.DistinctFromCondition(column, true), value
+}
+
+// NotDistinctFrom returns a condition matching rows where column equals
+// value, treating NULL as a value, so that a nil value matches NULL
+func (c *Connection) NotDistinctFrom(column string, value interface{}) (string, interface{}) {
+	return c.dialect.DistinctFromCondition(column, false), value
+}
+
+// likeCondition builds a LIKE condition using the dialect's ESCAPE clause
+func (c *Connection) likeCondition(column string) string {
+	return fmt.Sprintf("%s LIKE ? %s", column, c.dialect.LikeEscape())
+}
+
+// OrderByColumn returns an ORDER BY term for a sort column and direction taken
+// from user input. The column must be one of the model's columns and the
+// direction ASC or DESC (ASC when empty), otherwise ErrInvalidArgument is returned.
+func (c *Connection) OrderByColumn(model interface{}, column, direction string) (string, error) {
+	info, err := extractModelInfo(model)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := columnSet(info, []string{column}); err != nil {
+		return "", err
+	}
+
+	direction = strings.ToUpper(strings.TrimSpace(direction))
+	switch direction {
+	case "":
+		direction = "ASC"
+	case "ASC", "DESC":
+	default:
+		return "", fmt.Errorf("%w: invalid sort direction %q", ErrInvalidArgument, direction)
+	}
+
+	return c.dialect.Quote(column) + " " + direction, nil
+}
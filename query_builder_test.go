@@ -0,0 +1,282 @@
+package sage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// likeMatch reports whether s matches the LIKE pattern with backslash escapes
+func likeMatch(pattern, s string) bool {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case '\\':
+			i++
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case '%':
+			expr.WriteString(".*")
+		case '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String()).MatchString(s)
+}
+
+func TestEscapeLike(t *testing.T) {
+	if got, want := EscapeLike("50%_off"), `50\%\_off`; got != want {
+		t.Errorf("EscapeLike = %q, want %q", got, want)
+	}
+	if got, want := EscapeLike(`a\b`), `a\\b`; got != want {
+		t.Errorf("EscapeLike = %q, want %q", got, want)
+	}
+}
+
+func TestLikeHelpersMatchLiterally(t *testing.T) {
+	tests := []struct {
+		driver string
+		escape string
+	}{
+		{"postgres", `ESCAPE '\'`},
+		{"mysql", `ESCAPE '\\'`},
+		{"sqlite", `ESCAPE '\'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			c, db := newTestConnection(t, tt.driver)
+
+			helpers := []struct {
+				name    string
+				build   func(column, value string) (string, interface{})
+				pattern string
+				matches []string
+				misses  []string
+			}{
+				{"Contains", c.Contains, `%50\%\_off%`, []string{"50%_off", "save 50%_off now"}, []string{"50 off", "500xoff", "50%xoff"}},
+				{"StartsWith", c.StartsWith, `50\%\_off%`, []string{"50%_off", "50%_off now"}, []string{"save 50%_off", "500_off"}},
+				{"EndsWith", c.EndsWith, `%50\%\_off`, []string{"50%_off", "save 50%_off"}, []string{"50%_off now", "50%Xoff"}},
+			}
+
+			for _, h := range helpers {
+				condition, arg := h.build("name", "50%_off")
+				if want := "name LIKE ? " + tt.escape; condition != want {
+					t.Errorf("%s condition = %q, want %q", h.name, condition, want)
+				}
+				if arg != h.pattern {
+					t.Errorf("%s pattern = %q, want %q", h.name, arg, h.pattern)
+				}
+				for _, s := range h.matches {
+					if !likeMatch(h.pattern, s) {
+						t.Errorf("%s pattern %q does not match %q", h.name, h.pattern, s)
+					}
+				}
+				for _, s := range h.misses {
+					if likeMatch(h.pattern, s) {
+						t.Errorf("%s pattern %q matches %q", h.name, h.pattern, s)
+					}
+				}
+
+				db.Reset()
+				var users []testUser
+				if err := c.All(context.Background(), &users, condition, arg); err != nil {
+					t.Fatalf("All: %v", err)
+				}
+				statements := db.Statements()
+				if len(statements) != 1 {
+					t.Fatalf("got %d statements, want 1", len(statements))
+				}
+				if !strings.Contains(statements[0].Query, tt.escape) {
+					t.Errorf("query %q lacks %s", statements[0].Query, tt.escape)
+				}
+				if len(statements[0].Args) != 1 || statements[0].Args[0] != h.pattern {
+					t.Errorf("args = %v, want [%s]", statements[0].Args, h.pattern)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryBuilderCloneAndReset(t *testing.T) {
+	base := NewQueryBuilder("orders").Select("id", "total").Join("JOIN users u ON u.id = orders.user_id").Where("u.active = ?", true)
+	wantQuery, wantArgs := base.Build()
+
+	clone := base.Clone().Where("orders.total > ?", 10).OrderBy("total DESC").Limit(5).GroupBy("id")
+	cloneQuery, cloneArgs := clone.Build()
+	if cloneQuery == wantQuery || len(cloneArgs) != 2 {
+		t.Errorf("clone query %q with %v lacks its own conditions", cloneQuery, cloneArgs)
+	}
+
+	query, args := base.Build()
+	if query != wantQuery || !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("original changed to %q with %v, want %q with %v", query, args, wantQuery, wantArgs)
+	}
+
+	clone.Reset()
+	if query, args := clone.Select().Build(); query != "SELECT * FROM orders" || len(args) != 0 {
+		t.Errorf("reset builder builds %q with %v", query, args)
+	}
+	if query, _ := base.Build(); query != wantQuery {
+		t.Errorf("resetting the clone changed the original to %q", query)
+	}
+}
+
+func TestQueryBuilderColumnOrderIsStable(t *testing.T) {
+	build := func(update bool) string {
+		qb := NewQueryBuilder("users").Insert()
+		if update {
+			qb = NewQueryBuilder("users").Update().Where("id = ?", 1)
+		}
+		for _, column := range []string{"name", "email", "age", "bio", "city", "zip"} {
+			qb.Set(column, column)
+		}
+		query, _ := qb.Build()
+		return query
+	}
+
+	for _, update := range []bool{false, true} {
+		first := build(update)
+		for i := 0; i < 20; i++ {
+			if query := build(update); query != first {
+				t.Fatalf("build %d produced %q, want %q", i+2, query, first)
+			}
+		}
+	}
+
+	if got, want := build(false), "INSERT INTO users (name, email, age, bio, city, zip) VALUES (?, ?, ?, ?, ?, ?)"; got != want {
+		t.Errorf("insert = %q, want %q", got, want)
+	}
+}
+
+func TestOrderByColumn(t *testing.T) {
+	c, _ := newTestConnection(t, "postgres")
+
+	term, err := c.OrderByColumn(&testUser{}, "email", "desc")
+	if err != nil {
+		t.Fatalf("OrderByColumn: %v", err)
+	}
+	if term != `"email" DESC` {
+		t.Errorf("OrderByColumn = %q, want %q", term, `"email" DESC`)
+	}
+	if query, _ := NewQueryBuilder("users").Select().OrderBy(term).Build(); query != `SELECT * FROM users ORDER BY "email" DESC` {
+		t.Errorf("query = %q", query)
+	}
+
+	for _, tt := range []struct{ column, direction string }{
+		{"email; DROP TABLE users--", ""},
+		{"(SELECT password FROM admins)", "ASC"},
+		{"email", "DESC, (SELECT 1)"},
+	} {
+		if term, err := c.OrderByColumn(&testUser{}, tt.column, tt.direction); !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("OrderByColumn(%q, %q) = %q, %v, want ErrInvalidArgument", tt.column, tt.direction, term, err)
+		}
+	}
+}
+
+func TestSelectCoalesce(t *testing.T) {
+	tests := []struct {
+		driver string
+		want   string
+	}{
+		{"postgres", "SELECT id, COALESCE(nickname, 'none') AS nickname, COALESCE(score, 0) FROM profiles WHERE id > $1"},
+		{"mysql", "SELECT id, COALESCE(nickname, 'none') AS nickname, COALESCE(score, 0) FROM profiles WHERE id > ?"},
+		{"sqlite", "SELECT id, COALESCE(nickname, 'none') AS nickname, COALESCE(score, 0) FROM profiles WHERE id > ?"},
+	}
+
+	for _, tt := range tests {
+		c, db := newTestConnection(t, tt.driver)
+		qb := NewQueryBuilder("profiles").
+			Select("id").
+			SelectCoalesce("nickname", "'none'", "nickname").
+			SelectCoalesce("score", "0", "").
+			Where("id > ?", 0)
+
+		var rows []struct {
+			ID       int64  `db:"id"`
+			Nickname string `db:"nickname"`
+		}
+		if err := c.Select(context.Background(), &rows, qb); err != nil {
+			t.Fatalf("%s: Select: %v", tt.driver, err)
+		}
+		assertQueries(t, db, tt.want)
+	}
+}
+
+func TestILikeAndFullText(t *testing.T) {
+	tests := []struct {
+		driver   string
+		ilike    string
+		fullText string
+	}{
+		{"postgres", `SELECT * FROM users WHERE name ILIKE $1`, `SELECT * FROM users WHERE to_tsvector(name) @@ plainto_tsquery($1)`},
+		{"mysql", `SELECT * FROM users WHERE LOWER(name) LIKE LOWER(?)`, `SELECT * FROM users WHERE MATCH (name) AGAINST (? IN NATURAL LANGUAGE MODE)`},
+		{"sqlite", `SELECT * FROM users WHERE LOWER(name) LIKE LOWER(?)`, `SELECT * FROM users WHERE name MATCH ?`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			c, db := newTestConnection(t, tt.driver)
+			ctx := context.Background()
+
+			var users []testUser
+			condition, arg := c.ILike("name", "ann%")
+			if err := c.All(ctx, &users, condition, arg); err != nil {
+				t.Fatalf("All: %v", err)
+			}
+			condition, arg = c.FullText("name", "ann & bob")
+			if err := c.All(ctx, &users, condition, arg); err != nil {
+				t.Fatalf("All: %v", err)
+			}
+			assertQueries(t, db, tt.ilike, tt.fullText)
+
+			// The pattern and search query are bound, not spliced into the SQL
+			statements := db.Statements()
+			if statements[0].Args[0] != "ann%" || statements[1].Args[0] != "ann & bob" {
+				t.Errorf("args = %v and %v", statements[0].Args, statements[1].Args)
+			}
+		})
+	}
+}
+
+func TestDistinctFrom(t *testing.T) {
+	tests := []struct {
+		driver      string
+		distinct    string
+		notDistinct string
+	}{
+		{"postgres", "SELECT * FROM profiles WHERE nickname IS DISTINCT FROM $1", "SELECT * FROM profiles WHERE nickname IS NOT DISTINCT FROM $1"},
+		{"mysql", "SELECT * FROM profiles WHERE NOT (nickname <=> ?)", "SELECT * FROM profiles WHERE nickname <=> ?"},
+		{"sqlite", "SELECT * FROM profiles WHERE nickname IS NOT ?", "SELECT * FROM profiles WHERE nickname IS ?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			c, db := newTestConnection(t, tt.driver)
+			ctx := context.Background()
+
+			var profiles []testProfile
+			condition, arg := c.DistinctFrom("nickname", "annie")
+			if err := c.All(ctx, &profiles, condition, arg); err != nil {
+				t.Fatalf("All: %v", err)
+			}
+			// A nil value compares with NULL rather than matching nothing
+			condition, arg = c.NotDistinctFrom("nickname", nil)
+			if err := c.All(ctx, &profiles, condition, arg); err != nil {
+				t.Fatalf("All: %v", err)
+			}
+			assertQueries(t, db, tt.distinct, tt.notDistinct)
+
+			statements := db.Statements()
+			if statements[0].Args[0] != "annie" || statements[1].Args[0] != nil {
+				t.Errorf("args = %v and %v, want annie and NULL", statements[0].Args, statements[1].Args)
+			}
+		})
+	}
+}
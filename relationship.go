@@ -22,16 +22,52 @@ const (
 	ManyToMany
 )
 
+// OnDeleteAction defines what DeleteNested does with the related models of a
+// deleted model
+type OnDeleteAction int
+
+const (
+	// OnDeleteDefault follows the AutoDelete and NullifyOnDelete options of
+	// the delete
+	OnDeleteDefault OnDeleteAction = iota
+	// OnDeleteCascade deletes the related models
+	OnDeleteCascade
+	// OnDeleteSetNull sets the foreign keys of the related models to NULL.
+	// ManyToMany relationships only lose their join rows.
+	OnDeleteSetNull
+	// OnDeleteRestrict fails the delete while related models exist
+	OnDeleteRestrict
+	// OnDeleteNoAction leaves the related models alone. ManyToMany
+	// relationships still lose their join rows.
+	OnDeleteNoAction
+)
+
 // Relationship defines a relationship between models
 type Relationship struct {
-	Type           RelationshipType
-	Model          interface{}
+	Type  RelationshipType
+	Model interface{}
+	// ForeignKey and ReferenceKey name the key columns; composite keys list
+	// the columns in matching order separated by commas, e.g.
+	// "tenant_id, user_id"
 	ForeignKey     string
 	ReferenceKey   string
 	JoinTable      string
 	JoinForeignKey string
 	JoinRefKey     string
 	Preload        bool
+	// SelectColumns restricts the columns fetched by a preload, all when empty
+	SelectColumns []string
+	// PerParentLimit limits the HasMany and ManyToMany models preloaded for
+	// each parent
+	PerParentLimit int
+	// OrderBy orders preloaded HasMany models, e.g. "created_at DESC"
+	OrderBy string
+	// JoinType joins the join table to the related table in ManyToMany
+	// preloads: INNER (the default) skips join rows whose related model is
+	// missing, LEFT loads them as zero-valued models
+	JoinType string
+	// OnDelete overrides the NestedOption of DeleteNested for this relationship
+	OnDelete OnDeleteAction
 }
 
 // RelationshipOptions defines options for a relationship
@@ -42,6 +78,11 @@ type RelationshipOptions struct {
 	JoinForeignKey string
 	JoinRefKey     string
 	Preload        bool
+	SelectColumns  []string
+	PerParentLimit int
+	OrderBy        string
+	JoinType       string
+	OnDelete       OnDeleteAction
 }
 
 // validateRelationship validates a relationship
@@ -64,6 +105,9 @@ func validateRelationship(sourceType reflect.Type, rel *Relationship) error {
 		if rel.ReferenceKey == "" {
 			return errors.New("reference key is required for HasOne, BelongsTo, and HasMany relationships")
 		}
+		if len(keyColumns(rel.ForeignKey)) != len(keyColumns(rel.ReferenceKey)) {
+			return errors.New("foreign key and reference key must have the same number of columns")
+		}
 	case ManyToMany:
 		if rel.JoinTable == "" {
 			return errors.New("join table is required for ManyToMany relationship")
@@ -74,6 +118,11 @@ func validateRelationship(sourceType reflect.Type, rel *Relationship) error {
 		if rel.JoinRefKey == "" {
 			return errors.New("join reference key is required for ManyToMany relationship")
 		}
+		switch strings.ToUpper(rel.JoinType) {
+		case "", "INNER", "LEFT":
+		default:
+			return fmt.Errorf("invalid join type for ManyToMany relationship: %s", rel.JoinType)
+		}
 	default:
 		return fmt.Errorf("invalid relationship type: %d", rel.Type)
 	}
@@ -81,6 +130,75 @@ func validateRelationship(sourceType reflect.Type, rel *Relationship) error {
 	return nil
 }
 
+// selectColumns returns the columns a preload fetches from the related table:
+// nil for every column, or the relationship's SelectColumns plus the given keys
+func selectColumns(relInfo *ModelInfo, rel *Relationship, keys ...string) ([]string, error) {
+	if len(rel.SelectColumns) == 0 {
+		return nil, nil
+	}
+
+	selected, err := columnSet(relInfo, rel.SelectColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := append([]string(nil), rel.SelectColumns...)
+	for _, key := range keys {
+		if !selected[key] {
+			selected[key] = true
+			columns = append(columns, key)
+		}
+	}
+	return columns, nil
+}
+
+// keyColumns splits a comma-separated list of key columns, as used by the keys
+// of a relationship over a composite foreign key, e.g. "tenant_id, user_id"
+func keyColumns(keys string) []string {
+	columns := strings.Split(keys, ",")
+	for i := range columns {
+		columns[i] = strings.TrimSpace(columns[i])
+	}
+	return columns
+}
+
+// sourceKeyValues returns the values of the source fields mapped to the key
+// columns, which must pair up with the matching columns of the related model
+func sourceKeyValues(sourceValue reflect.Value, sourceInfo *ModelInfo, keys, matching []string) ([]interface{}, error) {
+	if len(keys) != len(matching) {
+		return nil, fmt.Errorf("relationship keys %s do not match %s", strings.Join(keys, ", "), strings.Join(matching, ", "))
+	}
+
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		fieldValue, err := columnField(sourceValue, sourceInfo, key)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = fieldValue.Interface()
+	}
+	return values, nil
+}
+
+// whereKeys adds conditions matching each key column to its value
+func (c *Connection) whereKeys(qb *QueryBuilder, columns []string, values []interface{}) {
+	for i, column := range columns {
+		qb.Where(c.dialect.Quote(column)+" = ?", values[i])
+	}
+}
+
+// quoteAll quotes each identifier with the connection's dialect
+func (c *Connection) quoteAll(identifiers []string) []string {
+	if identifiers == nil {
+		return nil
+	}
+	quoted := make([]string, len(identifiers))
+	for i, identifier := range identifiers {
+		quoted[i] = c.dialect.Quote(identifier)
+	}
+	return quoted
+}
+
 // preloadHasOne preloads a HasOne relationship
 func (c *Connection) preloadHasOne(ctx context.Context, source interface{}, field string, rel *Relationship) error {
 	sourceValue := reflect.ValueOf(source)
@@ -93,14 +211,22 @@ func (c *Connection) preloadHasOne(ctx context.Context, source interface{}, fiel
 	}
 
 	// Get the primary key value from the source
-	sourceInfo, err := extractModelInfo(source)
+	sourceInfo, err := c.modelInfo(ctx, source)
 	if err != nil {
 		return err
 	}
 
-	pkField := sourceValue.FieldByName(toFieldName(sourceInfo.PrimaryKey))
-	if !pkField.IsValid() {
-		return fmt.Errorf("primary key field %s not found in source model", sourceInfo.PrimaryKey)
+	// Get the source key values: the primary key, or the reference key
+	// columns of a composite foreign key
+	foreignKeys := keyColumns(rel.ForeignKey)
+	sourceKeys := []string{sourceInfo.PrimaryKey}
+	if len(foreignKeys) > 1 {
+		sourceKeys = keyColumns(rel.ReferenceKey)
+	}
+
+	keyValues, err := sourceKeyValues(sourceValue, sourceInfo, sourceKeys, foreignKeys)
+	if err != nil {
+		return err
 	}
 
 	// Create a new instance of the related model
@@ -111,19 +237,24 @@ func (c *Connection) preloadHasOne(ctx context.Context, source interface{}, fiel
 
 	// Build the query to find the related model
 	relModel := reflect.New(relType).Interface()
-	relInfo, err := extractModelInfo(relModel)
+	relInfo, err := c.modelInfo(ctx, relModel)
+	if err != nil {
+		return err
+	}
+
+	selected, err := selectColumns(relInfo, rel, append([]string{relInfo.PrimaryKey}, foreignKeys...)...)
 	if err != nil {
 		return err
 	}
 
 	builder := NewQueryBuilder(relInfo.TableName).
-		Select().
-		Where(fmt.Sprintf("%s = ?", rel.ForeignKey), pkField.Interface())
+		Select(c.quoteAll(selected)...)
+	c.whereKeys(builder, foreignKeys, keyValues)
 
 	query, args := builder.Build()
 
 	// Execute the query
-	rows, err := c.DB().QueryContext(ctx, query, args...)
+	rows, err := c.query(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -143,11 +274,7 @@ func (c *Connection) preloadHasOne(ctx context.Context, source interface{}, fiel
 	// Create a new instance of the related model
 	relValue := reflect.New(relType).Elem()
 
-	// Create a slice of interface{} to hold the values
-	values := make([]interface{}, len(columns))
-	for i := range values {
-		values[i] = new(interface{})
-	}
+	values := scanTargets(len(columns))
 
 	// Scan the row into the values
 	if err := rows.Scan(values...); err != nil {
@@ -159,12 +286,8 @@ func (c *Connection) preloadHasOne(ctx context.Context, source interface{}, fiel
 		// Find the corresponding field in the model
 		for _, field := range relInfo.Fields {
 			if strings.EqualFold(field.DBName, col) {
-				fieldValue := relValue.FieldByName(field.Name)
-				if fieldValue.CanSet() {
-					val := reflect.ValueOf(*(values[i].(*interface{})))
-					if val.Type().ConvertibleTo(fieldValue.Type()) {
-						fieldValue.Set(val.Convert(fieldValue.Type()))
-					}
+				if err := c.assignColumn(relValue.FieldByName(field.Name), field, *(values[i].(*interface{}))); err != nil {
+					return err
 				}
 				break
 			}
@@ -193,10 +316,30 @@ func (c *Connection) preloadBelongsTo(ctx context.Context, source interface{}, f
 		return errors.New("source must be a struct or pointer to struct")
 	}
 
-	// Get the foreign key value from the source
-	fkField := sourceValue.FieldByName(toFieldName(rel.ForeignKey))
-	if !fkField.IsValid() {
-		return fmt.Errorf("foreign key field %s not found in source model", rel.ForeignKey)
+	sourceInfo, err := c.modelInfo(ctx, source)
+	if err != nil {
+		return err
+	}
+
+	// Get the foreign key values from the source
+	referenceKeys := keyColumns(rel.ReferenceKey)
+	keyValues, err := sourceKeyValues(sourceValue, sourceInfo, keyColumns(rel.ForeignKey), referenceKeys)
+	if err != nil {
+		return err
+	}
+
+	fieldValue := sourceValue.FieldByName(field)
+	if !fieldValue.CanSet() {
+		return fmt.Errorf("field %s is not settable", field)
+	}
+
+	// An unset optional foreign key, NULL or zero, references no row, so
+	// don't query for one
+	for _, value := range keyValues {
+		if value == nil || isZeroValue(reflect.ValueOf(value)) {
+			fieldValue.Set(reflect.Zero(fieldValue.Type()))
+			return nil
+		}
 	}
 
 	// Create a new instance of the related model
@@ -207,19 +350,24 @@ func (c *Connection) preloadBelongsTo(ctx context.Context, source interface{}, f
 
 	// Build the query to find the related model
 	relModel := reflect.New(relType).Interface()
-	relInfo, err := extractModelInfo(relModel)
+	relInfo, err := c.modelInfo(ctx, relModel)
+	if err != nil {
+		return err
+	}
+
+	selected, err := selectColumns(relInfo, rel, append([]string{relInfo.PrimaryKey}, referenceKeys...)...)
 	if err != nil {
 		return err
 	}
 
 	builder := NewQueryBuilder(relInfo.TableName).
-		Select().
-		Where(fmt.Sprintf("%s = ?", rel.ReferenceKey), fkField.Interface())
+		Select(c.quoteAll(selected)...)
+	c.whereKeys(builder, referenceKeys, keyValues)
 
 	query, args := builder.Build()
 
 	// Execute the query
-	rows, err := c.DB().QueryContext(ctx, query, args...)
+	rows, err := c.query(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -239,11 +387,7 @@ func (c *Connection) preloadBelongsTo(ctx context.Context, source interface{}, f
 	// Create a new instance of the related model
 	relValue := reflect.New(relType).Elem()
 
-	// Create a slice of interface{} to hold the values
-	values := make([]interface{}, len(columns))
-	for i := range values {
-		values[i] = new(interface{})
-	}
+	values := scanTargets(len(columns))
 
 	// Scan the row into the values
 	if err := rows.Scan(values...); err != nil {
@@ -255,12 +399,8 @@ func (c *Connection) preloadBelongsTo(ctx context.Context, source interface{}, f
 		// Find the corresponding field in the model
 		for _, field := range relInfo.Fields {
 			if strings.EqualFold(field.DBName, col) {
-				fieldValue := relValue.FieldByName(field.Name)
-				if fieldValue.CanSet() {
-					val := reflect.ValueOf(*(values[i].(*interface{})))
-					if val.Type().ConvertibleTo(fieldValue.Type()) {
-						fieldValue.Set(val.Convert(fieldValue.Type()))
-					}
+				if err := c.assignColumn(relValue.FieldByName(field.Name), field, *(values[i].(*interface{}))); err != nil {
+					return err
 				}
 				break
 			}
@@ -268,11 +408,6 @@ func (c *Connection) preloadBelongsTo(ctx context.Context, source interface{}, f
 	}
 
 	// Set the related model to the field
-	fieldValue := sourceValue.FieldByName(field)
-	if !fieldValue.CanSet() {
-		return fmt.Errorf("field %s is not settable", field)
-	}
-
 	fieldValue.Set(relValue.Addr())
 
 	return rows.Err()
@@ -290,14 +425,22 @@ func (c *Connection) preloadHasMany(ctx context.Context, source interface{}, fie
 	}
 
 	// Get the primary key value from the source
-	sourceInfo, err := extractModelInfo(source)
+	sourceInfo, err := c.modelInfo(ctx, source)
 	if err != nil {
 		return err
 	}
 
-	pkField := sourceValue.FieldByName(toFieldName(sourceInfo.PrimaryKey))
-	if !pkField.IsValid() {
-		return fmt.Errorf("primary key field %s not found in source model", sourceInfo.PrimaryKey)
+	// Get the source key values: the primary key, or the reference key
+	// columns of a composite foreign key
+	foreignKeys := keyColumns(rel.ForeignKey)
+	sourceKeys := []string{sourceInfo.PrimaryKey}
+	if len(foreignKeys) > 1 {
+		sourceKeys = keyColumns(rel.ReferenceKey)
+	}
+
+	keyValues, err := sourceKeyValues(sourceValue, sourceInfo, sourceKeys, foreignKeys)
+	if err != nil {
+		return err
 	}
 
 	// Create a new instance of the related model
@@ -308,19 +451,31 @@ func (c *Connection) preloadHasMany(ctx context.Context, source interface{}, fie
 
 	// Build the query to find the related models
 	relModel := reflect.New(relType).Interface()
-	relInfo, err := extractModelInfo(relModel)
+	relInfo, err := c.modelInfo(ctx, relModel)
+	if err != nil {
+		return err
+	}
+
+	selected, err := selectColumns(relInfo, rel, append([]string{relInfo.PrimaryKey}, foreignKeys...)...)
 	if err != nil {
 		return err
 	}
 
 	builder := NewQueryBuilder(relInfo.TableName).
-		Select().
-		Where(fmt.Sprintf("%s = ?", rel.ForeignKey), pkField.Interface())
+		Select(c.quoteAll(selected)...)
+	c.whereKeys(builder, foreignKeys, keyValues)
+	if rel.OrderBy != "" {
+		builder.OrderBy(rel.OrderBy)
+	}
+	limit, maxLoaded := c.preloadLimit(rel)
+	if limit > 0 {
+		builder.Limit(limit)
+	}
 
 	query, args := builder.Build()
 
 	// Execute the query
-	rows, err := c.DB().QueryContext(ctx, query, args...)
+	rows, err := c.query(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -350,17 +505,18 @@ func (c *Connection) preloadHasMany(ctx context.Context, source interface{}, fie
 	// Create a new slice for the related models
 	newSlice := reflect.MakeSlice(sliceType, 0, 0)
 
+	values := scanTargets(len(columns))
+
 	// Iterate over the rows and create related models
 	for rows.Next() {
+		// Stop promptly if the context has been cancelled
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		// Create a new instance of the related model
 		relValue := reflect.New(relType).Elem()
 
-		// Create a slice of interface{} to hold the values
-		values := make([]interface{}, len(columns))
-		for i := range values {
-			values[i] = new(interface{})
-		}
-
 		// Scan the row into the values
 		if err := rows.Scan(values...); err != nil {
 			return err
@@ -371,12 +527,8 @@ func (c *Connection) preloadHasMany(ctx context.Context, source interface{}, fie
 			// Find the corresponding field in the model
 			for _, field := range relInfo.Fields {
 				if strings.EqualFold(field.DBName, col) {
-					fValue := relValue.FieldByName(field.Name)
-					if fValue.CanSet() {
-						val := reflect.ValueOf(*(values[i].(*interface{})))
-						if val.Type().ConvertibleTo(fValue.Type()) {
-							fValue.Set(val.Convert(fValue.Type()))
-						}
+					if err := c.assignColumn(relValue.FieldByName(field.Name), field, *(values[i].(*interface{}))); err != nil {
+						return err
 					}
 					break
 				}
@@ -391,9 +543,195 @@ func (c *Connection) preloadHasMany(ctx context.Context, source interface{}, fie
 		}
 	}
 
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := checkPreloadLimit(field, newSlice.Len(), maxLoaded); err != nil {
+		return err
+	}
+
 	// Set the new slice to the field
 	fieldValue.Set(newSlice)
 
+	return nil
+}
+
+// preloadHasManyLimited preloads a HasMany relationship with a PerParentLimit
+// for every model of the slice in one query per chunk of parents, ranking the
+// related models of each parent with ROW_NUMBER()
+func (c *Connection) preloadHasManyLimited(ctx context.Context, sliceValue reflect.Value, elemType reflect.Type, field string, rel *Relationship) error {
+	if sliceValue.Len() == 0 {
+		return nil
+	}
+
+	sourceInfo, err := c.modelInfo(ctx, reflect.New(elemType).Interface())
+	if err != nil {
+		return err
+	}
+
+	structField, ok := elemType.FieldByName(field)
+	if !ok {
+		return fmt.Errorf("field %s does not exist in model", field)
+	}
+	sliceType := structField.Type
+	if sliceType.Kind() != reflect.Slice {
+		return fmt.Errorf("field %s is not a slice", field)
+	}
+	isPtr := sliceType.Elem().Kind() == reflect.Ptr
+
+	relType := reflect.TypeOf(rel.Model)
+	if relType.Kind() == reflect.Ptr {
+		relType = relType.Elem()
+	}
+
+	relInfo, err := c.modelInfo(ctx, reflect.New(relType).Interface())
+	if err != nil {
+		return err
+	}
+
+	selected, err := selectColumns(relInfo, rel, relInfo.PrimaryKey, rel.ForeignKey)
+	if err != nil {
+		return err
+	}
+
+	if sourceInfo.PrimaryKeyField == "" {
+		return fmt.Errorf("primary key field %s not found in source model", sourceInfo.PrimaryKey)
+	}
+
+	fkInfo, ok := fieldByColumn(relInfo, rel.ForeignKey)
+	if !ok {
+		return fmt.Errorf("foreign key field %s not found in related model", rel.ForeignKey)
+	}
+
+	// Group the parents by primary key and reset their related models
+	parents := make(map[string][]reflect.Value)
+	var ids []interface{}
+	for i := 0; i < sliceValue.Len(); i++ {
+		parent := sliceValue.Index(i)
+		if parent.Kind() == reflect.Ptr {
+			parent = parent.Elem()
+		}
+
+		pkField := parent.FieldByName(sourceInfo.PrimaryKeyField)
+
+		fieldValue := parent.FieldByName(field)
+		if !fieldValue.CanSet() {
+			return fmt.Errorf("field %s is not settable", field)
+		}
+		fieldValue.Set(reflect.MakeSlice(sliceType, 0, 0))
+
+		key := idString(pkField.Interface())
+		if _, ok := parents[key]; !ok {
+			ids = append(ids, pkField.Interface())
+		}
+		parents[key] = append(parents[key], fieldValue)
+	}
+
+	projection := "r.*"
+	if selected != nil {
+		projection = "r." + strings.Join(c.quoteAll(selected), ", r.")
+	}
+
+	limit, maxLoaded := c.preloadLimit(rel)
+	foreignKey := c.dialect.Quote(rel.ForeignKey)
+	orderBy := rel.OrderBy
+	if orderBy == "" {
+		orderBy = c.dialect.Quote(relInfo.PrimaryKey)
+	}
+
+	chunkSize := c.dialect.MaxPlaceholders()
+	for start := 0; start < len(ids); start += chunkSize {
+		end := start + chunkSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		placeholders := make([]string, end-start)
+		for i := range placeholders {
+			placeholders[i] = c.dialect.Placeholder(i + 1)
+		}
+
+		query := fmt.Sprintf(
+			"SELECT * FROM (SELECT %s, ROW_NUMBER() OVER (PARTITION BY r.%s ORDER BY %s) AS sage_row_number FROM %s r WHERE r.%s IN (%s)) sage_ranked WHERE sage_row_number <= %d ORDER BY %s, sage_row_number",
+			projection,
+			foreignKey,
+			orderBy,
+			c.dialect.Quote(relInfo.TableName),
+			foreignKey,
+			strings.Join(placeholders, ", "),
+			limit,
+			foreignKey,
+		)
+
+		if err := c.scanLimitedChildren(ctx, query, ids[start:end], relInfo, relType, fkInfo.Name, isPtr, parents); err != nil {
+			return err
+		}
+	}
+
+	for _, fieldValues := range parents {
+		if err := checkPreloadLimit(field, fieldValues[0].Len(), maxLoaded); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanLimitedChildren runs a ranked HasMany preload query and appends each
+// related model to the slice fields of the parents it belongs to
+func (c *Connection) scanLimitedChildren(ctx context.Context, query string, args []interface{}, relInfo *ModelInfo, relType reflect.Type, fkName string, isPtr bool, parents map[string][]reflect.Value) error {
+	rows, err := c.query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	indexes := columnFieldIndexes(relInfo, relType, columns)
+	fields := columnFields(relInfo, columns)
+
+	values := scanTargets(len(columns))
+
+	for rows.Next() {
+		// Stop promptly if the context has been cancelled
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := rows.Scan(values...); err != nil {
+			return err
+		}
+
+		relValue := reflect.New(relType).Elem()
+		for i, index := range indexes {
+			if index != nil {
+				if err := c.assignColumn(relValue.FieldByIndex(index), fields[i], *(values[i].(*interface{}))); err != nil {
+					return err
+				}
+			}
+		}
+
+		// A child whose foreign key is NULL belongs to no parent
+		fk := relValue.FieldByName(fkName)
+		if fk.Kind() == reflect.Ptr && fk.IsNil() {
+			continue
+		}
+
+		for _, fieldValue := range parents[idString(fk.Interface())] {
+			if isPtr {
+				// Give every parent its own copy of the related model
+				elem := reflect.New(relType)
+				elem.Elem().Set(relValue)
+				fieldValue.Set(reflect.Append(fieldValue, elem))
+			} else {
+				fieldValue.Set(reflect.Append(fieldValue, relValue))
+			}
+		}
+	}
+
 	return rows.Err()
 }
 
@@ -409,14 +747,14 @@ func (c *Connection) preloadManyToMany(ctx context.Context, source interface{},
 	}
 
 	// Get the primary key value from the source
-	sourceInfo, err := extractModelInfo(source)
+	sourceInfo, err := c.modelInfo(ctx, source)
 	if err != nil {
 		return err
 	}
 
-	pkField := sourceValue.FieldByName(toFieldName(sourceInfo.PrimaryKey))
-	if !pkField.IsValid() {
-		return fmt.Errorf("primary key field %s not found in source model", sourceInfo.PrimaryKey)
+	pkField, err := primaryKeyField(sourceValue, sourceInfo)
+	if err != nil {
+		return err
 	}
 
 	// Create a new instance of the related model
@@ -427,23 +765,46 @@ func (c *Connection) preloadManyToMany(ctx context.Context, source interface{},
 
 	// Build the query to find the related models
 	relModel := reflect.New(relType).Interface()
-	relInfo, err := extractModelInfo(relModel)
+	relInfo, err := c.modelInfo(ctx, relModel)
 	if err != nil {
 		return err
 	}
 
-	// Build a query to fetch related models through the join table
+	selected, err := selectColumns(relInfo, rel, relInfo.PrimaryKey)
+	if err != nil {
+		return err
+	}
+
+	projection := "r.*"
+	if selected != nil {
+		projection = "r." + strings.Join(c.quoteAll(selected), ", r.")
+	}
+
+	joinType := "INNER"
+	if rel.JoinType != "" {
+		joinType = strings.ToUpper(rel.JoinType)
+	}
+
+	// Build a query to fetch related models through the join table, matching
+	// join rows to the related table's primary key
 	query := fmt.Sprintf(
-		"SELECT r.* FROM %s r INNER JOIN %s j ON r.%s = j.%s WHERE j.%s = ?",
-		relInfo.TableName,
-		rel.JoinTable,
-		rel.ReferenceKey,
-		rel.JoinRefKey,
-		rel.JoinForeignKey,
+		"SELECT %s FROM %s j %s JOIN %s r ON r.%s = j.%s WHERE j.%s = ?",
+		projection,
+		c.dialect.Quote(rel.JoinTable),
+		joinType,
+		c.dialect.Quote(relInfo.TableName),
+		c.dialect.Quote(relInfo.PrimaryKey),
+		c.dialect.Quote(rel.JoinRefKey),
+		c.dialect.Quote(rel.JoinForeignKey),
 	)
 
+	limit, maxLoaded := c.preloadLimit(rel)
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
 	// Execute the query
-	rows, err := c.DB().QueryContext(ctx, query, pkField.Interface())
+	rows, err := c.query(ctx, query, pkField.Interface())
 	if err != nil {
 		return err
 	}
@@ -473,17 +834,18 @@ func (c *Connection) preloadManyToMany(ctx context.Context, source interface{},
 	// Create a new slice for the related models
 	newSlice := reflect.MakeSlice(sliceType, 0, 0)
 
+	values := scanTargets(len(columns))
+
 	// Iterate over the rows and create related models
 	for rows.Next() {
+		// Stop promptly if the context has been cancelled
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		// Create a new instance of the related model
 		relValue := reflect.New(relType).Elem()
 
-		// Create a slice of interface{} to hold the values
-		values := make([]interface{}, len(columns))
-		for i := range values {
-			values[i] = new(interface{})
-		}
-
 		// Scan the row into the values
 		if err := rows.Scan(values...); err != nil {
 			return err
@@ -494,12 +856,8 @@ func (c *Connection) preloadManyToMany(ctx context.Context, source interface{},
 			// Find the corresponding field in the model
 			for _, field := range relInfo.Fields {
 				if strings.EqualFold(field.DBName, col) {
-					fValue := relValue.FieldByName(field.Name)
-					if fValue.CanSet() {
-						val := reflect.ValueOf(*(values[i].(*interface{})))
-						if val.Type().ConvertibleTo(fValue.Type()) {
-							fValue.Set(val.Convert(fValue.Type()))
-						}
+					if err := c.assignColumn(relValue.FieldByName(field.Name), field, *(values[i].(*interface{}))); err != nil {
+						return err
 					}
 					break
 				}
@@ -514,10 +872,42 @@ func (c *Connection) preloadManyToMany(ctx context.Context, source interface{},
 		}
 	}
 
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := checkPreloadLimit(field, newSlice.Len(), maxLoaded); err != nil {
+		return err
+	}
+
 	// Set the new slice to the field
 	fieldValue.Set(newSlice)
 
-	return rows.Err()
+	return nil
+}
+
+// preloadLimit returns the number of related models a HasMany or ManyToMany
+// preload fetches for each parent, unlimited when zero, and the number above
+// which the preload fails with ErrPreloadLimit, unchecked when zero
+func (c *Connection) preloadLimit(rel *Relationship) (limit int, maxLoaded int) {
+	limit = rel.PerParentLimit
+	if c.options.MaxPreload <= 0 || (limit > 0 && limit <= c.options.MaxPreload) {
+		return limit, 0
+	}
+
+	// Fetch one model more than allowed to tell whether the limit is exceeded
+	if c.options.StrictMaxPreload {
+		return c.options.MaxPreload + 1, c.options.MaxPreload
+	}
+	return c.options.MaxPreload, 0
+}
+
+// checkPreloadLimit checks the number of related models loaded into field
+// against the maximum returned by preloadLimit
+func checkPreloadLimit(field string, loaded int, maxLoaded int) error {
+	if maxLoaded > 0 && loaded > maxLoaded {
+		return fmt.Errorf("%w: %s loads more than %d models", ErrPreloadLimit, field, maxLoaded)
+	}
+	return nil
 }
 
 // Preload preloads the given relationships for the model
@@ -552,6 +942,24 @@ func (c *Connection) Preload(ctx context.Context, source interface{}, relationsh
 			return errors.New("source slice must contain structs or pointers to structs")
 		}
 
+		// Preload limited HasMany relationships of all elements in one query
+		if !c.options.DisableWindowFunctions {
+			remaining := make(map[string]*Relationship, len(relationships))
+			for field, rel := range relationships {
+				if limit, _ := c.preloadLimit(rel); rel.Type != HasMany || limit <= 0 || len(keyColumns(rel.ForeignKey)) > 1 {
+					remaining[field] = rel
+					continue
+				}
+				if err := validateRelationship(elemType, rel); err != nil {
+					return err
+				}
+				if err := c.preloadHasManyLimited(ctx, sourceValue, elemType, field, rel); err != nil {
+					return err
+				}
+			}
+			relationships = remaining
+		}
+
 		// Iterate over the slice elements
 		for i := 0; i < sourceValue.Len(); i++ {
 			elem := sourceValue.Index(i)
@@ -610,13 +1018,15 @@ func (c *Connection) Preload(ctx context.Context, source interface{}, relationsh
 	return nil
 }
 
-// toFieldName converts a snake_case database column name to a CamelCase field name
-func toFieldName(columnName string) string {
-	parts := strings.Split(columnName, "_")
-	for i := range parts {
-		parts[i] = strings.Title(parts[i])
+// LoadRelation loads a single relationship of a model on demand, e.g. after a
+// plain Find, into the named field. source must be a pointer to a struct.
+func (c *Connection) LoadRelation(ctx context.Context, source interface{}, field string, rel *Relationship) error {
+	v := reflect.ValueOf(source)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New("source must be a non-nil pointer to a struct")
 	}
-	return strings.Join(parts, "")
+
+	return c.Preload(ctx, source, map[string]*Relationship{field: rel})
 }
 
 // Associate associates a ManyToMany relationship between source and target
@@ -636,42 +1046,44 @@ func (c *Connection) Associate(ctx context.Context, source interface{}, field st
 	}
 
 	// Get the primary key values
-	sourceInfo, err := extractModelInfo(source)
+	sourceInfo, err := c.modelInfo(ctx, source)
 	if err != nil {
 		return err
 	}
 
-	targetInfo, err := extractModelInfo(target)
+	targetInfo, err := c.modelInfo(ctx, target)
 	if err != nil {
 		return err
 	}
 
-	sourcePkField := sourceValue.FieldByName(toFieldName(sourceInfo.PrimaryKey))
-	if !sourcePkField.IsValid() {
-		return fmt.Errorf("primary key field %s not found in source model", sourceInfo.PrimaryKey)
+	sourcePkField, err := primaryKeyField(sourceValue, sourceInfo)
+	if err != nil {
+		return err
 	}
 
-	targetPkField := targetValue.FieldByName(toFieldName(targetInfo.PrimaryKey))
-	if !targetPkField.IsValid() {
-		return fmt.Errorf("primary key field %s not found in target model", targetInfo.PrimaryKey)
+	targetPkField, err := primaryKeyField(targetValue, targetInfo)
+	if err != nil {
+		return err
 	}
 
 	// Insert a record in the join table
 	query := fmt.Sprintf(
 		"INSERT INTO %s (%s, %s) VALUES (?, ?)",
-		rel.JoinTable,
-		rel.JoinForeignKey,
-		rel.JoinRefKey,
+		c.dialect.Quote(rel.JoinTable),
+		c.dialect.Quote(rel.JoinForeignKey),
+		c.dialect.Quote(rel.JoinRefKey),
 	)
 
-	_, err = c.DB().ExecContext(
+	_, err = c.exec(
 		ctx,
 		query,
 		sourcePkField.Interface(),
 		targetPkField.Interface(),
 	)
 
-	return err
+	// An existing pair fails with ErrDuplicate and a missing source or
+	// target with ErrForeignKeyViolation
+	return WrapError(classifyError(err), "associate %s", rel.JoinTable)
 }
 
 // Dissociate removes a ManyToMany relationship between source and target
@@ -691,35 +1103,35 @@ func (c *Connection) Dissociate(ctx context.Context, source interface{}, field s
 	}
 
 	// Get the primary key values
-	sourceInfo, err := extractModelInfo(source)
+	sourceInfo, err := c.modelInfo(ctx, source)
 	if err != nil {
 		return err
 	}
 
-	targetInfo, err := extractModelInfo(target)
+	targetInfo, err := c.modelInfo(ctx, target)
 	if err != nil {
 		return err
 	}
 
-	sourcePkField := sourceValue.FieldByName(toFieldName(sourceInfo.PrimaryKey))
-	if !sourcePkField.IsValid() {
-		return fmt.Errorf("primary key field %s not found in source model", sourceInfo.PrimaryKey)
+	sourcePkField, err := primaryKeyField(sourceValue, sourceInfo)
+	if err != nil {
+		return err
 	}
 
-	targetPkField := targetValue.FieldByName(toFieldName(targetInfo.PrimaryKey))
-	if !targetPkField.IsValid() {
-		return fmt.Errorf("primary key field %s not found in target model", targetInfo.PrimaryKey)
+	targetPkField, err := primaryKeyField(targetValue, targetInfo)
+	if err != nil {
+		return err
 	}
 
 	// Delete the record from the join table
 	query := fmt.Sprintf(
 		"DELETE FROM %s WHERE %s = ? AND %s = ?",
-		rel.JoinTable,
-		rel.JoinForeignKey,
-		rel.JoinRefKey,
+		c.dialect.Quote(rel.JoinTable),
+		c.dialect.Quote(rel.JoinForeignKey),
+		c.dialect.Quote(rel.JoinRefKey),
 	)
 
-	_, err = c.DB().ExecContext(
+	_, err = c.exec(
 		ctx,
 		query,
 		sourcePkField.Interface(),
@@ -0,0 +1,132 @@
+package sage
+
+import (
+	"reflect"
+	"sort"
+)
+
+// HasOneRel returns a HasOne relationship from source to model with the
+// conventional keys: a <source>_id foreign key on model referencing the
+// source's primary key. Non-empty fields of opts override the defaults.
+func HasOneRel(source, model interface{}, opts ...RelationshipOptions) *Relationship {
+	return hasRel(HasOne, source, model, opts)
+}
+
+// HasManyRel returns a HasMany relationship from source to model with the
+// conventional keys: a <source>_id foreign key on model referencing the
+// source's primary key. Non-empty fields of opts override the defaults.
+func HasManyRel(source, model interface{}, opts ...RelationshipOptions) *Relationship {
+	return hasRel(HasMany, source, model, opts)
+}
+
+// BelongsToRel returns a BelongsTo relationship from source to model with the
+// conventional keys: a <model>_id foreign key on source referencing the
+// model's primary key. Non-empty fields of opts override the defaults.
+func BelongsToRel(source, model interface{}, opts ...RelationshipOptions) *Relationship {
+	rel := &Relationship{
+		Type:         BelongsTo,
+		Model:        model,
+		ForeignKey:   modelName(model) + "_id",
+		ReferenceKey: primaryKeyOf(model),
+	}
+	return applyRelationshipOptions(rel, opts)
+}
+
+// ManyToManyRel returns a ManyToMany relationship from source to model with
+// the conventional join table, named after both tables in alphabetical order
+// (e.g. post_tag), holding <source>_id and <model>_id columns. Non-empty
+// fields of opts override the defaults.
+func ManyToManyRel(source, model interface{}, opts ...RelationshipOptions) *Relationship {
+	tables := []string{tableNameOf(source), tableNameOf(model)}
+	sort.Strings(tables)
+
+	rel := &Relationship{
+		Type:           ManyToMany,
+		Model:          model,
+		ReferenceKey:   primaryKeyOf(model),
+		JoinTable:      tables[0] + "_" + tables[1],
+		JoinForeignKey: modelName(source) + "_id",
+		JoinRefKey:     modelName(model) + "_id",
+	}
+	return applyRelationshipOptions(rel, opts)
+}
+
+// hasRel builds a HasOne or HasMany relationship with conventional keys
+func hasRel(relType RelationshipType, source, model interface{}, opts []RelationshipOptions) *Relationship {
+	rel := &Relationship{
+		Type:         relType,
+		Model:        model,
+		ForeignKey:   modelName(source) + "_id",
+		ReferenceKey: primaryKeyOf(source),
+	}
+	return applyRelationshipOptions(rel, opts)
+}
+
+// applyRelationshipOptions overrides the relationship with the non-empty options
+func applyRelationshipOptions(rel *Relationship, opts []RelationshipOptions) *Relationship {
+	for _, opt := range opts {
+		if opt.ForeignKey != "" {
+			rel.ForeignKey = opt.ForeignKey
+		}
+		if opt.ReferenceKey != "" {
+			rel.ReferenceKey = opt.ReferenceKey
+		}
+		if opt.JoinTable != "" {
+			rel.JoinTable = opt.JoinTable
+		}
+		if opt.JoinForeignKey != "" {
+			rel.JoinForeignKey = opt.JoinForeignKey
+		}
+		if opt.JoinRefKey != "" {
+			rel.JoinRefKey = opt.JoinRefKey
+		}
+		if opt.Preload {
+			rel.Preload = true
+		}
+		if len(opt.SelectColumns) > 0 {
+			rel.SelectColumns = opt.SelectColumns
+		}
+		if opt.PerParentLimit > 0 {
+			rel.PerParentLimit = opt.PerParentLimit
+		}
+		if opt.OrderBy != "" {
+			rel.OrderBy = opt.OrderBy
+		}
+		if opt.JoinType != "" {
+			rel.JoinType = opt.JoinType
+		}
+		if opt.OnDelete != OnDeleteDefault {
+			rel.OnDelete = opt.OnDelete
+		}
+	}
+	return rel
+}
+
+// modelName returns the snake_case name of the model's struct type
+func modelName(model interface{}) string {
+	t := reflect.TypeOf(model)
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice) {
+		t = t.Elem()
+	}
+	if t == nil {
+		return ""
+	}
+	return toSnakeCase(t.Name())
+}
+
+// tableNameOf returns the table name of the model, or its snake_case name
+// when the model is invalid
+func tableNameOf(model interface{}) string {
+	if info, err := extractModelInfo(model); err == nil {
+		return info.TableName
+	}
+	return modelName(model)
+}
+
+// primaryKeyOf returns the primary key column of the model, "id" by default
+func primaryKeyOf(model interface{}) string {
+	if info, err := extractModelInfo(model); err == nil {
+		return info.PrimaryKey
+	}
+	return "id"
+}
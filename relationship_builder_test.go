@@ -0,0 +1,37 @@
+package sage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRelationshipBuilders(t *testing.T) {
+	tests := []struct {
+		name   string
+		source interface{}
+		got    *Relationship
+		want   *Relationship
+	}{
+		{"HasOne", &testOrder{}, HasOneRel(&testOrder{}, &testLine{}),
+			&Relationship{Type: HasOne, Model: &testLine{}, ForeignKey: "test_order_id", ReferenceKey: "id"}},
+		{"HasMany", &testOrder{}, HasManyRel(&testOrder{}, &testLine{}),
+			&Relationship{Type: HasMany, Model: &testLine{}, ForeignKey: "test_order_id", ReferenceKey: "id"}},
+		{"BelongsTo", &testLine{}, BelongsToRel(&testLine{}, &testOrder{}),
+			&Relationship{Type: BelongsTo, Model: &testOrder{}, ForeignKey: "test_order_id", ReferenceKey: "id"}},
+		{"ManyToMany", &testTag{}, ManyToManyRel(&testTag{}, &testPost{}),
+			&Relationship{Type: ManyToMany, Model: &testPost{}, ReferenceKey: "id", JoinTable: "posts_tags", JoinForeignKey: "test_tag_id", JoinRefKey: "test_post_id"}},
+		{"non-default primary key", &testUser{}, BelongsToRel(&testUser{}, &testSetting{}),
+			&Relationship{Type: BelongsTo, Model: &testSetting{}, ForeignKey: "test_setting_id", ReferenceKey: "key"}},
+		{"overridden", &testOrder{}, HasManyRel(&testOrder{}, &testLine{}, RelationshipOptions{ForeignKey: "order", PerParentLimit: 3}),
+			&Relationship{Type: HasMany, Model: &testLine{}, ForeignKey: "order", ReferenceKey: "id", PerParentLimit: 3}},
+	}
+
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %+v, want %+v", tt.name, tt.got, tt.want)
+		}
+		if err := validateRelationship(reflect.TypeOf(tt.source).Elem(), tt.got); err != nil {
+			t.Errorf("%s is invalid: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package sage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPreloadManyToManyStopsOnCancellation(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	read := 0
+	db.ReturnsFunc(`FROM "post_tags" j`, []string{"id", "name"}, 10000, func(i int) []driver.Value {
+		read++
+		if i == 2 {
+			cancel()
+		}
+		return []driver.Value{int64(i + 1), "tag"}
+	})
+
+	post := &testPost{ID: 1}
+	err := c.Preload(ctx, post, map[string]*Relationship{"Tags": postTags})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Preload = %v, want context.Canceled", err)
+	}
+	if read > 10 {
+		t.Errorf("read %d rows after cancellation, want an early return", read)
+	}
+}
+
+func TestPreloadHasManySelectColumns(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	ctx := context.Background()
+	db.Returns(`FROM lines `, []string{"item", "id", "order"},
+		[]driver.Value{"pen", int64(1), int64(7)},
+		[]driver.Value{"ink", int64(2), int64(7)},
+	)
+
+	lines := &Relationship{Type: HasMany, Model: &testLine{}, ForeignKey: "order", ReferenceKey: "id", SelectColumns: []string{"item"}}
+	order := &testOrder{ID: 7}
+	if err := c.Preload(ctx, order, map[string]*Relationship{"Lines": lines}); err != nil {
+		t.Fatalf("Preload: %v", err)
+	}
+
+	queries := db.Queries()
+	if len(queries) != 1 || queries[0] != `SELECT "item", "id", "order" FROM lines WHERE "order" = $1` {
+		t.Errorf("queries = %q, want a select of item and the keys", queries)
+	}
+	want := []*testLine{{ID: 1, Order: 7, Item: "pen"}, {ID: 2, Order: 7, Item: "ink"}}
+	if !reflect.DeepEqual(order.Lines, want) {
+		t.Errorf("Lines = %+v, want %+v", order.Lines, want)
+	}
+
+	lines.SelectColumns = []string{"price"}
+	if err := c.Preload(ctx, order, map[string]*Relationship{"Lines": lines}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Preload with an unknown column = %v, want ErrInvalidArgument", err)
+	}
+}
+
+// testComment belongs to a thread through a nullable foreign key
+type testComment struct {
+	ID       int64  `db:"id,pk,auto"`
+	ThreadID *int64 `db:"thread_id,nullable"`
+	Body     string `db:"body"`
+}
+
+func (testComment) TableName() string  { return "comments" }
+func (testComment) PrimaryKey() string { return "id" }
+
+// testThread has comments
+type testThread struct {
+	ID       int64          `db:"id,pk,auto"`
+	Comments []*testComment `db:"-"`
+}
+
+func (testThread) TableName() string  { return "threads" }
+func (testThread) PrimaryKey() string { return "id" }
+
+func TestPreloadHasManyPerParentLimit(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	db.Returns("sage_ranked", []string{"id", "thread_id", "body", "sage_row_number"},
+		[]driver.Value{int64(12), int64(1), "newest", int64(1)},
+		[]driver.Value{int64(11), int64(1), "older", int64(2)},
+		[]driver.Value{int64(21), int64(2), "only", int64(1)},
+		[]driver.Value{int64(30), nil, "orphan", int64(1)},
+	)
+
+	comments := &Relationship{Type: HasMany, Model: &testComment{}, ForeignKey: "thread_id", ReferenceKey: "id", PerParentLimit: 2, OrderBy: "id DESC"}
+	threads := []*testThread{{ID: 1}, {ID: 2}, {ID: 3}}
+	if err := c.Preload(context.Background(), &threads, map[string]*Relationship{"Comments": comments}); err != nil {
+		t.Fatalf("Preload: %v", err)
+	}
+
+	statements := db.Statements()
+	if len(statements) != 1 {
+		t.Fatalf("got %d queries, want one for every parent", len(statements))
+	}
+	want := `SELECT * FROM (SELECT r.*, ROW_NUMBER() OVER (PARTITION BY r."thread_id" ORDER BY id DESC) AS sage_row_number FROM "comments" r WHERE r."thread_id" IN ($1, $2, $3)) sage_ranked WHERE sage_row_number <= 2 ORDER BY "thread_id", sage_row_number`
+	if statements[0].Query != want {
+		t.Errorf("query = %q, want %q", statements[0].Query, want)
+	}
+	if !reflect.DeepEqual(statements[0].Args, []driver.Value{int64(1), int64(2), int64(3)}) {
+		t.Errorf("args = %v, want the three thread ids", statements[0].Args)
+	}
+
+	for i, bodies := range [][]string{{"newest", "older"}, {"only"}, nil} {
+		var got []string
+		for _, comment := range threads[i].Comments {
+			got = append(got, comment.Body)
+		}
+		if len(got) > comments.PerParentLimit || !reflect.DeepEqual(got, bodies) {
+			t.Errorf("thread %d comments = %v, want %v", threads[i].ID, got, bodies)
+		}
+	}
+}
+
+func TestPreloadManyToManyJoinType(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	ctx := context.Background()
+
+	// Tag 2 was deleted but its join row remains
+	db.Returns("INNER JOIN", []string{"id", "name"}, []driver.Value{int64(1), "go"})
+	db.Returns("LEFT JOIN", []string{"id", "name"}, []driver.Value{int64(1), "go"}, []driver.Value{nil, nil})
+
+	tests := []struct {
+		joinType string
+		query    string
+		tags     []*testTag
+	}{
+		{"", `SELECT r.* FROM "post_tags" j INNER JOIN "tags" r ON r."id" = j."tag_id" WHERE j."post_id" = $1`, []*testTag{{ID: 1, Name: "go"}}},
+		{"left", `SELECT r.* FROM "post_tags" j LEFT JOIN "tags" r ON r."id" = j."tag_id" WHERE j."post_id" = $1`, []*testTag{{ID: 1, Name: "go"}, {}}},
+	}
+
+	for _, tt := range tests {
+		db.Reset()
+		rel := *postTags
+		rel.JoinType = tt.joinType
+
+		post := &testPost{ID: 1}
+		if err := c.Preload(ctx, post, map[string]*Relationship{"Tags": &rel}); err != nil {
+			t.Fatalf("Preload with %q join: %v", tt.joinType, err)
+		}
+		if queries := db.Queries(); len(queries) != 1 || queries[0] != tt.query {
+			t.Errorf("%q join queries = %q, want %q", tt.joinType, queries, tt.query)
+		}
+		if !reflect.DeepEqual(post.Tags, tt.tags) {
+			t.Errorf("%q join Tags = %+v, want %+v", tt.joinType, post.Tags, tt.tags)
+		}
+	}
+
+	rel := *postTags
+	rel.JoinType = "CROSS"
+	if err := c.Preload(ctx, &testPost{ID: 1}, map[string]*Relationship{"Tags": &rel}); err == nil {
+		t.Error("Preload with a CROSS join succeeded, want an invalid join type error")
+	}
+}
+
+// testMember belongs to a tenant-scoped team
+type testMember struct {
+	ID       int64  `db:"id,pk,auto"`
+	TenantID int64  `db:"tenant_id"`
+	TeamNo   int64  `db:"team_no"`
+	Name     string `db:"name"`
+}
+
+func (testMember) TableName() string  { return "members" }
+func (testMember) PrimaryKey() string { return "id" }
+
+// testTeam is numbered per tenant
+type testTeam struct {
+	ID       int64         `db:"id,pk,auto"`
+	TenantID int64         `db:"tenant_id"`
+	No       int64         `db:"no"`
+	Members  []*testMember `db:"-"`
+}
+
+func (testTeam) TableName() string  { return "teams" }
+func (testTeam) PrimaryKey() string { return "id" }
+
+func TestPreloadHasManyCompositeForeignKey(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	db.Returns("FROM members", []string{"id", "tenant_id", "team_no", "name"},
+		[]driver.Value{int64(1), int64(4), int64(2), "Ann"},
+		[]driver.Value{int64(2), int64(4), int64(2), "Bob"},
+	)
+
+	members := &Relationship{Type: HasMany, Model: &testMember{}, ForeignKey: "tenant_id, team_no", ReferenceKey: "tenant_id, no"}
+	team := &testTeam{ID: 9, TenantID: 4, No: 2}
+	if err := c.Preload(context.Background(), team, map[string]*Relationship{"Members": members}); err != nil {
+		t.Fatalf("Preload: %v", err)
+	}
+
+	statements := db.Statements()
+	if len(statements) != 1 || statements[0].Query != `SELECT * FROM members WHERE ("tenant_id" = $1) AND ("team_no" = $2)` {
+		t.Fatalf("statements = %v, want a select on both key columns", statements)
+	}
+	if !reflect.DeepEqual(statements[0].Args, []driver.Value{int64(4), int64(2)}) {
+		t.Errorf("args = %v, want [4 2]", statements[0].Args)
+	}
+	want := []*testMember{{ID: 1, TenantID: 4, TeamNo: 2, Name: "Ann"}, {ID: 2, TenantID: 4, TeamNo: 2, Name: "Bob"}}
+	if !reflect.DeepEqual(team.Members, want) {
+		t.Errorf("Members = %+v, want %+v", team.Members, want)
+	}
+
+	members.ReferenceKey = "tenant_id"
+	if err := c.Preload(context.Background(), team, map[string]*Relationship{"Members": members}); err == nil {
+		t.Error("Preload with mismatched key columns succeeded")
+	}
+}
+
+func TestPreloadMaxPreload(t *testing.T) {
+	rows := [][]driver.Value{
+		{int64(1), int64(7), "pen"},
+		{int64(2), int64(7), "ink"},
+		{int64(3), int64(7), "pad"},
+	}
+	lines := &Relationship{Type: HasMany, Model: &testLine{}, ForeignKey: "order", ReferenceKey: "id"}
+	ctx := context.Background()
+
+	// The cap is applied to the query
+	c, db := openTestConnection(t, ConnectionOptions{Driver: "postgres", MaxPreload: 2})
+	db.Returns("FROM lines", []string{"id", "order", "item"}, rows[:2]...)
+	order := &testOrder{ID: 7}
+	if err := c.Preload(ctx, order, map[string]*Relationship{"Lines": lines}); err != nil {
+		t.Fatalf("Preload: %v", err)
+	}
+	if len(order.Lines) != 2 {
+		t.Errorf("loaded %d lines, want 2", len(order.Lines))
+	}
+	if err := c.Preload(ctx, &testPost{ID: 1}, map[string]*Relationship{"Tags": postTags}); err != nil {
+		t.Fatalf("Preload: %v", err)
+	}
+
+	// A lower per-relationship limit wins
+	limited := *lines
+	limited.PerParentLimit = 1
+	if err := c.Preload(ctx, order, map[string]*Relationship{"Lines": &limited}); err != nil {
+		t.Fatalf("Preload: %v", err)
+	}
+	assertQueries(t, db,
+		`SELECT * FROM lines WHERE "order" = $1 LIMIT 2`,
+		`SELECT r.* FROM "post_tags" j INNER JOIN "tags" r ON r."id" = j."tag_id" WHERE j."post_id" = $1 LIMIT 2`,
+		`SELECT * FROM lines WHERE "order" = $1 LIMIT 1`,
+	)
+
+	// A strict cap fetches one more model to detect an over-limit load
+	c, db = openTestConnection(t, ConnectionOptions{Driver: "postgres", MaxPreload: 2, StrictMaxPreload: true})
+	db.Returns("FROM lines", []string{"id", "order", "item"}, rows...)
+	if err := c.Preload(ctx, &testOrder{ID: 7}, map[string]*Relationship{"Lines": lines}); !errors.Is(err, ErrPreloadLimit) {
+		t.Errorf("Preload over the cap = %v, want ErrPreloadLimit", err)
+	}
+	assertQueries(t, db, `SELECT * FROM lines WHERE "order" = $1 LIMIT 3`)
+}
+
+func TestAssociateConstraintViolations(t *testing.T) {
+	tests := []struct {
+		driver    string
+		duplicate string
+		missing   string
+	}{
+		{"postgres", `pq: duplicate key value violates unique constraint "post_tags_pkey"`, `pq: insert or update on table "post_tags" violates foreign key constraint "post_tags_tag_id_fkey"`},
+		{"mysql", "Error 1062 (23000): Duplicate entry '1-3' for key 'PRIMARY'", "Error 1452 (23000): Cannot add or update a child row: a foreign key constraint fails"},
+		{"sqlite", "UNIQUE constraint failed: post_tags.post_id, post_tags.tag_id", "FOREIGN KEY constraint failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			c, db := newTestConnection(t, tt.driver)
+			ctx := context.Background()
+			post := &testPost{ID: 1}
+
+			db.FailsOnce("post_tags", errors.New(tt.duplicate))
+			err := c.Associate(ctx, post, "Tags", &testTag{ID: 3}, postTags)
+			if !errors.Is(err, ErrDuplicate) || errors.Is(err, ErrForeignKeyViolation) {
+				t.Errorf("Associate of an existing pair = %v, want ErrDuplicate", err)
+			}
+			if !strings.Contains(err.Error(), tt.duplicate) {
+				t.Errorf("error %q lacks the driver error", err)
+			}
+
+			db.FailsOnce("post_tags", errors.New(tt.missing))
+			err = c.Associate(ctx, post, "Tags", &testTag{ID: 404}, postTags)
+			if !errors.Is(err, ErrForeignKeyViolation) || errors.Is(err, ErrDuplicate) {
+				t.Errorf("Associate of a missing tag = %v, want ErrForeignKeyViolation", err)
+			}
+
+			if err := c.Associate(ctx, post, "Tags", &testTag{ID: 4}, postTags); err != nil {
+				t.Errorf("Associate = %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadRelationAfterFind(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	ctx := context.Background()
+	db.Returns("FROM threads", []string{"id"}, []driver.Value{int64(1)})
+	db.Returns("FROM comments", []string{"id", "thread_id", "body"},
+		[]driver.Value{int64(10), int64(1), "first"},
+		[]driver.Value{int64(11), int64(1), "second"},
+	)
+
+	var thread testThread
+	if err := c.Find(ctx, &thread, 1); err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if thread.Comments != nil {
+		t.Fatalf("Find loaded comments %v", thread.Comments)
+	}
+
+	comments := &Relationship{Type: HasMany, Model: &testComment{}, ForeignKey: "thread_id", ReferenceKey: "id"}
+	if err := c.LoadRelation(ctx, &thread, "Comments", comments); err != nil {
+		t.Fatalf("LoadRelation: %v", err)
+	}
+
+	var bodies []string
+	for _, comment := range thread.Comments {
+		bodies = append(bodies, comment.Body)
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(bodies, want) {
+		t.Errorf("comments = %v, want %v", bodies, want)
+	}
+	statements := db.Statements()
+	if len(statements) != 2 || statements[1].Query != `SELECT * FROM comments WHERE "thread_id" = $1` || !reflect.DeepEqual(statements[1].Args, []driver.Value{int64(1)}) {
+		t.Errorf("statements = %v, want the find and one comments query for thread 1", statements)
+	}
+
+	if err := c.LoadRelation(ctx, thread, "Comments", comments); err == nil {
+		t.Error("LoadRelation into a struct value succeeded")
+	}
+}
+
+// testTask has optional belongs-to relationships
+type testTask struct {
+	ID         int64     `db:"id,pk,auto"`
+	AssigneeID int64     `db:"assignee_id"`
+	ReviewerID *int64    `db:"reviewer_id,nullable"`
+	Assignee   *testUser `db:"-"`
+	Reviewer   *testUser `db:"-"`
+}
+
+func (testTask) TableName() string  { return "tasks" }
+func (testTask) PrimaryKey() string { return "id" }
+
+func TestPreloadBelongsToSkipsUnsetForeignKeys(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	db.Returns("FROM users", []string{"id", "name", "email"}, []driver.Value{int64(3), "Ann", "ann@example.com"})
+	ctx := context.Background()
+
+	relationships := map[string]*Relationship{
+		"Assignee": {Type: BelongsTo, Model: &testUser{}, ForeignKey: "assignee_id", ReferenceKey: "id"},
+		"Reviewer": {Type: BelongsTo, Model: &testUser{}, ForeignKey: "reviewer_id", ReferenceKey: "id"},
+	}
+
+	// A stale related model is cleared along with its foreign key
+	task := &testTask{ID: 1, Assignee: &testUser{ID: 9}}
+	if err := c.Preload(ctx, task, relationships); err != nil {
+		t.Fatalf("Preload: %v", err)
+	}
+	if task.Assignee != nil || task.Reviewer != nil {
+		t.Errorf("Assignee = %v, Reviewer = %v, want both nil", task.Assignee, task.Reviewer)
+	}
+	if queries := db.Queries(); len(queries) != 0 {
+		t.Errorf("preloading unset foreign keys ran %q", queries)
+	}
+
+	reviewer := int64(3)
+	task = &testTask{ID: 1, AssigneeID: 3, ReviewerID: &reviewer}
+	if err := c.Preload(ctx, task, relationships); err != nil {
+		t.Fatalf("Preload: %v", err)
+	}
+	if task.Assignee == nil || task.Assignee.Name != "Ann" || task.Reviewer == nil || task.Reviewer.Name != "Ann" {
+		t.Errorf("Assignee = %v, Reviewer = %v, want user 3", task.Assignee, task.Reviewer)
+	}
+	if n := len(db.Queries()); n != 2 {
+		t.Errorf("ran %d queries for set foreign keys, want 2", n)
+	}
+}
@@ -0,0 +1,70 @@
+package sage
+
+import (
+	"context"
+	"reflect"
+	"sort"
+)
+
+// scopeKey is the context key under which scope values are stored
+type scopeKey struct{}
+
+// WithScopeValue returns a context that scopes model operations to rows where
+// column equals value. Create stamps the value on models that have the column,
+// and reads, updates and deletes filter on it.
+func WithScopeValue(ctx context.Context, column string, value interface{}) context.Context {
+	current := scopeValues(ctx)
+	scopes := make(map[string]interface{}, len(current)+1)
+	for col, val := range current {
+		scopes[col] = val
+	}
+	scopes[column] = value
+	return context.WithValue(ctx, scopeKey{}, scopes)
+}
+
+// scopeValues returns the scope values stored in the context
+func scopeValues(ctx context.Context) map[string]interface{} {
+	scopes, _ := ctx.Value(scopeKey{}).(map[string]interface{})
+	return scopes
+}
+
+// applyScopes adds a WHERE condition for each scope column the model has
+func (c *Connection) applyScopes(ctx context.Context, qb *QueryBuilder, info *ModelInfo) {
+	scopes := scopeValues(ctx)
+	if len(scopes) == 0 {
+		return
+	}
+
+	columns := make([]string, 0, len(scopes))
+	for _, field := range info.Fields {
+		if _, ok := scopes[field.DBName]; ok {
+			columns = append(columns, field.DBName)
+		}
+	}
+	sort.Strings(columns)
+
+	for _, column := range columns {
+		qb.Where(c.dialect.Quote(column)+" = ?", scopes[column])
+	}
+}
+
+// stampScopes sets the scope values on the model's matching fields
+func stampScopes(ctx context.Context, v reflect.Value, info *ModelInfo) {
+	scopes := scopeValues(ctx)
+	if len(scopes) == 0 {
+		return
+	}
+
+	for _, field := range info.Fields {
+		value, ok := scopes[field.DBName]
+		if !ok || value == nil {
+			continue
+		}
+
+		fieldValue := v.FieldByName(field.Name)
+		scopeValue := reflect.ValueOf(value)
+		if fieldValue.CanSet() && scopeValue.Type().ConvertibleTo(fieldValue.Type()) {
+			fieldValue.Set(scopeValue.Convert(fieldValue.Type()))
+		}
+	}
+}
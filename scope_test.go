@@ -0,0 +1,69 @@
+package sage
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testTenantUser is a model scoped by tenant
+type testTenantUser struct {
+	ID       int64  `db:"id,pk,auto"`
+	TenantID int64  `db:"tenant_id"`
+	Name     string `db:"name"`
+}
+
+func (testTenantUser) TableName() string  { return "tenant_users" }
+func (testTenantUser) PrimaryKey() string { return "id" }
+
+func TestScopeValues(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	db.Returns("COUNT(", []string{"count"}, []driver.Value{int64(0)})
+	ctx := WithScopeValue(context.Background(), "tenant_id", 42)
+
+	user := &testTenantUser{Name: "Ann"}
+	if err := c.Create(ctx, user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if user.TenantID != 42 {
+		t.Errorf("TenantID = %d, want 42", user.TenantID)
+	}
+
+	statements := db.Statements()
+	if len(statements) != 1 || !strings.Contains(statements[0].Query, "tenant_id") {
+		t.Fatalf("insert statements %v lack tenant_id", statements)
+	}
+	if !reflect.DeepEqual(statements[0].Args, []driver.Value{int64(42), "Ann"}) {
+		t.Errorf("insert args = %v, want [42 Ann]", statements[0].Args)
+	}
+
+	db.Reset()
+	var users []testTenantUser
+	if err := c.All(ctx, &users, "name = ?", "Ann"); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	if _, err := c.Count(ctx, &testTenantUser{}, nil); err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+
+	for _, statement := range db.Statements() {
+		if !strings.Contains(statement.Query, `"tenant_id" = $`) {
+			t.Errorf("read %q does not filter on tenant_id", statement.Query)
+		}
+		if last := statement.Args[len(statement.Args)-1]; last != int64(42) {
+			t.Errorf("read %q tenant argument = %v, want 42", statement.Query, last)
+		}
+	}
+
+	// Models without the column are not scoped
+	db.Reset()
+	var plain []testUser
+	if err := c.All(ctx, &plain, nil); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	if queries := db.Queries(); strings.Contains(queries[0], "tenant_id") {
+		t.Errorf("unscoped read %q filters on tenant_id", queries[0])
+	}
+}
@@ -0,0 +1,68 @@
+package sage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// StateMachine is implemented by models whose status column only allows
+// certain transitions. Update loads the stored status first and rejects an
+// illegal transition with a ValidationError, unless the connection was created
+// with SkipStateTransitions.
+type StateMachine interface {
+	// StatusColumn returns the column holding the state
+	StatusColumn() string
+	// CanTransition reports whether the state may change from one value to another
+	CanTransition(from, to interface{}) bool
+}
+
+// checkTransition validates the status change of a StateMachine model about to
+// be updated against the stored row, when the update includes the status
+// column. Missing rows are left to the update.
+func (c *Connection) checkTransition(ctx context.Context, model interface{}, v reflect.Value, info *ModelInfo, include func(FieldInfo) bool, idValue interface{}) error {
+	sm, ok := model.(StateMachine)
+	if !ok || c.options.SkipStateTransitions {
+		return nil
+	}
+
+	field, ok := fieldByColumn(info, sm.StatusColumn())
+	if !ok {
+		return fmt.Errorf("%w: unknown status column %s for table %s", ErrInvalidArgument, sm.StatusColumn(), info.TableName)
+	}
+
+	if !include(field) {
+		return nil
+	}
+
+	qb := NewQueryBuilder(info.TableName).Select(field.DBName)
+	qb.Where(info.PrimaryKey+" = ?", idValue)
+	c.applyScopes(ctx, qb, info)
+	query, args := qb.Build()
+
+	var stored interface{}
+	if err := c.queryRow(ctx, query, args...).Scan(&stored); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	from := reflect.New(field.Type).Elem()
+	if err := assignValue(from, stored); err != nil {
+		return err
+	}
+	to := v.FieldByName(field.Name)
+
+	if reflect.DeepEqual(from.Interface(), to.Interface()) {
+		return nil
+	}
+
+	if !sm.CanTransition(from.Interface(), to.Interface()) {
+		return NewValidationError(field.Name, fmt.Sprintf("invalid transition from %v to %v", from.Interface(), to.Interface()))
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package sage
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+)
+
+// testArticle moves from draft to published to archived
+type testArticle struct {
+	ID     int64  `db:"id,pk,auto"`
+	Status string `db:"status"`
+}
+
+func (testArticle) TableName() string    { return "articles" }
+func (testArticle) PrimaryKey() string   { return "id" }
+func (testArticle) StatusColumn() string { return "status" }
+
+func (testArticle) CanTransition(from, to interface{}) bool {
+	next := map[string]string{"draft": "published", "published": "archived"}
+	return next[from.(string)] == to.(string)
+}
+
+func TestStateTransitions(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	ctx := context.Background()
+
+	db.ReturnsOnce("SELECT status", []string{"status"}, []driver.Value{[]byte("draft")})
+	if err := c.Update(ctx, &testArticle{ID: 1, Status: "published"}); err != nil {
+		t.Fatalf("Update draft to published: %v", err)
+	}
+	assertQueries(t, db,
+		"SELECT status FROM articles WHERE id = $1",
+		"UPDATE articles SET status = $1 WHERE id = $2",
+	)
+
+	db.Reset()
+	db.ReturnsOnce("SELECT status", []string{"status"}, []driver.Value{[]byte("archived")})
+	err := c.Update(ctx, &testArticle{ID: 2, Status: "draft"})
+	if !IsValidationError(err) {
+		t.Fatalf("Update archived to draft = %v, want a ValidationError", err)
+	}
+	assertQueries(t, db, "SELECT status FROM articles WHERE id = $1")
+
+	// The stored row is not loaded when transitions are not checked
+	c, db = openTestConnection(t, ConnectionOptions{Driver: "postgres", SkipStateTransitions: true})
+	if err := c.Update(ctx, &testArticle{ID: 2, Status: "draft"}); err != nil {
+		t.Fatalf("Update without transition checks: %v", err)
+	}
+	assertQueries(t, db, "UPDATE articles SET status = $1 WHERE id = $2")
+}
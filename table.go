@@ -0,0 +1,83 @@
+package sage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Truncate removes all rows from the model's table
+func (c *Connection) Truncate(ctx context.Context, model interface{}) error {
+	info, err := c.modelInfo(ctx, model)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.exec(ctx, c.dialect.TruncateTableSQL(info.TableName)); err != nil {
+		return WrapError(err, "truncate %s", info.TableName)
+	}
+	c.invalidateTable(ctx, info.TableName)
+
+	return nil
+}
+
+// DropTable drops the model's table if it exists
+func (c *Connection) DropTable(ctx context.Context, model interface{}) error {
+	info, err := c.modelInfo(ctx, model)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.exec(ctx, c.dialect.DropTableSQL(info.TableName)); err != nil {
+		return WrapError(err, "drop table %s", info.TableName)
+	}
+	c.invalidateTable(ctx, info.TableName)
+
+	return nil
+}
+
+// TableExists checks if a table with the given name exists in the current database
+func (c *Connection) TableExists(ctx context.Context, tableName string) (bool, error) {
+	var result interface{}
+	if err := c.queryRow(ctx, c.dialect.TableExistsSQL(tableName)).Scan(&result); err != nil {
+		return false, WrapError(err, "table exists %s", tableName)
+	}
+
+	// Dialects answer with either EXISTS (a boolean) or COUNT (a number)
+	switch v := result.(type) {
+	case bool:
+		return v, nil
+	case int64:
+		return v > 0, nil
+	case []byte:
+		return parseExists(string(v))
+	case string:
+		return parseExists(v)
+	}
+
+	return false, fmt.Errorf("table exists %s: unexpected result %v", tableName, result)
+}
+
+// NextSequenceValue advances the named sequence and returns its new value,
+// e.g. to allocate a primary key before inserting the row. It fails with
+// ErrInvalidOperation on databases without sequences.
+func (c *Connection) NextSequenceValue(ctx context.Context, sequence string) (int64, error) {
+	query := c.dialect.NextSequenceValueSQL(sequence)
+	if query == "" {
+		return 0, WrapError(ErrInvalidOperation, "next value of sequence %s: %s has no sequences", sequence, c.dialect.Name())
+	}
+
+	var value int64
+	if err := c.queryRow(ctx, query).Scan(&value); err != nil {
+		return 0, WrapError(err, "next value of sequence %s", sequence)
+	}
+	return value, nil
+}
+
+// parseExists parses a textual EXISTS or COUNT result
+func parseExists(s string) (bool, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n > 0, nil
+	}
+	return strconv.ParseBool(s)
+}
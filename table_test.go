@@ -0,0 +1,145 @@
+package sage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		driver   string
+		truncate string
+	}{
+		{"postgres", `TRUNCATE TABLE "users"`},
+		{"mysql", "TRUNCATE TABLE `users`"},
+		{"sqlite", `DELETE FROM "users"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			c, db := newTestConnection(t, tt.driver)
+			c.SetCache(&mapCache{}, time.Minute)
+			ctx := context.Background()
+
+			// The table holds two users until it is truncated
+			db.ReturnsOnce("FROM users", []string{"id", "name", "email"},
+				[]driver.Value{int64(1), "Ann", "ann@example.com"},
+				[]driver.Value{int64(2), "Bob", "bob@example.com"},
+			)
+
+			var before []testUser
+			if err := c.All(ctx, &before, nil); err != nil {
+				t.Fatalf("All: %v", err)
+			}
+			if len(before) != 2 {
+				t.Fatalf("got %d users before truncating, want 2", len(before))
+			}
+
+			if err := c.Truncate(ctx, &testUser{}); err != nil {
+				t.Fatalf("Truncate: %v", err)
+			}
+
+			var after []testUser
+			if err := c.All(ctx, &after, nil); err != nil {
+				t.Fatalf("All: %v", err)
+			}
+			if len(after) != 0 {
+				t.Errorf("got %d users after truncating, want none", len(after))
+			}
+
+			if queries := db.Queries(); len(queries) != 3 || queries[1] != tt.truncate {
+				t.Errorf("queries = %q, want %s between the selects", queries, tt.truncate)
+			}
+		})
+	}
+}
+
+func TestDropTable(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	if err := c.DropTable(context.Background(), &testUser{}); err != nil {
+		t.Fatalf("DropTable: %v", err)
+	}
+	assertQueries(t, db, `DROP TABLE IF EXISTS "users"`)
+}
+
+func TestTableExists(t *testing.T) {
+	tests := []struct {
+		driver  string
+		match   string
+		exists  driver.Value
+		missing driver.Value
+	}{
+		{"postgres", "SELECT EXISTS", true, false},
+		{"mysql", "SELECT COUNT(*)", int64(1), int64(0)},
+		{"sqlite", "SELECT COUNT(*)", []byte("1"), []byte("0")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			c, db := newTestConnection(t, tt.driver)
+			ctx := context.Background()
+
+			db.Returns(tt.match, []string{"exists"}, []driver.Value{tt.missing})
+			db.Returns("'users'", []string{"exists"}, []driver.Value{tt.exists})
+
+			for table, want := range map[string]bool{"users": true, "missing": false} {
+				exists, err := c.TableExists(ctx, table)
+				if err != nil {
+					t.Fatalf("TableExists(%s): %v", table, err)
+				}
+				if exists != want {
+					t.Errorf("TableExists(%s) = %t, want %t", table, exists, want)
+				}
+			}
+
+			// Names are escaped inside the string literal
+			db.Reset()
+			if _, err := c.TableExists(ctx, "o'brien"); err != nil {
+				t.Fatalf("TableExists: %v", err)
+			}
+			if queries := db.Queries(); !strings.Contains(queries[0], "'o''brien'") {
+				t.Errorf("query %q does not escape the table name", queries[0])
+			}
+		})
+	}
+}
+
+func TestNextSequenceValue(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	ctx := context.Background()
+	// The rule added last answers first
+	db.ReturnsOnce("nextval(", []string{"nextval"}, []driver.Value{int64(42)})
+	db.ReturnsOnce("nextval(", []string{"nextval"}, []driver.Value{int64(41)})
+
+	var values []int64
+	for i := 0; i < 2; i++ {
+		value, err := c.NextSequenceValue(ctx, "order_ids")
+		if err != nil {
+			t.Fatalf("NextSequenceValue: %v", err)
+		}
+		values = append(values, value)
+	}
+	if values[0] != 41 || values[1] != 42 {
+		t.Errorf("values = %v, want [41 42]", values)
+	}
+	assertQueries(t, db, "SELECT nextval('order_ids')", "SELECT nextval('order_ids')")
+
+	// The name is a literal, not SQL
+	db.Reset()
+	c.NextSequenceValue(ctx, "ids'); DROP TABLE orders; --")
+	assertQueries(t, db, "SELECT nextval('ids''); DROP TABLE orders; --')")
+
+	for _, name := range []string{"mysql", "sqlite"} {
+		c, db := newTestConnection(t, name)
+		if _, err := c.NextSequenceValue(ctx, "order_ids"); !errors.Is(err, ErrInvalidOperation) {
+			t.Errorf("%s: NextSequenceValue = %v, want ErrInvalidOperation", name, err)
+		}
+		if queries := db.Queries(); len(queries) != 0 {
+			t.Errorf("%s: ran %q", name, queries)
+		}
+	}
+}
@@ -3,16 +3,80 @@ package sage
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/IMPHNEN/sage/internal/dialect"
 )
 
 // Transaction represents a database transaction
 type Transaction struct {
-	tx *sql.Tx
+	tx      *sql.Tx
+	dialect dialect.Dialect
+	ctx     context.Context
+
+	// commitHooks run after a successful commit, keyed to run once each
+	hooksMu     sync.Mutex
+	commitKeys  map[string]bool
+	commitHooks []func()
+}
+
+// txKey is the context key holding the active transaction
+type txKey struct{}
+
+// ContextWithTransaction returns a context that makes every Connection
+// operation run on it, including preloads and nested operations, execute
+// inside tx
+func ContextWithTransaction(ctx context.Context, tx *Transaction) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// transactionFromContext returns the transaction stored in the context, if any
+func transactionFromContext(ctx context.Context) *Transaction {
+	tx, _ := ctx.Value(txKey{}).(*Transaction)
+	return tx
+}
+
+// executor returns the active transaction of the context, or the database
+func (c *Connection) executor(ctx context.Context) Executor {
+	if tx := transactionFromContext(ctx); tx != nil {
+		return tx
+	}
+	return c.DB()
 }
 
 // Commit commits the transaction
 func (t *Transaction) Commit() error {
-	return t.tx.Commit()
+	if err := t.tx.Commit(); err != nil {
+		return err
+	}
+
+	t.hooksMu.Lock()
+	hooks := t.commitHooks
+	t.commitHooks, t.commitKeys = nil, nil
+	t.hooksMu.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+	return nil
+}
+
+// onCommit registers fn to run after the transaction commits, unless a hook
+// was already registered under key
+func (t *Transaction) onCommit(key string, fn func()) {
+	t.hooksMu.Lock()
+	defer t.hooksMu.Unlock()
+
+	if t.commitKeys[key] {
+		return
+	}
+	if t.commitKeys == nil {
+		t.commitKeys = make(map[string]bool)
+	}
+	t.commitKeys[key] = true
+	t.commitHooks = append(t.commitHooks, fn)
 }
 
 // Rollback aborts the transaction
@@ -20,6 +84,70 @@ func (t *Transaction) Rollback() error {
 	return t.tx.Rollback()
 }
 
+// Context returns the context the transaction was started with, carrying the
+// transaction so that Connection operations using it run inside it
+func (t *Transaction) Context() context.Context {
+	return t.ctx
+}
+
+// DeferConstraints defers foreign key checks until the transaction commits, so
+// that mutually referencing rows can be inserted in any order. Constraints must
+// be declared deferrable on PostgreSQL. MySQL does not support deferred checks.
+func (t *Transaction) DeferConstraints(ctx context.Context) error {
+	query := t.dialect.DeferConstraintsSQL()
+	if query == "" {
+		return fmt.Errorf("%w: %s does not support deferred constraints", ErrInvalidOperation, t.dialect.Name())
+	}
+
+	_, err := t.tx.ExecContext(ctx, query)
+	return err
+}
+
+// ExportSnapshot exports the snapshot of the transaction and returns its
+// identifier, which BeginSnapshotTx uses to start transactions that see the
+// same data, e.g. to run the queries of a report in parallel. The snapshot
+// stays valid while the transaction is open. Only PostgreSQL supports it, and
+// the transaction should be REPEATABLE READ or SERIALIZABLE so that its own
+// view matches the snapshot.
+func (t *Transaction) ExportSnapshot(ctx context.Context) (string, error) {
+	query := t.dialect.ExportSnapshotSQL()
+	if query == "" {
+		return "", fmt.Errorf("%w: %s does not support exporting snapshots", ErrInvalidOperation, t.dialect.Name())
+	}
+
+	var snapshot string
+	if err := t.tx.QueryRowContext(ctx, query).Scan(&snapshot); err != nil {
+		return "", WrapError(err, "export snapshot")
+	}
+	return snapshot, nil
+}
+
+// BeginSnapshotTx starts a transaction that sees the data of a snapshot
+// exported by another transaction with ExportSnapshot. opts defaults to
+// REPEATABLE READ, which like SERIALIZABLE is required to import a snapshot.
+// Only PostgreSQL supports it.
+func (c *Connection) BeginSnapshotTx(ctx context.Context, snapshot string, opts *sql.TxOptions) (*Transaction, error) {
+	query := c.dialect.ImportSnapshotSQL(snapshot)
+	if query == "" {
+		return nil, fmt.Errorf("%w: %s does not support importing snapshots", ErrInvalidOperation, c.dialect.Name())
+	}
+
+	if opts == nil {
+		opts = &sql.TxOptions{Isolation: sql.LevelRepeatableRead}
+	}
+
+	tx, err := c.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The snapshot must be set before the transaction runs any other query
+	if _, err := tx.tx.ExecContext(ctx, query); err != nil {
+		return nil, errors.Join(WrapError(err, "import snapshot %s", snapshot), rollback(tx))
+	}
+	return tx, nil
+}
+
 // Exec executes a query without returning any rows
 func (t *Transaction) Exec(query string, args ...interface{}) (sql.Result, error) {
 	return t.tx.Exec(query, args...)
@@ -50,8 +178,18 @@ func (t *Transaction) QueryRowContext(ctx context.Context, query string, args ..
 	return t.tx.QueryRowContext(ctx, query, args...)
 }
 
-// WithTransaction runs a function within a transaction
-func (c *Connection) WithTransaction(ctx context.Context, fn func(*Transaction) error) error {
+// WithTransaction runs a function within a transaction. Connection operations
+// run with tx.Context(), including preloads and nested operations, are part of
+// the transaction. Errors caused by a lost connection are wrapped with
+// ErrConnectionFailed, so callers can retry the whole transaction. If rolling
+// back after an error or panic fails, the rollback error is joined to it.
+func (c *Connection) WithTransaction(ctx context.Context, fn func(*Transaction) error) (err error) {
+	defer func() {
+		if IsConnectionError(err) && !errors.Is(err, ErrConnectionFailed) {
+			err = fmt.Errorf("%w: %w", ErrConnectionFailed, err)
+		}
+	}()
+
 	tx, err := c.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -59,12 +197,21 @@ func (c *Connection) WithTransaction(ctx context.Context, fn func(*Transaction)
 
 	defer func() {
 		if p := recover(); p != nil {
-			// Rollback on panic
-			_ = tx.Rollback()
-			panic(p) // Re-throw panic after rollback
+			// Rollback on panic, and re-throw the panic after rollback. A
+			// failed rollback is joined to the panic value.
+			if rbErr := rollback(tx); rbErr != nil {
+				panicErr, ok := p.(error)
+				if !ok {
+					panicErr = fmt.Errorf("panic: %v", p)
+				}
+				panic(errors.Join(panicErr, rbErr))
+			}
+			panic(p)
 		} else if err != nil {
-			// Rollback on error
-			_ = tx.Rollback()
+			// Rollback on error, reporting a failed rollback alongside it
+			if rbErr := rollback(tx); rbErr != nil {
+				err = errors.Join(err, rbErr)
+			}
 		}
 	}()
 
@@ -75,3 +222,26 @@ func (c *Connection) WithTransaction(ctx context.Context, fn func(*Transaction)
 
 	return tx.Commit()
 }
+
+// rollback rolls the transaction back, ignoring transactions that fn already
+// committed or rolled back
+func rollback(tx *Transaction) error {
+	if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return fmt.Errorf("%w: rollback: %w", ErrTransactionFailed, err)
+	}
+	return nil
+}
+
+// WithTransactionContext runs a function within a transaction carried by the
+// context passed to fn, so that every operation using that context, including
+// preloads and nested operations, is part of the transaction. If ctx already
+// carries a transaction fn joins it instead of starting a new one.
+func (c *Connection) WithTransactionContext(ctx context.Context, fn func(ctx context.Context) error) error {
+	if transactionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	return c.WithTransaction(ctx, func(tx *Transaction) error {
+		return fn(ContextWithTransaction(ctx, tx))
+	})
+}
@@ -0,0 +1,244 @@
+package sage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IMPHNEN/sage/internal/testdb"
+)
+
+// testEmployee references its manager, possibly in a cycle
+type testEmployee struct {
+	ID        int64 `db:"id,pk"`
+	ManagerID int64 `db:"manager_id"`
+}
+
+func (testEmployee) TableName() string  { return "employees" }
+func (testEmployee) PrimaryKey() string { return "id" }
+
+func TestDeferConstraints(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+
+	// Two employees managing each other can only be inserted with the
+	// foreign key checked at commit
+	err := c.WithTransaction(context.Background(), func(tx *Transaction) error {
+		if err := tx.DeferConstraints(tx.Context()); err != nil {
+			return err
+		}
+		if err := c.Create(tx.Context(), &testEmployee{ID: 1, ManagerID: 2}); err != nil {
+			return err
+		}
+		return c.Create(tx.Context(), &testEmployee{ID: 2, ManagerID: 1})
+	})
+	if err != nil {
+		t.Fatalf("WithTransaction: %v", err)
+	}
+
+	assertQueries(t, db,
+		"BEGIN",
+		"SET CONSTRAINTS ALL DEFERRED",
+		"INSERT INTO employees (id, manager_id) VALUES ($1, $2)",
+		"INSERT INTO employees (id, manager_id) VALUES ($1, $2)",
+		"COMMIT",
+	)
+	statements := db.Statements()
+	for _, statement := range statements {
+		if statement.Conn != statements[0].Conn {
+			t.Errorf("%q ran outside the transaction", statement.Query)
+		}
+	}
+
+	c, _ = newTestConnection(t, "mysql")
+	err = c.WithTransaction(context.Background(), func(tx *Transaction) error {
+		return tx.DeferConstraints(tx.Context())
+	})
+	if !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("DeferConstraints on MySQL = %v, want ErrInvalidOperation", err)
+	}
+}
+
+func TestTransactionContext(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	db.InsertID("INSERT INTO", 1)
+
+	lines := &Relationship{Type: HasMany, Model: &testLine{}, ForeignKey: "order", ReferenceKey: "id"}
+	failed := errors.New("failed")
+	err := c.WithTransaction(context.Background(), func(tx *Transaction) error {
+		if transactionFromContext(tx.Context()) != tx {
+			t.Error("Context does not carry the transaction")
+		}
+
+		order := &testOrder{Lines: []*testLine{{Item: "a"}}}
+		if err := c.CreateNested(tx.Context(), order, map[string]*Relationship{"Lines": lines}, NestedOption{AutoSave: true}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("WithTransaction = %v, want %v", err, failed)
+	}
+
+	assertQueries(t, db,
+		"BEGIN",
+		`INSERT INTO "orders" DEFAULT VALUES`,
+		"INSERT INTO lines (order, item) VALUES ($1, $2)",
+		"ROLLBACK",
+	)
+	statements := db.Statements()
+	for _, statement := range statements {
+		if statement.Conn != statements[0].Conn {
+			t.Errorf("%q ran outside the transaction", statement.Query)
+		}
+	}
+}
+
+func TestWithTransactionReportsRollbackErrors(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	rollbackFailed := errors.New("rollback failed")
+	db.Fails("ROLLBACK", rollbackFailed)
+
+	failed := errors.New("failed")
+	err := c.WithTransaction(context.Background(), func(tx *Transaction) error {
+		return failed
+	})
+	if !errors.Is(err, failed) || !errors.Is(err, rollbackFailed) || !errors.Is(err, ErrTransactionFailed) {
+		t.Errorf("WithTransaction = %v, want %v joined with the rollback error", err, failed)
+	}
+
+	// A panic is re-raised with the rollback error joined to it
+	defer func() {
+		p := recover()
+		panicErr, ok := p.(error)
+		if !ok || !errors.Is(panicErr, rollbackFailed) || !strings.Contains(panicErr.Error(), "panic: boom") {
+			t.Errorf("recovered %v, want the panic joined with the rollback error", p)
+		}
+	}()
+	c.WithTransaction(context.Background(), func(tx *Transaction) error {
+		panic("boom")
+	})
+	t.Error("WithTransaction did not re-panic")
+}
+
+func TestWithTransactionRepanics(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+
+	defer func() {
+		if p := recover(); p != "boom" {
+			t.Errorf("recovered %v, want the original panic value", p)
+		}
+		assertQueries(t, db, "BEGIN", "ROLLBACK")
+	}()
+	c.WithTransaction(context.Background(), func(tx *Transaction) error {
+		panic("boom")
+	})
+}
+
+func TestWithTransactionCancelledContext(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	err := c.WithTransaction(ctx, func(tx *Transaction) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrConnectionFailed) {
+		t.Errorf("WithTransaction = %v, want context.Canceled", err)
+	}
+	if called {
+		t.Error("fn ran with a cancelled context")
+	}
+
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	if _, err := c.BeginTx(expired, nil); !errors.Is(err, context.DeadlineExceeded) || IsConnectionError(err) {
+		t.Errorf("BeginTx = %v, want context.DeadlineExceeded", err)
+	}
+
+	if queries := db.Queries(); len(queries) != 0 {
+		t.Errorf("ran %q with a done context", queries)
+	}
+}
+
+func TestSnapshotExportAndImport(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	db.Returns("pg_export_snapshot()", []string{"pg_export_snapshot"}, []driver.Value{"00000003-0000001B-1"})
+	ctx := context.Background()
+
+	exporter, err := c.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		t.Fatalf("BeginTx: %v", err)
+	}
+	defer exporter.Rollback()
+	snapshot, err := exporter.ExportSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("ExportSnapshot: %v", err)
+	}
+	if snapshot != "00000003-0000001B-1" {
+		t.Errorf("snapshot = %q", snapshot)
+	}
+
+	importer, err := c.BeginSnapshotTx(ctx, snapshot, nil)
+	if err != nil {
+		t.Fatalf("BeginSnapshotTx: %v", err)
+	}
+	defer importer.Rollback()
+	var users []testUser
+	if err := c.All(importer.Context(), &users, nil); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+
+	// The importing transaction sets the snapshot before any query, on its
+	// own connection, at an isolation level that keeps it
+	statements := db.Statements()
+	var imported []testdb.Statement
+	for _, statement := range statements {
+		if statement.Conn != statements[0].Conn {
+			imported = append(imported, statement)
+		}
+	}
+	want := []string{"BEGIN", "SET TRANSACTION SNAPSHOT '00000003-0000001B-1'", "SELECT * FROM users"}
+	if len(imported) != len(want) {
+		t.Fatalf("importing transaction ran %v, want %q", imported, want)
+	}
+	for i, statement := range imported {
+		if statement.Query != want[i] {
+			t.Errorf("statement %d = %q, want %q", i, statement.Query, want[i])
+		}
+	}
+	for _, opts := range db.TxOptions() {
+		if sql.IsolationLevel(opts.Isolation) != sql.LevelRepeatableRead {
+			t.Errorf("isolation = %v, want REPEATABLE READ", sql.IsolationLevel(opts.Isolation))
+		}
+	}
+
+	// A snapshot that cannot be imported rolls the transaction back
+	db.Reset()
+	db.Fails("SET TRANSACTION SNAPSHOT", errors.New("invalid snapshot identifier"))
+	if _, err := c.BeginSnapshotTx(ctx, "bogus", nil); err == nil {
+		t.Error("BeginSnapshotTx with an invalid snapshot succeeded")
+	}
+	if queries := db.Queries(); queries[len(queries)-1] != "ROLLBACK" {
+		t.Errorf("statements %q do not end with ROLLBACK", queries)
+	}
+
+	m, _ := newTestConnection(t, "mysql")
+	tx, err := m.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx: %v", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExportSnapshot(ctx); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("ExportSnapshot on MySQL = %v, want ErrInvalidOperation", err)
+	}
+	if _, err := m.BeginSnapshotTx(ctx, snapshot, nil); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("BeginSnapshotTx on MySQL = %v, want ErrInvalidOperation", err)
+	}
+}
@@ -0,0 +1,129 @@
+package sage
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Transformer converts field values on their way to and from the database,
+// e.g. to encrypt columns at rest. Fields opt in with a transform tag option
+// naming a transformer registered with RegisterTransformer:
+//
+//	SSN string `db:"ssn,transform:aes"`
+type Transformer interface {
+	// Encode converts a field value into the value stored in the database
+	Encode(value interface{}) (interface{}, error)
+	// Decode converts a stored value back into the field value
+	Decode(dbValue interface{}) (interface{}, error)
+}
+
+// RegisterTransformer registers a transformer under the name used in transform tags
+func (c *Connection) RegisterTransformer(name string, t Transformer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.transformers == nil {
+		c.transformers = make(map[string]Transformer)
+	}
+	c.transformers[name] = t
+}
+
+// transformer returns the transformer registered under the name
+func (c *Connection) transformer(name string) (Transformer, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	t, ok := c.transformers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown transformer %s", ErrInvalidArgument, name)
+	}
+	return t, nil
+}
+
+// fieldValue returns the value to send to the database for a model field,
+// encoded by the field's transformer if it has one
+func (c *Connection) fieldValue(field FieldInfo, v reflect.Value) (interface{}, error) {
+	value, err := writeValue(v)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s: %w", field.DBName, err)
+	}
+	value = field.encodeBool(value)
+	if field.Transform == "" || value == nil {
+		return value, nil
+	}
+
+	t, err := c.transformer(field.Transform)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := t.Encode(value)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s: %w", field.DBName, err)
+	}
+	return encoded, nil
+}
+
+// assignColumn assigns a scanned column value to a model field, decoding it
+// first with the field's transformer and bool_as option. Transformers receive
+// the value as the driver returned it, before any conversion to the field type.
+func (c *Connection) assignColumn(dest reflect.Value, field FieldInfo, value interface{}) error {
+	if field.Transform != "" && value != nil {
+		t, err := c.transformer(field.Transform)
+		if err != nil {
+			return err
+		}
+
+		value, err = t.Decode(value)
+		if err != nil {
+			return fmt.Errorf("decode %s: %w", field.DBName, err)
+		}
+	}
+
+	return assignValue(dest, field.decodeBool(value))
+}
+
+// encodeBool converts a boolean into the character storing it for fields
+// with a bool_as tag option, leaving other values unchanged
+func (f FieldInfo) encodeBool(value interface{}) interface{} {
+	b, ok := value.(bool)
+	if f.BoolAs == "" || !ok {
+		return value
+	}
+
+	chars := []rune(f.BoolAs)
+	if b {
+		return string(chars[0])
+	}
+	return string(chars[1])
+}
+
+// decodeBool converts a scanned character back into a boolean for fields
+// with a bool_as tag option, leaving other values unchanged
+func (f FieldInfo) decodeBool(value interface{}) interface{} {
+	if f.BoolAs == "" {
+		return value
+	}
+
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return value
+	}
+
+	// CHAR columns may pad the character with spaces
+	s = strings.TrimSpace(s)
+	chars := []rune(f.BoolAs)
+	switch {
+	case strings.EqualFold(s, string(chars[0])):
+		return true
+	case strings.EqualFold(s, string(chars[1])):
+		return false
+	}
+	return value
+}
@@ -0,0 +1,225 @@
+package sage
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// base64Transformer stores strings base64 encoded
+type base64Transformer struct{}
+
+func (base64Transformer) Encode(value interface{}) (interface{}, error) {
+	return base64.StdEncoding.EncodeToString([]byte(value.(string))), nil
+}
+
+func (base64Transformer) Decode(dbValue interface{}) (interface{}, error) {
+	s, ok := dbValue.(string)
+	if b, isBytes := dbValue.([]byte); isBytes {
+		s, ok = string(b), true
+	}
+	if !ok {
+		return nil, fmt.Errorf("cannot decode %T", dbValue)
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	return string(b), err
+}
+
+// xorTransformer stores integers as bytes that are not valid text of a number
+type xorTransformer struct{}
+
+func xorBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[i] = b[i] ^ 0xff
+	}
+	return out
+}
+
+func (xorTransformer) Encode(value interface{}) (interface{}, error) {
+	return xorBytes([]byte(fmt.Sprint(value))), nil
+}
+
+func (xorTransformer) Decode(dbValue interface{}) (interface{}, error) {
+	b, ok := dbValue.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("got %T, want the stored []byte", dbValue)
+	}
+	return strconv.ParseInt(string(xorBytes(b)), 10, 64)
+}
+
+// testPatient has a column stored encoded
+type testPatient struct {
+	ID  int64  `db:"id,pk,auto"`
+	SSN string `db:"ssn,transform:b64"`
+}
+
+func (testPatient) TableName() string  { return "patients" }
+func (testPatient) PrimaryKey() string { return "id" }
+
+func TestTransformerRoundTrip(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	c.RegisterTransformer("b64", base64Transformer{})
+	ctx := context.Background()
+
+	if err := c.Create(ctx, &testPatient{SSN: "123-45-6789"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	statements := db.Statements()
+	encoded := base64.StdEncoding.EncodeToString([]byte("123-45-6789"))
+	if len(statements) != 1 || !reflect.DeepEqual(statements[0].Args, []driver.Value{encoded}) {
+		t.Fatalf("statements = %v, want the SSN stored as %s", statements, encoded)
+	}
+
+	db.Returns("FROM patients", []string{"id", "ssn"}, []driver.Value{int64(1), []byte(encoded)})
+	var patient testPatient
+	if err := c.Find(ctx, &patient, 1); err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if patient.SSN != "123-45-6789" {
+		t.Errorf("SSN = %q, want it decoded", patient.SSN)
+	}
+}
+
+func TestDryRunKeepsTransformers(t *testing.T) {
+	c, _ := newTestConnection(t, "postgres")
+	c.RegisterTransformer("b64", base64Transformer{})
+
+	// Dry runs may start while transformers are being registered
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.RegisterTransformer(fmt.Sprintf("other%d", i), base64Transformer{})
+			c.DryRun()
+		}(i)
+	}
+	wg.Wait()
+
+	dry := c.DryRun()
+	if err := dry.Create(context.Background(), &testPatient{SSN: "secret"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	recorded := dry.RecordedQueries()
+	if len(recorded) != 1 || recorded[0].Args[0] != base64.StdEncoding.EncodeToString([]byte("secret")) {
+		t.Errorf("recorded %+v, want the encoded SSN", recorded)
+	}
+
+	// Registering on the dry run leaves the original connection unchanged
+	dry.RegisterTransformer("dry", base64Transformer{})
+	if _, err := c.transformer("dry"); err == nil {
+		t.Error("a transformer registered on the dry run is visible on the connection")
+	}
+}
+
+// testLegacyAccount has booleans stored as characters
+type testLegacyAccount struct {
+	ID     int64 `db:"id,pk,auto"`
+	Active bool  `db:"active,bool_as:YN"`
+	Locked bool  `db:"locked,bool_as:TF"`
+}
+
+func (testLegacyAccount) TableName() string  { return "legacy_accounts" }
+func (testLegacyAccount) PrimaryKey() string { return "id" }
+
+func TestBoolAsRoundTrip(t *testing.T) {
+	c, db := newTestConnection(t, "mysql")
+	db.InsertID("INSERT INTO", 1)
+	ctx := context.Background()
+
+	account := &testLegacyAccount{Active: true}
+	if err := c.Create(ctx, account); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	account.Active, account.Locked = false, true
+	if err := c.Update(ctx, account); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := c.UpdateMap(ctx, &testLegacyAccount{}, map[string]interface{}{"active": true}, "id = ?", 1); err != nil {
+		t.Fatalf("UpdateMap: %v", err)
+	}
+	var accounts []testLegacyAccount
+	if err := c.All(ctx, &accounts, Conditions{"active": true}); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+
+	statements := db.Statements()
+	if len(statements) != 4 {
+		t.Fatalf("got %d statements, want 4", len(statements))
+	}
+	wantArgs := [][]driver.Value{{"Y", "F"}, {"N", "T", int64(1)}, {"Y", int64(1)}, {"Y"}}
+	for i, statement := range statements {
+		if !reflect.DeepEqual(statement.Args, wantArgs[i]) {
+			t.Errorf("%q args = %v, want %v", statement.Query, statement.Args, wantArgs[i])
+		}
+	}
+
+	// Scans map the characters back, whatever their case or padding
+	db.Returns("FROM legacy_accounts", []string{"id", "active", "locked"},
+		[]driver.Value{int64(1), []byte("Y"), []byte("f")},
+		[]driver.Value{int64(2), "N ", "T"},
+	)
+	accounts = nil
+	if err := c.All(ctx, &accounts, nil); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	want := []testLegacyAccount{{ID: 1, Active: true}, {ID: 2, Locked: true}}
+	if !reflect.DeepEqual(accounts, want) {
+		t.Errorf("All = %+v, want %+v", accounts, want)
+	}
+
+	db.ReturnsOnce("FROM legacy_accounts", []string{"id", "active", "locked"}, []driver.Value{int64(2), "N ", "T"})
+	var found testLegacyAccount
+	if err := c.Find(ctx, &found, 2); err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if found != want[1] {
+		t.Errorf("Find = %+v, want %+v", found, want[1])
+	}
+}
+
+// testVault keeps an integer column encrypted
+type testVault struct {
+	ID  int64 `db:"id,pk,auto"`
+	PIN int   `db:"pin,omitempty,transform:xor"`
+}
+
+func (testVault) TableName() string  { return "vaults" }
+func (testVault) PrimaryKey() string { return "id" }
+
+func TestTransformerDecodesStoredValue(t *testing.T) {
+	c, db := newTestConnection(t, "postgres")
+	c.RegisterTransformer("xor", xorTransformer{})
+	ctx := context.Background()
+	stored := xorBytes([]byte("4321"))
+
+	// Values read back on insert are decoded
+	db.Returns("INSERT INTO", []string{"pin", "id"}, []driver.Value{stored, int64(1)})
+	vault := &testVault{}
+	if err := c.Create(ctx, vault); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if vault.ID != 1 || vault.PIN != 4321 {
+		t.Errorf("Create = %+v, want vault 1 with PIN 4321", vault)
+	}
+
+	// The ciphertext, which no int can hold, reaches Decode as stored
+	db.Returns("FROM vaults", []string{"id", "pin"}, []driver.Value{int64(1), stored})
+	var found testVault
+	if err := c.Find(ctx, &found, 1); err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	var all []testVault
+	if err := c.All(ctx, &all, nil); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	if found.PIN != 4321 || len(all) != 1 || all[0].PIN != 4321 {
+		t.Errorf("Find = %+v, All = %+v, want PIN 4321", found, all)
+	}
+}
@@ -0,0 +1,53 @@
+package sage
+
+import (
+	"context"
+)
+
+// UpsertBatch inserts the models in the slice with multi-row INSERT statements,
+// updating updateColumns on rows that conflict on conflictColumns. When
+// updateColumns is empty conflicting rows are left unchanged. Rows are split
+// into several statements when they exceed the dialect's parameter limit.
+func (c *Connection) UpsertBatch(ctx context.Context, models interface{}, conflictColumns []string, updateColumns []string) error {
+	sliceValue, info, err := c.batchModels(ctx, models)
+	if err != nil || sliceValue.Len() == 0 {
+		return err
+	}
+
+	if _, err := columnSet(info, conflictColumns); err != nil {
+		return err
+	}
+	if _, err := columnSet(info, updateColumns); err != nil {
+		return err
+	}
+	if err := checkMutable(info, updateColumns); err != nil {
+		return err
+	}
+
+	clause := c.dialect.UpsertClause(conflictColumns, updateColumns)
+	return c.insertBatch(ctx, sliceValue, info, "upsert", clause, nil)
+}
+
+// UpsertBatchOnConstraint is like UpsertBatch but resolves conflicts on the
+// named unique or exclusion constraint. Only PostgreSQL targets the
+// constraint itself: SQLite and MySQL resolve conflicts on any unique key, and
+// MySQL cannot skip conflicting rows so updateColumns must not be empty there.
+func (c *Connection) UpsertBatchOnConstraint(ctx context.Context, models interface{}, constraintName string, updateColumns []string) error {
+	sliceValue, info, err := c.batchModels(ctx, models)
+	if err != nil || sliceValue.Len() == 0 {
+		return err
+	}
+
+	if constraintName == "" {
+		return WrapError(ErrInvalidArgument, "upsert %s: constraint name is required", info.TableName)
+	}
+	if _, err := columnSet(info, updateColumns); err != nil {
+		return err
+	}
+	if err := checkMutable(info, updateColumns); err != nil {
+		return err
+	}
+
+	clause := c.dialect.UpsertConstraintClause(constraintName, updateColumns)
+	return c.insertBatch(ctx, sliceValue, info, "upsert", clause, nil)
+}
@@ -0,0 +1,112 @@
+package sage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUpsertBatch(t *testing.T) {
+	tests := []struct {
+		driver string
+		clause string
+	}{
+		{"postgres", `ON CONFLICT ("key") DO UPDATE SET "value" = EXCLUDED."value"`},
+		{"mysql", "ON DUPLICATE KEY UPDATE `value` = VALUES(`value`)"},
+		{"sqlite", `ON CONFLICT ("key") DO UPDATE SET "value" = EXCLUDED."value"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			c, db := newTestConnection(t, tt.driver)
+			ctx := context.Background()
+
+			settings := []testSetting{{"theme", "dark"}, {"lang", "en"}, {"tz", "UTC"}}
+			if err := c.UpsertBatch(ctx, settings, []string{"key"}, []string{"value"}); err != nil {
+				t.Fatalf("UpsertBatch: %v", err)
+			}
+
+			// Sync again with changed values
+			settings[0].Value = "light"
+			if err := c.UpsertBatch(ctx, settings, []string{"key"}, []string{"value"}); err != nil {
+				t.Fatalf("UpsertBatch: %v", err)
+			}
+
+			statements := db.Statements()
+			if len(statements) != 2 {
+				t.Fatalf("got %d statements, want one per sync", len(statements))
+			}
+			for i, statement := range statements {
+				if !strings.HasSuffix(statement.Query, tt.clause) {
+					t.Errorf("sync %d: %q does not end with %s", i+1, statement.Query, tt.clause)
+				}
+				if len(statement.Args) != 6 {
+					t.Errorf("sync %d: %d arguments, want 3 rows of 2", i+1, len(statement.Args))
+				}
+			}
+			if got := statements[1].Args[1]; got != "light" {
+				t.Errorf("second sync sends value %v, want light", got)
+			}
+		})
+	}
+}
+
+func TestUpsertBatchChunks(t *testing.T) {
+	c, db := newTestConnection(t, "sqlite")
+
+	// SQLite allows 999 parameters, 499 rows of two columns
+	settings := make([]testSetting, 1000)
+	for i := range settings {
+		settings[i] = testSetting{Key: fmt.Sprintf("key%d", i), Value: "v"}
+	}
+	if err := c.UpsertBatch(context.Background(), settings, []string{"key"}, []string{"value"}); err != nil {
+		t.Fatalf("UpsertBatch: %v", err)
+	}
+
+	rows := 0
+	statements := db.Statements()
+	for _, statement := range statements {
+		if len(statement.Args) > 999 {
+			t.Errorf("statement has %d parameters, above the limit", len(statement.Args))
+		}
+		rows += len(statement.Args) / 2
+	}
+	if len(statements) != 3 || rows != 1000 {
+		t.Errorf("upserted %d rows in %d statements, want 1000 in 3", rows, len(statements))
+	}
+}
+
+func TestUpsertBatchOnConstraint(t *testing.T) {
+	tests := []struct {
+		driver string
+		clause string
+	}{
+		{"postgres", `ON CONFLICT ON CONSTRAINT "settings_key_key" DO UPDATE SET "value" = EXCLUDED."value"`},
+		{"mysql", "ON DUPLICATE KEY UPDATE `value` = VALUES(`value`)"},
+		{"sqlite", `ON CONFLICT DO UPDATE SET "value" = EXCLUDED."value"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			c, db := newTestConnection(t, tt.driver)
+			ctx := context.Background()
+
+			settings := []testSetting{{"theme", "dark"}, {"lang", "en"}}
+			if err := c.UpsertBatchOnConstraint(ctx, settings, "settings_key_key", []string{"value"}); err != nil {
+				t.Fatalf("UpsertBatchOnConstraint: %v", err)
+			}
+
+			queries := db.Queries()
+			if len(queries) != 1 || !strings.HasSuffix(queries[0], tt.clause) {
+				t.Errorf("queries %q do not end with %s", queries, tt.clause)
+			}
+		})
+	}
+
+	c, _ := newTestConnection(t, "postgres")
+	if err := c.UpsertBatchOnConstraint(context.Background(), []testSetting{{"theme", "dark"}}, "", nil); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("UpsertBatchOnConstraint without a constraint = %v, want ErrInvalidArgument", err)
+	}
+}
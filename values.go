@@ -0,0 +1,182 @@
+package sage
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/IMPHNEN/sage/internal/dialect"
+)
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// writeValue returns the value to send to the database for a model field.
+// A nil pointer is sent as NULL and a non-nil pointer as the value it points to.
+// Structs, maps and slices that the driver cannot store are sent as JSON text.
+func writeValue(field reflect.Value) (interface{}, error) {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return nil, nil
+		}
+		field = field.Elem()
+	}
+
+	if isJSONType(field.Type()) {
+		if (field.Kind() == reflect.Map || field.Kind() == reflect.Slice) && field.IsNil() {
+			return nil, nil
+		}
+		data, err := json.Marshal(field.Interface())
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	}
+
+	return field.Interface(), nil
+}
+
+// scanTargets returns scan targets reading n columns into interface{} values.
+// Row loops allocate them once and scan every row into them: each Scan
+// overwrites all values, NULL included, and the values are assigned to the
+// model before the next row is read.
+func scanTargets(n int) []interface{} {
+	values := make([]interface{}, n)
+	for i := range values {
+		values[i] = new(interface{})
+	}
+	return values
+}
+
+// assignValue assigns a scanned database value to a model field. NULL resets
+// the field to its zero value (nil for pointers), sql.Scanner fields scan the
+// value themselves, JSON text is decoded into struct, map and slice fields,
+// text is parsed into number and bool fields, and values that cannot be
+// converted leave the field unchanged. An error is returned for values that
+// are not valid JSON for a JSON field.
+func assignValue(field reflect.Value, value interface{}) error {
+	if !field.IsValid() || !field.CanSet() {
+		return nil
+	}
+
+	if reflect.PtrTo(field.Type()).Implements(scannerType) {
+		_ = field.Addr().Interface().(sql.Scanner).Scan(value)
+		return nil
+	}
+
+	if value == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	target := field
+	if field.Kind() == reflect.Ptr {
+		target = reflect.New(field.Type().Elem()).Elem()
+	}
+
+	if isJSONType(target.Type()) {
+		if err := unmarshalJSON(target, value); err != nil {
+			return err
+		}
+	} else if b, ok := value.([]byte); ok && target.Kind() != reflect.Slice && target.Kind() != reflect.Array {
+		if !parseBytes(target, b) {
+			return nil
+		}
+	} else {
+		val := reflect.ValueOf(value)
+		if !val.Type().ConvertibleTo(target.Type()) {
+			return nil
+		}
+		target.Set(val.Convert(target.Type()))
+	}
+
+	if field.Kind() == reflect.Ptr {
+		field.Set(target.Addr())
+	}
+	return nil
+}
+
+// parseBytes parses a textual value, as MySQL returns for DECIMAL and often
+// for numeric columns, into a string, number or bool target and reports
+// whether it succeeded
+func parseBytes(target reflect.Value, b []byte) bool {
+	s := string(b)
+
+	switch target.Kind() {
+	case reflect.String:
+		target.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, target.Type().Bits())
+		if err != nil {
+			return false
+		}
+		target.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, target.Type().Bits())
+		if err != nil {
+			return false
+		}
+		target.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, target.Type().Bits())
+		if err != nil {
+			return false
+		}
+		target.SetFloat(f)
+	case reflect.Bool:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return false
+		}
+		target.SetBool(v)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// isJSONType checks if a field type is stored as JSON: a struct, map, slice
+// or array that is not a timestamp, a byte slice or array, or a
+// driver.Valuer/sql.Scanner
+func isJSONType(t reflect.Type) bool {
+	if t.Implements(valuerType) || reflect.PtrTo(t).Implements(scannerType) {
+		return false
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return !dialect.IsTimeType(t)
+	case reflect.Slice, reflect.Array:
+		return t.Elem().Kind() != reflect.Uint8
+	case reflect.Map:
+		return true
+	}
+
+	return false
+}
+
+// unmarshalJSON decodes JSON text scanned as a string or []byte into target
+func unmarshalJSON(target reflect.Value, value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot decode %T as JSON into %s", value, target.Type())
+	}
+
+	decoded := reflect.New(target.Type())
+	if err := json.Unmarshal(data, decoded.Interface()); err != nil {
+		return fmt.Errorf("decode JSON into %s: %w", target.Type(), err)
+	}
+	target.Set(decoded.Elem())
+	return nil
+}
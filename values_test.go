@@ -0,0 +1,132 @@
+package sage
+
+import (
+	"context"
+	"database/sql/driver"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testPrefs is stored as a JSON column
+type testPrefs struct {
+	Theme string   `json:"theme"`
+	Ratio float64  `json:"ratio"`
+	Tags  []string `json:"tags"`
+}
+
+// testAccount has struct, map and slice fields stored as JSON
+type testAccount struct {
+	ID     int64             `db:"id,pk,auto"`
+	Prefs  testPrefs         `db:"prefs"`
+	Labels map[string]string `db:"labels"`
+	Roles  []string          `db:"roles"`
+}
+
+func (testAccount) TableName() string  { return "accounts" }
+func (testAccount) PrimaryKey() string { return "id" }
+
+func TestJSONFieldsRoundTrip(t *testing.T) {
+	c, db := newTestConnection(t, "mysql")
+	ctx := context.Background()
+	db.InsertID("INSERT INTO accounts", 1)
+
+	account := &testAccount{
+		Prefs:  testPrefs{Theme: "dark", Ratio: 1.5, Tags: []string{"a", "b"}},
+		Labels: map[string]string{"team": "core"},
+		Roles:  []string{"admin"},
+	}
+	if err := c.Create(ctx, account); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// Return the stored JSON text as the driver does
+	stored := db.Statements()[0].Args
+	row := []driver.Value{int64(1)}
+	for _, arg := range stored {
+		row = append(row, []byte(arg.(string)))
+	}
+	db.Returns("FROM accounts", []string{"id", "prefs", "labels", "roles"}, row)
+
+	reads := []struct {
+		name string
+		read func(*testAccount) error
+	}{
+		{"Find", func(a *testAccount) error { return c.Find(ctx, a, 1) }},
+		{"First", func(a *testAccount) error { return c.First(ctx, a, "id = ?", 1) }},
+		{"Refresh", func(a *testAccount) error { a.ID = 1; return c.Refresh(ctx, a) }},
+		{"All", func(a *testAccount) error {
+			var all []testAccount
+			err := c.All(ctx, &all, nil)
+			if len(all) == 1 {
+				*a = all[0]
+			}
+			return err
+		}},
+	}
+
+	for _, r := range reads {
+		var got testAccount
+		if err := r.read(&got); err != nil {
+			t.Fatalf("%s: %v", r.name, err)
+		}
+		if !reflect.DeepEqual(&got, account) {
+			t.Errorf("%s = %+v, want %+v", r.name, got, *account)
+		}
+	}
+}
+
+func TestJSONFieldErrors(t *testing.T) {
+	c, db := newTestConnection(t, "mysql")
+	ctx := context.Background()
+
+	// NaN cannot be encoded as JSON
+	err := c.Create(ctx, &testAccount{Prefs: testPrefs{Ratio: math.NaN()}})
+	if err == nil || !strings.Contains(err.Error(), "encode prefs") {
+		t.Errorf("Create with unencodable JSON = %v, want an encode error", err)
+	}
+	if queries := db.Queries(); len(queries) != 0 {
+		t.Errorf("failed create ran %q", queries)
+	}
+
+	db.Returns("FROM accounts", []string{"id", "prefs"}, []driver.Value{int64(1), []byte("{not json")})
+	var account testAccount
+	if err := c.Find(ctx, &account, 1); err == nil || !strings.Contains(err.Error(), "JSON") {
+		t.Errorf("Find with invalid JSON = %v, want a decode error", err)
+	}
+	var accounts []testAccount
+	if err := c.All(ctx, &accounts, nil); err == nil || !strings.Contains(err.Error(), "JSON") {
+		t.Errorf("All with invalid JSON = %v, want a decode error", err)
+	}
+}
+
+// testProduct has numeric columns MySQL returns as text
+type testProduct struct {
+	ID       int64    `db:"id,pk,auto"`
+	Price    float64  `db:"price,type:decimal(10,2)"`
+	Stock    int      `db:"stock"`
+	Weight   *float32 `db:"weight,nullable"`
+	Sold     uint16   `db:"sold"`
+	Featured bool     `db:"featured"`
+}
+
+func (testProduct) TableName() string  { return "products" }
+func (testProduct) PrimaryKey() string { return "id" }
+
+func TestTextualNumbersAreParsed(t *testing.T) {
+	c, db := newTestConnection(t, "mysql")
+	db.Returns("FROM products", []string{"id", "price", "stock", "weight", "sold", "featured"},
+		[]driver.Value{[]byte("1"), []byte("19.99"), []byte("42"), []byte("0.5"), []byte("7"), []byte("1")})
+
+	var product testProduct
+	if err := c.Find(context.Background(), &product, 1); err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+
+	weight := float32(0.5)
+	want := testProduct{ID: 1, Price: 19.99, Stock: 42, Weight: &weight, Sold: 7, Featured: true}
+	if !reflect.DeepEqual(product, want) {
+		t.Errorf("Find = %+v, want %+v", product, want)
+	}
+}